@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"hackodisha/blockdag-node/internal/keystore"
+)
+
+// runKeys manages the keys in the local keystore
+func runKeys(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("usage: blockdag-node keys new|list|export|import [flags]")
+	}
+
+	flags := flag.NewFlagSet("keys "+args[0], flag.ExitOnError)
+	keystoreDir := flags.String("keystore", "./data/keystore", "directory holding encrypted keys")
+	passFile := flags.String("passfile", "", "file containing the passphrase (prompted for if empty)")
+	lightKDF := flags.Bool("lightkdf", false, "use weaker scrypt parameters for test keys")
+	flags.Parse(args[1:])
+
+	scryptN := keystore.StandardScryptN
+	if *lightKDF {
+		scryptN = keystore.LightScryptN
+	}
+
+	ks, err := keystore.New(*keystoreDir, scryptN)
+	if err != nil {
+		log.Fatalf("Failed to open keystore: %v", err)
+	}
+
+	switch args[0] {
+	case "new":
+		passphrase := readPassphrase(*passFile, "Passphrase for the new key: ")
+		address, err := ks.NewKey(passphrase)
+		if err != nil {
+			log.Fatalf("Failed to create key: %v", err)
+		}
+		fmt.Println(address)
+
+	case "list":
+		addresses, err := ks.List()
+		if err != nil {
+			log.Fatalf("Failed to list keys: %v", err)
+		}
+		for _, address := range addresses {
+			fmt.Println(address)
+		}
+
+	case "export":
+		if flags.NArg() != 1 {
+			log.Fatalf("usage: blockdag-node keys export [flags] <address>")
+		}
+		passphrase := readPassphrase(*passFile, "Passphrase: ")
+		privateKey, err := ks.Unlock(flags.Arg(0), passphrase)
+		if err != nil {
+			log.Fatalf("Failed to unlock key: %v", err)
+		}
+		// Print the raw seed; anyone holding it controls the account
+		fmt.Println(hex.EncodeToString(privateKey.Seed()))
+
+	case "import":
+		if flags.NArg() != 1 {
+			log.Fatalf("usage: blockdag-node keys import [flags] <hex-key-file>")
+		}
+		data, err := os.ReadFile(flags.Arg(0))
+		if err != nil {
+			log.Fatalf("Failed to read key file: %v", err)
+		}
+		seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			log.Fatalf("Key file must contain a %d-byte hex private key", ed25519.SeedSize)
+		}
+		passphrase := readPassphrase(*passFile, "Passphrase for the imported key: ")
+		address, err := ks.ImportKey(ed25519.NewKeyFromSeed(seed), passphrase)
+		if err != nil {
+			log.Fatalf("Failed to import key: %v", err)
+		}
+		fmt.Println(address)
+
+	default:
+		log.Fatalf("unknown keys command: %s", args[0])
+	}
+}
+
+// readPassphrase reads the passphrase from passFile, or prompts for it on stdin
+func readPassphrase(passFile, prompt string) string {
+	if passFile != "" {
+		data, err := os.ReadFile(passFile)
+		if err != nil {
+			log.Fatalf("Failed to read passphrase file: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatalf("Failed to read passphrase: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
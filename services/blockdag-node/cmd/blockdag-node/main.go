@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"hackodisha/blockdag-node/internal/chaincfg"
 	"hackodisha/blockdag-node/internal/consensus"
 	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/index"
+	"hackodisha/blockdag-node/internal/ledger"
 	"hackodisha/blockdag-node/internal/mempool"
 	"hackodisha/blockdag-node/internal/miner"
 	"hackodisha/blockdag-node/internal/p2p"
@@ -19,8 +25,73 @@ import (
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reindex":
+			runReindex(os.Args[2:])
+			return
+		case "keys":
+			runKeys(os.Args[2:])
+			return
+		case "tx":
+			runTx(os.Args[2:])
+			return
+		case "openrpc":
+			runOpenRPC(os.Args[2:])
+			return
+		}
+	}
+
+	runNode(os.Args[1:])
+}
+
+// runNode starts the full node and blocks until it is interrupted
+func runNode(args []string) {
+	flags := flag.NewFlagSet("blockdag-node", flag.ExitOnError)
+	dataDir := flags.String("datadir", "./data/blockdag", "directory for the node database")
+	addrIndexEnabled := flags.Bool("addrindex", false, "maintain an address index for per-account history")
+	mine := flags.Bool("mine", true, "start mining at startup (ignored with -automine)")
+	network := flags.String("network", chaincfg.MainNetParams.Name, "network whose consensus rules to follow: mainnet, testnet or devnet")
+	devnet := flags.Bool("devnet", false, "shorthand for -network devnet, where mined vertices need no proof of work")
+	automine := flags.String("automine", "", "mine on demand: \"tx\" for a vertex per transaction, or an interval such as 5s")
+	minerThreads := flags.Int("minerthreads", 0, "nonce search goroutines, at most 4 per CPU (0 for one per CPU)")
+	miningAddress := flags.String("miningaddr", "", "address credited with the rewards of mined vertices")
+	templateConfig := miner.DefaultTemplateConfig()
+	flags.IntVar(&templateConfig.MaxVertexSize, "maxvertexsize", templateConfig.MaxVertexSize, "maximum transaction payload per mined vertex, in bytes, up to the consensus limit")
+	flags.IntVar(&templateConfig.MaxParents, "maxparents", templateConfig.MaxParents, "maximum parents per mined vertex")
+	p2pListen := flags.String("listen", "0.0.0.0:4001", "address to accept P2P connections on")
+	rpcListen := flags.String("rpclisten", ":8080", "address to serve RPC on")
+	rpcOrigins := flags.String("rpcorigins", "", "comma-separated browser origins besides the node's own allowed to call the RPC, or * for any")
+	connect := flags.String("connect", "", "comma-separated peer addresses to stay connected to")
+	bootstrap := flags.String("bootstrap", "", "comma-separated peer addresses to discover the network from")
+	maxOutbound := flags.Int("maxoutbound", p2p.DefaultTargetOutbound, "number of outbound peers to keep")
+	requireEncryption := flags.Bool("requireencryption", true, "refuse peers that do not encrypt their connection; false also accepts older plaintext nodes")
+	limits := p2p.DefaultLimits()
+	flags.IntVar(&limits.MaxInbound, "maxinbound", limits.MaxInbound, "maximum inbound peer connections (0 for no limit)")
+	flags.IntVar(&limits.MaxPerSubnet, "maxpersubnet", limits.MaxPerSubnet, "maximum peer connections from one /16 subnet (0 for no limit)")
+	flags.Float64Var(&limits.PeerMessageRate, "peermsgrate", limits.PeerMessageRate, "messages per second read from one peer (0 for no limit)")
+	flags.Float64Var(&limits.PeerByteRate, "peerbandwidth", limits.PeerByteRate, "bytes per second read from one peer (0 for no limit)")
+	flags.Float64Var(&limits.TotalByteRate, "bandwidth", limits.TotalByteRate, "bytes per second sent and received over all peers (0 for no limit)")
+	flags.Parse(args)
+
+	if *devnet {
+		*network = chaincfg.DevNetParams.Name
+	}
+	params, err := chaincfg.ByName(*network)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *minerThreads < 0 || *minerThreads > miner.MaxThreads() {
+		log.Fatalf("-minerthreads must be between 0 and %d", miner.MaxThreads())
+	}
+	if templateConfig.MaxVertexSize < 1 || templateConfig.MaxVertexSize > chaincfg.MaxPayloadSize {
+		log.Fatalf("-maxvertexsize must be between 1 and %d", chaincfg.MaxPayloadSize)
+	}
+	log.Printf("Using %s network rules (%s proof of work)", params.Name, params.PowAlgorithm.Name())
+
 	// Initialize storage
-	db, err := storage.NewBadgerDB("./data/blockdag")
+	db, err := storage.NewBadgerDB(*dataDir)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
@@ -29,23 +100,104 @@ func main() {
 	// Initialize DAG store
 	dagStore := dag.NewStore(db)
 
+	// Every network starts from its fixed genesis vertex
+	genesis := params.Genesis()
+	if !dagStore.HasVertex(genesis.ID) {
+		if err := dagStore.AddVertex(genesis); err != nil {
+			log.Fatalf("Failed to add genesis vertex: %v", err)
+		}
+	}
+
 	// Initialize consensus engine
-	consensusEngine := consensus.NewEngine(dagStore)
+	consensusEngine := consensus.NewEngine(dagStore, params)
+
+	// Rebuild the account state from the stored DAG in GHOSTDAG order and
+	// keep it current as the selected chain moves
+	state := ledger.NewState()
+	stateTracker := consensus.NewStateTracker(consensusEngine, dagStore, state)
+	stateTracker.OnRejected(func(vertex *dag.Vertex, count int) {
+		log.Printf("Skipped %d invalid transactions in vertex %s", count, vertex.ID)
+	})
+
+	// Initialize address index; it follows the transactions the state
+	// applies and catches up as the state is loaded
+	var addrIndex *index.AddrIndex
+	if *addrIndexEnabled {
+		addrIndex = index.NewAddrIndex(db)
+		stateTracker.OnApplied(func(vertex *dag.Vertex, txs []*ledger.Transaction) {
+			if err := addrIndex.IndexVertex(vertex, txs); err != nil {
+				log.Printf("Address index error: %v", err)
+			}
+		})
+		stateTracker.OnReverted(func(vertexID string) {
+			if err := addrIndex.RemoveVertex(vertexID); err != nil {
+				log.Printf("Address index error: %v", err)
+			}
+		})
+	}
+	if err := stateTracker.Update(); err != nil {
+		log.Fatalf("Failed to load DAG: %v", err)
+	}
+	dagStore.OnVertexAdded(func(vertex *dag.Vertex) {
+		if err := stateTracker.Update(); err != nil {
+			log.Printf("State update error: %v", err)
+		}
+	})
 
 	// Initialize mempool
-	mempool := mempool.NewMempool(10000) // 10k tx capacity
+	txPool := mempool.NewMempool(10000) // 10k tx capacity
+
+	// Initialize fee estimator over the last 100 accepted vertices
+	feeEstimator := mempool.NewFeeEstimator(txPool, 100)
+	dagStore.OnVertexAdded(func(vertex *dag.Vertex) {
+		feeEstimator.RecordPayload(vertex.Data)
+		txPool.RemovePayload(vertex.Data)
+	})
 
 	// Initialize miner
-	miner := miner.NewMiner(dagStore, consensusEngine, mempool)
+	templates := miner.NewTemplateBuilder(dagStore, consensusEngine, txPool, state, templateConfig)
+	blockMiner := miner.NewMiner(dagStore, consensusEngine, txPool, templates, params, *minerThreads)
+	if *miningAddress != "" {
+		if err := blockMiner.SetMiningAddress(*miningAddress); err != nil {
+			log.Fatalf("Invalid mining address: %v", err)
+		}
+	}
+
+	// Initialize auto miner
+	var autoMiner *miner.AutoMiner
+	if *automine != "" {
+		var interval time.Duration
+		if *automine != "tx" {
+			interval, err = time.ParseDuration(*automine)
+			if err != nil || interval <= 0 {
+				log.Fatalf("Invalid -automine value %q: use \"tx\" or a positive interval", *automine)
+			}
+		}
+		autoMiner = miner.NewAutoMiner(blockMiner, txPool, interval)
+	}
 
 	// Initialize P2P network
-	p2pNode, err := p2p.NewNode("0.0.0.0:4001")
+	identity, err := p2p.LoadOrCreateIdentity(filepath.Join(*dataDir, "nodekey"))
+	if err != nil {
+		log.Fatalf("Failed to load node identity: %v", err)
+	}
+	log.Printf("Node ID %s", identity.ID)
+	addrBook := p2p.NewAddressBook(filepath.Join(*dataDir, "peers.json"))
+	banList := p2p.NewBanList(filepath.Join(*dataDir, "banlist.json"))
+	p2pNode, err := p2p.NewNode(*p2pListen, params, identity, dagStore, consensusEngine, txPool, state, addrBook, banList)
 	if err != nil {
 		log.Fatalf("Failed to initialize P2P node: %v", err)
 	}
+	p2pNode.SetRequireEncryption(*requireEncryption)
+	// Outbound connections are the target plus the persistent peers
+	limits.MaxOutbound = *maxOutbound + len(splitAddresses(*connect))
+	p2pNode.SetLimits(limits)
+	blockMiner.SetSyncCheck(p2pNode.IsSynced)
+	connManager := p2p.NewConnManager(p2pNode, addrBook, *maxOutbound, splitAddresses(*bootstrap), splitAddresses(*connect))
 
 	// Initialize RPC server
-	rpcServer := rpc.NewServer(dagStore, consensusEngine, mempool, miner, p2pNode)
+	rpcServer := rpc.NewServer(dagStore, consensusEngine, txPool, blockMiner, p2pNode, addrIndex, feeEstimator, state)
+	rpcServer.SetAllowedOrigins(splitAddresses(*rpcOrigins))
 
 	// Start services
 	ctx, cancel := context.WithCancel(context.Background())
@@ -55,20 +207,24 @@ func main() {
 	go func() {
 		if err := p2pNode.Start(ctx); err != nil {
 			log.Printf("P2P node error: %v", err)
+			return
 		}
+		connManager.Start(ctx)
 	}()
 
-	// Start miner
-	go func() {
-		if err := miner.Start(ctx); err != nil {
+	// Start miner; it can also be started and stopped over RPC
+	if autoMiner != nil {
+		go autoMiner.Start(ctx)
+	} else if *mine {
+		if err := blockMiner.Start(*minerThreads); err != nil {
 			log.Printf("Miner error: %v", err)
 		}
-	}()
+	}
 
 	// Start RPC server
 	go func() {
-		log.Println("Starting RPC server on :8080")
-		if err := rpcServer.Start(":8080"); err != nil && err != http.ErrServerClosed {
+		log.Printf("Starting RPC server on %s", *rpcListen)
+		if err := rpcServer.Start(*rpcListen); err != nil && err != http.ErrServerClosed {
 			log.Printf("RPC server error: %v", err)
 		}
 	}()
@@ -80,6 +236,10 @@ func main() {
 
 	log.Println("Shutting down...")
 	cancel()
+	blockMiner.Stop()
+	if err := addrBook.Save(); err != nil {
+		log.Printf("%v", err)
+	}
 
 	// Graceful shutdown
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -91,3 +251,14 @@ func main() {
 
 	log.Println("BlockDAG node stopped")
 }
+
+// splitAddresses parses a comma-separated list of peer addresses or origins
+func splitAddresses(list string) []string {
+	addresses := make([]string, 0)
+	for _, address := range strings.Split(list, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"hackodisha/blockdag-node/internal/rpc"
+)
+
+// runOpenRPC prints the OpenRPC document describing the node's RPC
+// methods, the same one rpc.discover serves
+func runOpenRPC(args []string) {
+	flags := flag.NewFlagSet("openrpc", flag.ExitOnError)
+	flags.Parse(args)
+
+	document, err := rpc.OpenRPC()
+	if err != nil {
+		log.Fatalf("Failed to describe the RPC methods: %v", err)
+	}
+	os.Stdout.Write(append(document, '\n'))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/index"
+	"hackodisha/blockdag-node/storage"
+)
+
+// runReindex rebuilds the address index from the stored DAG
+func runReindex(args []string) {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	dataDir := flags.String("datadir", "./data/blockdag", "directory for the node database")
+	network := flags.String("network", chaincfg.MainNetParams.Name, "network the database belongs to: mainnet, testnet or devnet")
+	devnet := flags.Bool("devnet", false, "shorthand for -network devnet")
+	flags.Parse(args)
+
+	if *devnet {
+		*network = chaincfg.DevNetParams.Name
+	}
+
+	params, err := chaincfg.ByName(*network)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	db, err := storage.NewBadgerDB(*dataDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer db.Close()
+
+	dagStore := dag.NewStore(db)
+	addrIndex := index.NewAddrIndex(db)
+
+	log.Println("Rebuilding address index...")
+	count, err := addrIndex.Reindex(consensus.NewEngine(dagStore, params), dagStore)
+	if err != nil {
+		log.Fatalf("Reindex failed: %v", err)
+	}
+
+	log.Printf("Indexed %d vertices", count)
+}
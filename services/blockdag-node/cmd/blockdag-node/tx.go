@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"hackodisha/blockdag-node/internal/keystore"
+	"hackodisha/blockdag-node/internal/ledger"
+)
+
+// runTx builds and submits transactions
+func runTx(args []string) {
+	if len(args) == 0 || args[0] != "send" {
+		log.Fatalf("usage: blockdag-node tx send [flags]")
+	}
+
+	flags := flag.NewFlagSet("tx send", flag.ExitOnError)
+	keystoreDir := flags.String("keystore", "./data/keystore", "directory holding encrypted keys")
+	passFile := flags.String("passfile", "", "file containing the passphrase (prompted for if empty)")
+	rpcURL := flags.String("rpc", "http://localhost:8080/rpc", "JSON-RPC endpoint of the node")
+	from := flags.String("from", "", "sender address (must be in the keystore)")
+	to := flags.String("to", "", "recipient address")
+	amount := flags.Uint64("amount", 0, "amount to transfer")
+	fee := flags.Uint64("fee", 0, "fee to pay (estimated from the node if zero)")
+	nonce := flags.Int64("nonce", -1, "sender nonce (fetched from the node if negative)")
+	flags.Parse(args[1:])
+
+	if *from == "" || *to == "" {
+		log.Fatalf("-from and -to are required")
+	}
+
+	ks, err := keystore.New(*keystoreDir, keystore.StandardScryptN)
+	if err != nil {
+		log.Fatalf("Failed to open keystore: %v", err)
+	}
+	passphrase := readPassphrase(*passFile, "Passphrase: ")
+	privateKey, err := ks.Unlock(*from, passphrase)
+	if err != nil {
+		log.Fatalf("Failed to unlock key: %v", err)
+	}
+
+	client := &rpcClient{url: *rpcURL, http: &http.Client{Timeout: 10 * time.Second}}
+
+	tx := &ledger.Transaction{
+		Type:   ledger.TypeTransfer,
+		From:   *from,
+		To:     *to,
+		Amount: *amount,
+		Fee:    *fee,
+	}
+
+	if *nonce >= 0 {
+		tx.Nonce = uint64(*nonce)
+	} else {
+		var account struct {
+			Nonce uint64 `json:"nonce"`
+		}
+		if err := client.call("blockdag_getBalance", map[string]interface{}{"address": *from}, &account); err != nil {
+			log.Fatalf("Failed to fetch nonce: %v", err)
+		}
+		tx.Nonce = account.Nonce
+	}
+
+	if tx.Fee == 0 {
+		var estimate struct {
+			Medium float64 `json:"medium"`
+		}
+		if err := client.call("blockdag_estimateFee", map[string]interface{}{"targetConfirmations": 1}, &estimate); err != nil {
+			log.Fatalf("Failed to estimate fee: %v", err)
+		}
+		tx.Fee = estimateFee(tx, privateKey, estimate.Medium)
+	}
+
+	if err := tx.Sign(privateKey); err != nil {
+		log.Fatalf("Failed to sign transaction: %v", err)
+	}
+	encoded, err := tx.Encode()
+	if err != nil {
+		log.Fatalf("Failed to encode transaction: %v", err)
+	}
+
+	var result struct {
+		TxID string `json:"txid"`
+	}
+	if err := client.call("blockdag_submitTransaction", map[string]interface{}{"data": string(encoded)}, &result); err != nil {
+		log.Fatalf("Failed to submit transaction: %v", err)
+	}
+
+	fmt.Println(result.TxID)
+}
+
+// estimateFee returns the fee for tx at feeRate, sizing the signed transaction.
+// The fee is part of the encoding, so it is recomputed until the size settles.
+func estimateFee(tx *ledger.Transaction, privateKey ed25519.PrivateKey, feeRate float64) uint64 {
+	sized := *tx
+	for i := 0; i < 4; i++ {
+		if err := sized.Sign(privateKey); err != nil {
+			break
+		}
+		encoded, err := sized.Encode()
+		if err != nil {
+			break
+		}
+		fee := uint64(math.Ceil(feeRate * float64(len(encoded))))
+		if fee == sized.Fee {
+			break
+		}
+		sized.Fee = fee
+	}
+	return sized.Fee
+}
+
+// rpcClient is a minimal JSON-RPC client for the node
+type rpcClient struct {
+	url  string
+	http *http.Client
+}
+
+// call invokes method with params and decodes the result into result
+func (c *rpcClient) call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int         `json:"code"`
+			Message string      `json:"message"`
+			Data    interface{} `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	if response.Error != nil {
+		if response.Error.Data != nil {
+			return fmt.Errorf("%s: %v", response.Error.Message, response.Error.Data)
+		}
+		return fmt.Errorf("%s", response.Error.Message)
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
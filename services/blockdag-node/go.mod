@@ -2,7 +2,10 @@ module hackodisha/blockdag-node
 
 go 1.23.0
 
-require github.com/dgraph-io/badger/v4 v4.2.0
+require (
+	github.com/dgraph-io/badger/v4 v4.2.0
+	golang.org/x/crypto v0.36.0
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
@@ -0,0 +1,105 @@
+package chaincfg
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/internal/pow"
+)
+
+// MaxPayloadSize is the largest vertex payload consensus accepts, in bytes.
+// It leaves room for a vertex to be relayed in one P2P message once its
+// payload is base64 encoded.
+const MaxPayloadSize = 1 << 20
+
+// Params are the consensus rules that distinguish one network from another
+type Params struct {
+	Name         string
+	NetMagic     uint32 // starts every P2P frame so networks cannot mix
+	PowAlgorithm pow.Algorithm
+	TargetBits   uint      // leading zero bits a proof-of-work hash needs
+	GenesisTime  time.Time // timestamp of the network's root vertex
+}
+
+// MainNetParams are the rules of the main network
+var MainNetParams = Params{
+	Name:         "mainnet",
+	NetMagic:     0x42444147, // "BDAG"
+	PowAlgorithm: pow.SHA256D{},
+	TargetBits:   16,
+	GenesisTime:  time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+}
+
+// TestNetParams are the rules of the public test network, which uses the
+// memory-hard algorithm at a lower difficulty
+var TestNetParams = Params{
+	Name:         "testnet",
+	NetMagic:     0x42444154, // "BDAT"
+	PowAlgorithm: pow.NewScrypt(),
+	TargetBits:   8,
+	GenesisTime:  time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+}
+
+// DevNetParams are the rules of local development networks, where every
+// hash meets the target
+var DevNetParams = Params{
+	Name:         "devnet",
+	NetMagic:     0x42444144, // "BDAD"
+	PowAlgorithm: pow.SHA256D{},
+	TargetBits:   0,
+	GenesisTime:  time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+}
+
+// ByName returns the parameters of a named network
+func ByName(name string) (*Params, error) {
+	for _, params := range []*Params{&MainNetParams, &TestNetParams, &DevNetParams} {
+		if params.Name == name {
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown network %q", name)
+}
+
+// Target returns the proof-of-work target
+func (p *Params) Target() *big.Int {
+	return pow.TargetFromBits(p.TargetBits)
+}
+
+// VertexWeight is the weight every vertex declares: the work it adds to
+// the DAG, the expected hashes to meet the target, capped to a uint64.
+// Consensus rejects vertices that claim any other weight.
+func (p *Params) VertexWeight() uint64 {
+	work := p.PowAlgorithm.Work(p.Target())
+	if !work.IsUint64() {
+		return math.MaxUint64
+	}
+	return work.Uint64()
+}
+
+// Genesis returns the root vertex every node on the network starts from.
+// It is the same on every node, and is trusted rather than mined.
+func (p *Params) Genesis() *dag.Vertex {
+	payloadRoot, _ := ledger.PayloadRoot(nil)
+	genesis := &dag.Vertex{
+		ID:          p.Name + "-genesis",
+		PayloadRoot: payloadRoot,
+		Timestamp:   p.GenesisTime,
+		Weight:      p.VertexWeight(),
+	}
+	genesis.Hash = genesis.CalculateHash()
+	return genesis
+}
+
+// GenesisHash returns the hash of the genesis vertex
+func (p *Params) GenesisHash() string {
+	return p.Genesis().Hash
+}
+
+// RequiresPoW reports whether mining takes real work on this network
+func (p *Params) RequiresPoW() bool {
+	return p.TargetBits > 0
+}
@@ -0,0 +1,26 @@
+package clock
+
+import "time"
+
+// Clock tells the time and waits for it to pass. Nodes read the system
+// clock; a simulation substitutes virtual time.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// System is the host's clock
+var System Clock = systemClock{}
+
+// systemClock reads the time package
+type systemClock struct{}
+
+// Now returns the current host time
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After returns a channel that receives once d of host time has passed
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
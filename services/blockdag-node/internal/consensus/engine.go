@@ -2,47 +2,76 @@ package consensus
 
 import (
 	"fmt"
+	"math/big"
+	"sync"
+	"time"
 
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/clock"
 	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
 )
 
+// MaxTimeOffset is how far ahead of local time a vertex timestamp may be
+const MaxTimeOffset = 2 * time.Hour
+
+// FinalityDepth is how many vertices of the heaviest path must follow a
+// vertex for it to be finalized
+const FinalityDepth = 10
+
 // Engine implements BlockDAG consensus rules
 type Engine struct {
 	dagStore *dag.Store
+	params   *chaincfg.Params
+	mu       sync.Mutex
+	ghostdag map[string]*GhostdagData // cached coloring per vertex
+	clock    clock.Clock
+
+	// vertexWork is what every vertex adds to the blue work: the expected
+	// hashes to meet the network target, which is the same for all of them
+	vertexWork *big.Int
 }
 
 // NewEngine creates a new consensus engine
-func NewEngine(dagStore *dag.Store) *Engine {
+func NewEngine(dagStore *dag.Store, params *chaincfg.Params) *Engine {
 	return &Engine{
-		dagStore: dagStore,
+		dagStore:   dagStore,
+		params:     params,
+		ghostdag:   make(map[string]*GhostdagData),
+		clock:      clock.System,
+		vertexWork: params.PowAlgorithm.Work(params.Target()),
 	}
 }
 
-// GetHeaviestPath returns the heaviest path through the DAG
+// SetClock replaces the system clock that vertex timestamps are checked
+// against, for instance with a simulation's virtual one
+func (e *Engine) SetClock(clock clock.Clock) {
+	e.clock = clock
+}
+
+// GetHeaviestPath returns the selected chain from the tip with the most blue work
 func (e *Engine) GetHeaviestPath() ([]*dag.Vertex, error) {
 	tips := e.dagStore.GetTips()
 	if len(tips) == 0 {
 		return []*dag.Vertex{}, nil
 	}
 
-	// Find the tip with the heaviest path
-	var heaviestTip string
-	var maxWeight uint64
-
-	for _, tip := range tips {
-		weight := e.calculatePathWeight(tip)
-		if weight > maxWeight {
-			maxWeight = weight
-			heaviestTip = tip
-		}
+	// Find the tip with the most blue work
+	sorted, err := e.SortByBlueWork(tips)
+	if err != nil {
+		return nil, err
 	}
 
 	// Build the heaviest path
-	return e.buildPath(heaviestTip)
+	return e.buildPath(sorted[0])
 }
 
 // IsValidVertex validates a vertex according to consensus rules
 func (e *Engine) IsValidVertex(vertex *dag.Vertex) error {
+	if err := e.IsValidHeader(vertex.Header()); err != nil {
+		return err
+	}
+
 	// Check if parents exist
 	for _, parentID := range vertex.Parents {
 		parent, err := e.dagStore.GetVertex(parentID)
@@ -54,18 +83,74 @@ func (e *Engine) IsValidVertex(vertex *dag.Vertex) error {
 		}
 	}
 
+	if len(vertex.Data) > chaincfg.MaxPayloadSize {
+		return fmt.Errorf("payload of %d bytes exceeds the %d byte limit", len(vertex.Data), chaincfg.MaxPayloadSize)
+	}
+
+	// Check the payload root commits to the payload
+	payloadRoot, err := ledger.PayloadRoot(vertex.Data)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %v", err)
+	}
+	if vertex.PayloadRoot != payloadRoot {
+		return fmt.Errorf("invalid payload root: expected %s, got %s", payloadRoot, vertex.PayloadRoot)
+	}
+
+	return nil
+}
+
+// IsValidHeader checks the rules a header must meet on its own, without
+// its parents or payload
+func (e *Engine) IsValidHeader(header *dag.Header) error {
+	if header.ID == "" {
+		return fmt.Errorf("vertex has no ID")
+	}
+
+	// Only the genesis vertex has no parents, and it is never validated
+	if len(header.Parents) == 0 {
+		return fmt.Errorf("vertex %s has no parents", header.ID)
+	}
+
+	// Check the reward goes to a well-formed address
+	if header.Coinbase != "" {
+		if err := ledger.ValidateAddress(header.Coinbase); err != nil {
+			return fmt.Errorf("invalid coinbase: %v", err)
+		}
+	}
+
 	// Check hash validity
-	expectedHash := vertex.CalculateHash()
-	if vertex.Hash != expectedHash {
-		return fmt.Errorf("invalid hash: expected %s, got %s", expectedHash, vertex.Hash)
+	expectedHash := header.CalculateHash()
+	if header.Hash != expectedHash {
+		return fmt.Errorf("invalid hash: expected %s, got %s", expectedHash, header.Hash)
+	}
+
+	if err := e.CheckProofOfWork(header); err != nil {
+		return err
+	}
+
+	// The weight is not hashed, so a relaying peer could inflate it
+	if header.Weight != e.params.VertexWeight() {
+		return fmt.Errorf("invalid weight: expected %d, got %d", e.params.VertexWeight(), header.Weight)
 	}
 
 	// Check timestamp (not too far in future)
-	// This is a simplified check - in production you'd want more sophisticated validation
+	if header.Timestamp.After(e.clock.Now().Add(MaxTimeOffset)) {
+		return fmt.Errorf("timestamp %s is too far in the future", header.Timestamp.UTC().Format(time.RFC3339))
+	}
 
 	return nil
 }
 
+// CheckProofOfWork checks the header's proof-of-work hash against the
+// network target
+func (e *Engine) CheckProofOfWork(header *dag.Header) error {
+	algorithm := e.params.PowAlgorithm
+	if !algorithm.CheckTarget(algorithm.Hash(header), e.params.Target()) {
+		return fmt.Errorf("insufficient proof of work for %s", header.ID)
+	}
+	return nil
+}
+
 // GetFinalizedVertices returns vertices that are considered finalized
 func (e *Engine) GetFinalizedVertices() ([]*dag.Vertex, error) {
 	// In a real implementation, this would use k-cluster finality or similar
@@ -75,10 +160,10 @@ func (e *Engine) GetFinalizedVertices() ([]*dag.Vertex, error) {
 		return nil, err
 	}
 
-	// Finalize vertices that are more than 10 blocks deep
+	// Finalize vertices that are more than FinalityDepth blocks deep
 	finalized := make([]*dag.Vertex, 0)
-	if len(heaviestPath) > 10 {
-		for i := 0; i < len(heaviestPath)-10; i++ {
+	if len(heaviestPath) > FinalityDepth {
+		for i := 0; i < len(heaviestPath)-FinalityDepth; i++ {
 			finalized = append(finalized, heaviestPath[i])
 		}
 	}
@@ -86,22 +171,55 @@ func (e *Engine) GetFinalizedVertices() ([]*dag.Vertex, error) {
 	return finalized, nil
 }
 
-// calculatePathWeight calculates the total weight of a path ending at the given vertex
-func (e *Engine) calculatePathWeight(vertexID string) uint64 {
-	vertex, err := e.dagStore.GetVertex(vertexID)
-	if err != nil || vertex == nil {
-		return 0
+// SelectedParent returns the parent of the vertex with the most blue work
+func (e *Engine) SelectedParent(vertex *dag.Vertex) string {
+	data, err := e.GetGhostdagData(vertex.ID)
+	if err != nil {
+		return ""
 	}
+	return data.SelectedParent
+}
 
-	// Base weight of this vertex
-	totalWeight := vertex.Weight
+// GetLatestFinalized returns the most recent finalized vertex, or nil if none is
+func (e *Engine) GetLatestFinalized() (*dag.Vertex, error) {
+	finalized, err := e.GetFinalizedVertices()
+	if err != nil {
+		return nil, err
+	}
+	if len(finalized) == 0 {
+		return nil, nil
+	}
+	return finalized[len(finalized)-1], nil
+}
 
-	// Add weights from all parents
-	for _, parentID := range vertex.Parents {
-		totalWeight += e.calculatePathWeight(parentID)
+// PathToAncestor returns the headers from fromID down to a child of
+// ancestorID along the selected chain: each header's selected parent is
+// the next one, and the last references ancestorID as a parent. It returns
+// an error if ancestorID is not reached that way.
+func (e *Engine) PathToAncestor(fromID, ancestorID string) ([]*dag.Header, error) {
+	if fromID == ancestorID {
+		return []*dag.Header{}, nil
+	}
+
+	path := make([]*dag.Header, 0)
+	for id := fromID; id != ""; {
+		vertex, err := e.dagStore.GetVertex(id)
+		if err != nil {
+			return nil, err
+		}
+		data, err := e.GetGhostdagData(id)
+		if err != nil {
+			return nil, err
+		}
+		header := vertex.Header()
+		path = append(path, header)
+		if header.HasParent(ancestorID) {
+			return path, nil
+		}
+		id = data.SelectedParent
 	}
 
-	return totalWeight
+	return nil, fmt.Errorf("vertex %s is not on the selected chain of %s", ancestorID, fromID)
 }
 
 // buildPath builds a path from the given vertex to genesis
@@ -123,21 +241,9 @@ func (e *Engine) buildPath(vertexID string) ([]*dag.Vertex, error) {
 		visited[id] = true
 		path = append(path, vertex)
 
-		// If this vertex has parents, continue building the path
+		// If this vertex has parents, continue along the selected parent
 		if len(vertex.Parents) > 0 {
-			// Choose the parent with the heaviest path
-			var heaviestParent string
-			var maxWeight uint64
-
-			for _, parentID := range vertex.Parents {
-				weight := e.calculatePathWeight(parentID)
-				if weight > maxWeight {
-					maxWeight = weight
-					heaviestParent = parentID
-				}
-			}
-
-			return buildPathRecursive(heaviestParent)
+			return buildPathRecursive(e.SelectedParent(vertex))
 		}
 
 		return nil
@@ -0,0 +1,43 @@
+package consensus
+
+import (
+	"bytes"
+	"testing"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+)
+
+func TestIsValidVertexPayloadLimit(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.params.Genesis()
+
+	// vertexWith builds a vertex on genesis whose payload is one entry of n bytes
+	vertexWith := func(n int) *dag.Vertex {
+		data := ledger.EncodePayload([][]byte{bytes.Repeat([]byte{'x'}, n)})
+		root, err := ledger.PayloadRoot(data)
+		if err != nil {
+			t.Fatalf("PayloadRoot: %v", err)
+		}
+		vertex := &dag.Vertex{
+			ID:          "v",
+			Data:        data,
+			PayloadRoot: root,
+			Parents:     []string{genesis.ID},
+			Timestamp:   genesis.Timestamp,
+			Weight:      c.params.VertexWeight(),
+		}
+		vertex.Hash = vertex.CalculateHash()
+		return vertex
+	}
+
+	// The length prefix of an entry this size takes three bytes
+	const prefix = 3
+	if err := c.engine.IsValidVertex(vertexWith(chaincfg.MaxPayloadSize - prefix)); err != nil {
+		t.Errorf("rejected a payload at the limit: %v", err)
+	}
+	if err := c.engine.IsValidVertex(vertexWith(chaincfg.MaxPayloadSize - prefix + 1)); err == nil {
+		t.Error("accepted a payload over the limit")
+	}
+}
@@ -0,0 +1,231 @@
+package consensus
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// GhostdagK is the largest anticone a blue vertex may have among the blues
+const GhostdagK = 18
+
+// GhostdagData is the GHOSTDAG coloring of a vertex's past
+type GhostdagData struct {
+	SelectedParent string   `json:"selected_parent"`
+	BlueScore      uint64   `json:"blue_score"` // blue vertices in the past
+	BlueWork       *big.Int `json:"blue_work"`  // work of the blue vertices in the past
+	MergeSetBlues  []string `json:"mergeset_blues"`
+	MergeSetReds   []string `json:"mergeset_reds"`
+
+	parents []string
+	work    *big.Int // the vertex's own work; shared, never modified
+}
+
+// GetGhostdagData returns the GHOSTDAG data of a stored vertex
+func (e *Engine) GetGhostdagData(vertexID string) (*GhostdagData, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.ghostdagData(vertexID)
+}
+
+// SortByBlueWork orders vertex IDs by descending blue work, heaviest first
+func (e *Engine) SortByBlueWork(ids []string) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sorted := append([]string(nil), ids...)
+	for _, id := range sorted {
+		if _, err := e.ghostdagData(id); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return e.heavier(sorted[i], sorted[j])
+	})
+	return sorted, nil
+}
+
+// ghostdagData returns the cached data of a vertex, computing it and its
+// ancestors' on first use; the caller holds the lock
+func (e *Engine) ghostdagData(vertexID string) (*GhostdagData, error) {
+	if data, exists := e.ghostdag[vertexID]; exists {
+		return data, nil
+	}
+
+	vertex, err := e.dagStore.GetVertex(vertexID)
+	if err != nil {
+		return nil, fmt.Errorf("vertex %s not found", vertexID)
+	}
+
+	for _, parentID := range vertex.Parents {
+		if _, err := e.ghostdagData(parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := e.computeGhostdag(vertex.Parents)
+	if err != nil {
+		return nil, err
+	}
+	data.parents = vertex.Parents
+	data.work = e.vertexWork
+
+	e.ghostdag[vertexID] = data
+	return data, nil
+}
+
+// computeGhostdag colors the past of a vertex with the given parents. The
+// heaviest parent is selected; the rest of the past it does not cover is
+// the mergeset, whose members are blue while their anticone holds at most
+// GhostdagK blues.
+func (e *Engine) computeGhostdag(parents []string) (*GhostdagData, error) {
+	data := &GhostdagData{
+		BlueWork:      new(big.Int),
+		MergeSetBlues: make([]string, 0),
+		MergeSetReds:  make([]string, 0),
+	}
+	if len(parents) == 0 {
+		return data, nil
+	}
+
+	selectedParent := parents[0]
+	for _, parentID := range parents[1:] {
+		if e.heavier(parentID, selectedParent) {
+			selectedParent = parentID
+		}
+	}
+	data.SelectedParent = selectedParent
+
+	mergeSet := e.mergeSet(selectedParent, parents)
+
+	// Color ancestors before descendants
+	sort.Slice(mergeSet, func(i, j int) bool {
+		return e.heavier(mergeSet[j], mergeSet[i])
+	})
+
+	data.MergeSetBlues = append(data.MergeSetBlues, selectedParent)
+	for _, candidate := range mergeSet {
+		if e.blueAnticoneSize(candidate, selectedParent, data.MergeSetBlues[1:]) <= GhostdagK {
+			data.MergeSetBlues = append(data.MergeSetBlues, candidate)
+		} else {
+			data.MergeSetReds = append(data.MergeSetReds, candidate)
+		}
+	}
+
+	parentData := e.ghostdag[selectedParent]
+	data.BlueScore = parentData.BlueScore + uint64(len(data.MergeSetBlues))
+	data.BlueWork.Set(parentData.BlueWork)
+	for _, blue := range data.MergeSetBlues {
+		data.BlueWork.Add(data.BlueWork, e.ghostdag[blue].work)
+	}
+
+	return data, nil
+}
+
+// mergeSet returns the past of parents not covered by the selected parent
+func (e *Engine) mergeSet(selectedParent string, parents []string) []string {
+	mergeSet := make([]string, 0)
+	seen := map[string]bool{selectedParent: true}
+
+	queue := make([]string, 0, len(parents))
+	for _, parentID := range parents {
+		if parentID != selectedParent {
+			queue = append(queue, parentID)
+		}
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+
+		if e.isAncestorOf(current, selectedParent) {
+			continue
+		}
+
+		mergeSet = append(mergeSet, current)
+		queue = append(queue, e.ghostdag[current].parents...)
+	}
+
+	return mergeSet
+}
+
+// blueAnticoneSize counts the blues in the anticone of candidate: the
+// chosen mergeset blues and the blues along the selected chain from
+// selectedParent down to the first chain vertex in candidate's past
+func (e *Engine) blueAnticoneSize(candidate, selectedParent string, chosen []string) int {
+	size := 0
+	for _, blue := range chosen {
+		if e.inAnticone(blue, candidate) {
+			size++
+		}
+	}
+
+	for chain := selectedParent; chain != "" && size <= GhostdagK; {
+		if e.isAncestorOf(chain, candidate) {
+			break
+		}
+
+		size++ // the chain vertex itself is neither ancestor nor descendant
+		chainData := e.ghostdag[chain]
+		for _, blue := range chainData.MergeSetBlues {
+			if blue != chainData.SelectedParent && e.inAnticone(blue, candidate) {
+				size++
+			}
+		}
+		chain = chainData.SelectedParent
+	}
+
+	return size
+}
+
+// inAnticone reports whether neither vertex is in the other's past
+func (e *Engine) inAnticone(a, b string) bool {
+	return !e.isAncestorOf(a, b) && !e.isAncestorOf(b, a)
+}
+
+// isAncestorOf reports whether ancestor is descendant or in its past. Blue
+// work strictly grows along every parent edge, so the search never needs
+// to go below the ancestor's blue work.
+func (e *Engine) isAncestorOf(ancestor, descendant string) bool {
+	if ancestor == descendant {
+		return true
+	}
+
+	floor := e.ghostdag[ancestor].BlueWork
+	visited := make(map[string]bool)
+	stack := []string{descendant}
+
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, parentID := range e.ghostdag[current].parents {
+			if parentID == ancestor {
+				return true
+			}
+			if visited[parentID] || e.ghostdag[parentID].BlueWork.Cmp(floor) <= 0 {
+				continue
+			}
+			visited[parentID] = true
+			stack = append(stack, parentID)
+		}
+	}
+
+	return false
+}
+
+// heavier orders vertices by blue work, breaking ties by the smaller ID
+func (e *Engine) heavier(a, b string) bool {
+	workA := new(big.Int).Add(e.ghostdag[a].BlueWork, e.ghostdag[a].work)
+	workB := new(big.Int).Add(e.ghostdag[b].BlueWork, e.ghostdag[b].work)
+	if cmp := workA.Cmp(workB); cmp != 0 {
+		return cmp > 0
+	}
+	return a < b
+}
@@ -0,0 +1,84 @@
+package consensus
+
+import (
+	"fmt"
+	"testing"
+)
+
+// addParallel adds n vertices named prefix00.. on parent and returns them
+func (c *testChain) addParallel(prefix, parent string, n int) []string {
+	c.t.Helper()
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%s%02d", prefix, i)
+		c.add(ids[i], "0xa", []string{parent})
+	}
+	return ids
+}
+
+func TestGhostdagColorsAtMostKInTheAnticone(t *testing.T) {
+	tests := []struct {
+		name     string
+		parallel int
+		blues    int
+	}{
+		{"K+1 parallel vertices are all blue", GhostdagK + 1, GhostdagK + 1},
+		{"K+2 parallel vertices leave one red", GhostdagK + 2, GhostdagK + 1},
+		{"K+4 parallel vertices leave three red", GhostdagK + 4, GhostdagK + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChain(t)
+			genesis := c.params.Genesis().ID
+			parents := c.addParallel("p", genesis, tt.parallel)
+			c.add("merge", "0xa", parents)
+
+			data, err := c.engine.GetGhostdagData("merge")
+			if err != nil {
+				t.Fatalf("GetGhostdagData: %v", err)
+			}
+
+			// Equal work falls to the smaller ID, so p00 is selected and
+			// the mergeset is colored from the largest ID down
+			if data.SelectedParent != parents[0] || data.MergeSetBlues[0] != parents[0] {
+				t.Errorf("selected parent %s, blues start %v, want %s", data.SelectedParent, data.MergeSetBlues, parents[0])
+			}
+			if len(data.MergeSetBlues) != tt.blues || len(data.MergeSetReds) != tt.parallel-tt.blues {
+				t.Fatalf("%d blues and %d reds, want %d and %d", len(data.MergeSetBlues), len(data.MergeSetReds), tt.blues, tt.parallel-tt.blues)
+			}
+			for i, red := range data.MergeSetReds {
+				if want := parents[len(data.MergeSetReds)-i]; red != want {
+					t.Errorf("red %d is %s, want %s", i, red, want)
+				}
+			}
+			if want := uint64(1 + tt.blues); data.BlueScore != want {
+				t.Errorf("blue score %d, want %d", data.BlueScore, want)
+			}
+		})
+	}
+}
+
+func TestGhostdagColorsAncestorsFirst(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.params.Genesis().ID
+
+	// The selected chain is a1..a3; side chain s1, s2 is merged as a whole
+	tipA := c.extend("a", "0xa", genesis, 3)
+	tipS := c.extend("s", "0xb", genesis, 2)
+	c.add("merge", "0xa", []string{tipS, tipA})
+
+	data, err := c.engine.GetGhostdagData("merge")
+	if err != nil {
+		t.Fatalf("GetGhostdagData: %v", err)
+	}
+	if data.SelectedParent != tipA {
+		t.Errorf("selected parent %s, want %s", data.SelectedParent, tipA)
+	}
+	if want := []string{tipA, "s1", "s2"}; fmt.Sprint(data.MergeSetBlues) != fmt.Sprint(want) || len(data.MergeSetReds) != 0 {
+		t.Errorf("blues %v and reds %v, want blues %v", data.MergeSetBlues, data.MergeSetReds, want)
+	}
+	if data.BlueScore != 6 {
+		t.Errorf("blue score %d, want 6", data.BlueScore)
+	}
+}
@@ -0,0 +1,266 @@
+package consensus
+
+import (
+	"fmt"
+	"sync"
+
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+)
+
+// StateTracker keeps the account state equal to the payloads of the
+// heaviest tip's past applied in GHOSTDAG order: along the selected chain
+// from genesis, each chain vertex after its mergeset, ancestors first.
+// Vertices outside that past are applied once a chain vertex merges them.
+type StateTracker struct {
+	engine   *Engine
+	dagStore *dag.Store
+	state    *ledger.State
+	mu       sync.Mutex
+	chain    []string                 // applied selected chain, genesis first
+	onChain  map[string]int           // position of each chain vertex
+	undo     [][]*ledger.VertexResult // per chain vertex, what applying it did; nil below undoDepth
+	rejected func(vertex *dag.Vertex, count int)
+	applied  func(vertex *dag.Vertex, txs []*ledger.Transaction)
+	reverted func(vertexID string)
+}
+
+// undoDepth is how many chain vertices below the tip keep their undo data.
+// A change of the selected chain deeper than that rebuilds the state.
+const undoDepth = 1000
+
+// NewStateTracker creates a tracker that maintains state; Update applies
+// the stored DAG
+func NewStateTracker(engine *Engine, dagStore *dag.Store, state *ledger.State) *StateTracker {
+	return &StateTracker{
+		engine:   engine,
+		dagStore: dagStore,
+		state:    state,
+		onChain:  make(map[string]int),
+	}
+}
+
+// OnRejected registers a handler told how many transactions of a vertex
+// were skipped as invalid when it was applied
+func (t *StateTracker) OnRejected(handler func(vertex *dag.Vertex, count int)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rejected = handler
+}
+
+// OnApplied registers a handler given the transactions the state applied
+// from each vertex, in the order the vertices are applied
+func (t *StateTracker) OnApplied(handler func(vertex *dag.Vertex, txs []*ledger.Transaction)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.applied = handler
+}
+
+// OnReverted registers a handler told of each vertex taken back out of
+// the state when the selected chain changes, in the reverse of the order
+// the vertices were applied
+func (t *StateTracker) OnReverted(handler func(vertexID string)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.reverted = handler
+}
+
+// Update follows the selected chain of the heaviest tip. The applied chain
+// is rolled back to where the new one leaves it and the new vertices are
+// applied in place. Past undoDepth, the state up to that point is rebuilt
+// from genesis and swapped in instead.
+func (t *StateTracker) Update() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tips := t.dagStore.GetTips()
+	if len(tips) == 0 {
+		return nil
+	}
+	sorted, err := t.engine.SortByBlueWork(tips)
+	if err != nil {
+		return err
+	}
+	head := sorted[0]
+	if len(t.chain) > 0 && t.chain[len(t.chain)-1] == head {
+		return nil
+	}
+
+	// Walk back to the applied chain, or to genesis
+	added := make([]string, 0)
+	fork := -1
+	for id := head; id != ""; {
+		if position, exists := t.onChain[id]; exists {
+			fork = position
+			break
+		}
+		added = append(added, id)
+
+		data, err := t.engine.GetGhostdagData(id)
+		if err != nil {
+			return err
+		}
+		id = data.SelectedParent
+	}
+	for i, j := 0, len(added)-1; i < j; i, j = i+1, j-1 {
+		added[i], added[j] = added[j], added[i]
+	}
+
+	if fork+1 < len(t.chain) && t.undo[fork+1] == nil {
+		if err := t.rebuild(fork); err != nil {
+			return err
+		}
+	}
+	for len(t.chain) > fork+1 {
+		if err := t.revertChainVertex(); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range added {
+		results, err := t.applyChainVertex(t.state, id)
+		if err != nil {
+			return err
+		}
+		t.onChain[id] = len(t.chain)
+		t.chain = append(t.chain, id)
+		t.undo = append(t.undo, results)
+	}
+
+	// Drop the undo data that fell below undoDepth
+	for i := len(t.undo) - undoDepth - 1; i >= 0 && t.undo[i] != nil; i-- {
+		t.undo[i] = nil
+	}
+	return nil
+}
+
+// rebuild replaces the state with the one at the chain vertex at position,
+// applied from genesis, and truncates the chain there
+func (t *StateTracker) rebuild(position int) error {
+	for i := len(t.chain) - 1; i > position; i-- {
+		if err := t.notifyReverted(t.chain[i]); err != nil {
+			return err
+		}
+	}
+
+	chain := t.chain[:position+1]
+	scratch := ledger.NewState()
+	undo := make([][]*ledger.VertexResult, len(chain))
+	for i, id := range chain {
+		results, err := t.applyChainVertex(scratch, id)
+		if err != nil {
+			return err
+		}
+		undo[i] = results
+	}
+	t.state.Replace(scratch)
+
+	for _, id := range t.chain[position+1:] {
+		delete(t.onChain, id)
+	}
+	t.chain = chain
+	t.undo = undo
+	return nil
+}
+
+// revertChainVertex undoes the last chain vertex, mergeset included
+func (t *StateTracker) revertChainVertex() error {
+	last := len(t.chain) - 1
+	results := t.undo[last]
+	for i := len(results) - 1; i >= 0; i-- {
+		t.state.RevertVertex(results[i])
+	}
+	if err := t.notifyReverted(t.chain[last]); err != nil {
+		return err
+	}
+
+	delete(t.onChain, t.chain[last])
+	t.chain = t.chain[:last]
+	t.undo = t.undo[:last]
+	return nil
+}
+
+// notifyReverted tells the reverted handler about the vertices applied
+// with a chain vertex, last applied first
+func (t *StateTracker) notifyReverted(id string) error {
+	if t.reverted == nil {
+		return nil
+	}
+	order, err := t.applyOrder(id)
+	if err != nil {
+		return err
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		t.reverted(order[i])
+	}
+	return nil
+}
+
+// applyChainVertex applies the vertices in the applyOrder of a chain
+// vertex and returns what each application did, in order
+func (t *StateTracker) applyChainVertex(state *ledger.State, id string) ([]*ledger.VertexResult, error) {
+	order, err := t.applyOrder(id)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*ledger.VertexResult, 0, len(order))
+	for _, vertexID := range order {
+		result, err := t.applyVertex(state, vertexID)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// applyOrder lists the mergeset of a chain vertex in ascending blue work,
+// which puts ancestors first, followed by the vertex itself
+func (t *StateTracker) applyOrder(id string) ([]string, error) {
+	data, err := t.engine.GetGhostdagData(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The selected parent, first of the blues, is already applied
+	mergeSet := make([]string, 0, len(data.MergeSetBlues)+len(data.MergeSetReds))
+	if len(data.MergeSetBlues) > 0 {
+		mergeSet = append(mergeSet, data.MergeSetBlues[1:]...)
+	}
+	mergeSet = append(mergeSet, data.MergeSetReds...)
+	ordered, err := t.engine.SortByBlueWork(mergeSet)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]string, 0, len(ordered)+1)
+	for i := len(ordered) - 1; i >= 0; i-- {
+		order = append(order, ordered[i])
+	}
+	return append(order, id), nil
+}
+
+// applyVertex applies one vertex payload. Handlers are only told about
+// the live state; a rebuild replays vertices already reported.
+func (t *StateTracker) applyVertex(state *ledger.State, id string) (*ledger.VertexResult, error) {
+	vertex, err := t.dagStore.GetVertex(id)
+	if err != nil {
+		return nil, fmt.Errorf("vertex %s not found", id)
+	}
+
+	result := state.ApplyVertex(vertex.Coinbase, vertex.Data)
+	if state != t.state {
+		return result, nil
+	}
+	if result.Rejected > 0 && t.rejected != nil {
+		t.rejected(vertex, result.Rejected)
+	}
+	if t.applied != nil {
+		t.applied(vertex, result.Applied)
+	}
+	return result, nil
+}
@@ -0,0 +1,174 @@
+package consensus
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"testing"
+	"time"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/storage"
+)
+
+// testChain builds vertices on a DevNet DAG and tracks its state
+type testChain struct {
+	t       *testing.T
+	params  *chaincfg.Params
+	store   *dag.Store
+	engine  *Engine
+	tracker *StateTracker
+	state   *ledger.State
+	count   int
+}
+
+func newTestChain(t *testing.T) *testChain {
+	t.Helper()
+	params := &chaincfg.DevNetParams
+	store := dag.NewStore(storage.NewMemoryDB())
+	if err := store.AddVertex(params.Genesis()); err != nil {
+		t.Fatalf("adding genesis: %v", err)
+	}
+	engine := NewEngine(store, params)
+	state := ledger.NewState()
+	c := &testChain{
+		t:       t,
+		params:  params,
+		store:   store,
+		engine:  engine,
+		tracker: NewStateTracker(engine, store, state),
+		state:   state,
+	}
+	c.update()
+	return c
+}
+
+// add stores a vertex paid to coinbase carrying txs and updates the state
+func (c *testChain) add(id, coinbase string, parents []string, txs ...*ledger.Transaction) {
+	c.t.Helper()
+	entries := make([][]byte, len(txs))
+	for i, tx := range txs {
+		entries[i], _ = tx.Encode()
+	}
+	data := ledger.EncodePayload(entries)
+	root, err := ledger.PayloadRoot(data)
+	if err != nil {
+		c.t.Fatalf("PayloadRoot: %v", err)
+	}
+
+	c.count++
+	vertex := &dag.Vertex{
+		ID:          id,
+		Data:        data,
+		PayloadRoot: root,
+		Parents:     parents,
+		Coinbase:    coinbase,
+		Timestamp:   c.params.GenesisTime.Add(time.Duration(c.count) * time.Second),
+		Weight:      c.params.VertexWeight(),
+	}
+	vertex.Hash = vertex.CalculateHash()
+	if err := c.store.AddVertex(vertex); err != nil {
+		c.t.Fatalf("adding %s: %v", id, err)
+	}
+	c.update()
+}
+
+// extend adds n vertices named prefix1..prefixN on top of parent and
+// returns the last
+func (c *testChain) extend(prefix, coinbase, parent string, n int) string {
+	c.t.Helper()
+	for i := 1; i <= n; i++ {
+		id := fmt.Sprintf("%s%d", prefix, i)
+		c.add(id, coinbase, []string{parent})
+		parent = id
+	}
+	return parent
+}
+
+func (c *testChain) update() {
+	c.t.Helper()
+	if err := c.tracker.Update(); err != nil {
+		c.t.Fatalf("Update: %v", err)
+	}
+}
+
+// checkReplay compares the tracked state with one applied from genesis
+func (c *testChain) checkReplay(addresses ...string) {
+	c.t.Helper()
+	fresh := ledger.NewState()
+	if err := NewStateTracker(c.engine, c.store, fresh).Update(); err != nil {
+		c.t.Fatalf("Update: %v", err)
+	}
+	for _, address := range addresses {
+		if got, want := c.state.GetAccount(address), fresh.GetAccount(address); got != want {
+			c.t.Errorf("%s is %+v, want %+v as replayed from genesis", address, got, want)
+		}
+	}
+}
+
+func TestStateTrackerRollsBackToTheFork(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	alice := ledger.AddressFromPublicKey(public)
+	const bob = "0x00000000000000000000000000000000000000b0"
+
+	c := newTestChain(t)
+	genesis := c.params.Genesis().ID
+	c.add("funding", alice, []string{genesis})
+
+	// Branch a spends alice's reward; branch b, from the same point, does not
+	transfer := &ledger.Transaction{Type: ledger.TypeTransfer, From: alice, To: bob, Amount: ledger.Coin, Fee: 100}
+	if err := transfer.Sign(private); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	c.add("a0", "0xa", []string{"funding"}, transfer)
+	tipA := c.extend("a", "0xa", "a0", 2)
+	if got := c.state.GetAccount(bob).Balance; got != ledger.Coin {
+		t.Fatalf("recipient balance %d on branch a", got)
+	}
+
+	tipB := c.extend("b", "0xb", "funding", 4)
+	if got := c.state.GetAccount(alice); got != (ledger.Account{Balance: ledger.BlockReward}) {
+		t.Errorf("sender %+v after switching to branch b, want the transfer undone", got)
+	}
+	if got := c.state.GetAccount("0xa"); got != (ledger.Account{}) {
+		t.Errorf("branch a coinbase %+v after switching away", got)
+	}
+	if got := c.state.GetAccount("0xb").Balance; got != 4*ledger.BlockReward {
+		t.Errorf("branch b coinbase balance %d", got)
+	}
+	c.checkReplay(alice, bob, "0xa", "0xb")
+
+	// Back to a, now heavier, and then a vertex merging both
+	tipA = c.extend("x", "0xa", tipA, 3)
+	c.checkReplay(alice, bob, "0xa", "0xb")
+	c.add("merge", "0xc", []string{tipA, tipB})
+	c.checkReplay(alice, bob, "0xa", "0xb", "0xc")
+	if got := c.state.GetAccount(alice).Nonce; got != 1 {
+		t.Errorf("sender nonce %d after the merge, want 1", got)
+	}
+}
+
+func TestStateTrackerRebuildsPastUndoDepth(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.params.Genesis().ID
+
+	c.extend("a", "0xa", genesis, undoDepth+2)
+	if got := c.state.GetAccount("0xa").Balance; got != (undoDepth+2)*ledger.BlockReward {
+		t.Fatalf("branch a coinbase balance %d", got)
+	}
+
+	// A heavier branch from genesis leaves the applied chain below the
+	// vertices that still have undo data
+	c.extend("b", "0xb", genesis, undoDepth+3)
+	if got := c.state.GetAccount("0xa"); got != (ledger.Account{}) {
+		t.Errorf("branch a coinbase %+v after switching away", got)
+	}
+	if got := c.state.GetAccount("0xb").Balance; got != (undoDepth+3)*ledger.BlockReward {
+		t.Errorf("branch b coinbase balance %d", got)
+	}
+	c.checkReplay("0xa", "0xb")
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -12,13 +13,27 @@ import (
 
 // Vertex represents a block in the DAG
 type Vertex struct {
-	ID        string    `json:"id"`
-	Hash      string    `json:"hash"`
-	Data      []byte    `json:"data"`
-	Parents   []string  `json:"parents"`
-	Timestamp time.Time `json:"timestamp"`
-	Nonce     uint64    `json:"nonce"`
-	Weight    uint64    `json:"weight"`
+	ID          string    `json:"id"`
+	Hash        string    `json:"hash"`
+	Data        []byte    `json:"data"`
+	PayloadRoot string    `json:"payload_root"`
+	Coinbase    string    `json:"coinbase,omitempty"` // address paid the block reward
+	Parents     []string  `json:"parents"`
+	Timestamp   time.Time `json:"timestamp"`
+	Nonce       uint64    `json:"nonce"`
+	Weight      uint64    `json:"weight"`
+}
+
+// Header is a vertex without its payload; it carries everything its hash covers
+type Header struct {
+	ID          string    `json:"id"`
+	Hash        string    `json:"hash"`
+	PayloadRoot string    `json:"payload_root"`
+	Coinbase    string    `json:"coinbase,omitempty"` // address paid the block reward
+	Parents     []string  `json:"parents"`
+	Timestamp   time.Time `json:"timestamp"`
+	Nonce       uint64    `json:"nonce"`
+	Weight      uint64    `json:"weight"`
 }
 
 // Edge represents a connection between vertices
@@ -27,26 +42,70 @@ type Edge struct {
 	To   string `json:"to"`
 }
 
+// VertexHandler is called after a vertex has been accepted into the DAG
+type VertexHandler func(vertex *Vertex)
+
+// tipsKey is where the current tip set is persisted
+const tipsKey = "dag:tips"
+
 // Store manages the DAG structure
 type Store struct {
-	db   storage.Database
-	mu   sync.RWMutex
-	tips map[string]bool // current tips of the DAG
+	db         storage.Database
+	mu         sync.RWMutex
+	tips       map[string]bool     // current tips of the DAG
+	children   map[string][]string // child IDs by vertex, kept in memory
+	handlersMu sync.RWMutex
+	handlers   []VertexHandler
 }
 
 // NewStore creates a new DAG store
 func NewStore(db storage.Database) *Store {
-	return &Store{
-		db:   db,
-		tips: make(map[string]bool),
+	s := &Store{
+		db:       db,
+		tips:     make(map[string]bool),
+		children: make(map[string][]string),
 	}
+	s.loadTips()
+	s.loadChildren()
+	return s
+}
+
+// OnVertexAdded registers a handler that runs for every accepted vertex
+func (s *Store) OnVertexAdded(handler VertexHandler) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+
+	s.handlers = append(s.handlers, handler)
 }
 
 // AddVertex adds a new vertex to the DAG
 func (s *Store) AddVertex(vertex *Vertex) error {
+	if err := s.addVertex(vertex); err != nil {
+		return err
+	}
+
+	// Notify handlers outside the lock so they can read the DAG
+	s.handlersMu.RLock()
+	handlers := s.handlers
+	s.handlersMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(vertex)
+	}
+
+	return nil
+}
+
+// addVertex stores the vertex and updates the tips
+func (s *Store) addVertex(vertex *Vertex) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// A vertex is only added once; re-adding would make it a tip again
+	if s.hasVertex(vertex.ID) {
+		return fmt.Errorf("vertex %s already exists", vertex.ID)
+	}
+
 	// Validate parents exist
 	for _, parentID := range vertex.Parents {
 		if !s.hasVertex(parentID) {
@@ -68,10 +127,11 @@ func (s *Store) AddVertex(vertex *Vertex) error {
 	// Update tips (remove parents, add this vertex)
 	for _, parentID := range vertex.Parents {
 		delete(s.tips, parentID)
+		s.children[parentID] = append(s.children[parentID], vertex.ID)
 	}
 	s.tips[vertex.ID] = true
 
-	return nil
+	return s.saveTips()
 }
 
 // GetVertex retrieves a vertex by ID
@@ -79,6 +139,11 @@ func (s *Store) GetVertex(id string) (*Vertex, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	return s.getVertex(id)
+}
+
+// getVertex loads a vertex without taking the lock
+func (s *Store) getVertex(id string) (*Vertex, error) {
 	key := fmt.Sprintf("vertex:%s", id)
 	data, err := s.db.Get(key)
 	if err != nil {
@@ -93,6 +158,14 @@ func (s *Store) GetVertex(id string) (*Vertex, error) {
 	return &vertex, nil
 }
 
+// GetChildren returns the IDs of the vertices that have id as a parent
+func (s *Store) GetChildren(id string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]string(nil), s.children[id]...)
+}
+
 // GetTips returns current tip vertices
 func (s *Store) GetTips() []string {
 	s.mu.RLock()
@@ -120,7 +193,7 @@ func (s *Store) GetTopologicalOrder() ([]*Vertex, error) {
 			return nil
 		}
 
-		vertex, err := s.GetVertex(id)
+		vertex, err := s.getVertex(id)
 		if err != nil {
 			return err
 		}
@@ -147,6 +220,73 @@ func (s *Store) GetTopologicalOrder() ([]*Vertex, error) {
 	return result, nil
 }
 
+// loadTips restores the tip set persisted by a previous run
+func (s *Store) loadTips() {
+	data, err := s.db.Get(tipsKey)
+	if err != nil {
+		return
+	}
+
+	var tips []string
+	if err := json.Unmarshal(data, &tips); err != nil {
+		return
+	}
+
+	for _, tip := range tips {
+		s.tips[tip] = true
+	}
+}
+
+// loadChildren indexes the children of every stored vertex, walking the
+// DAG down from the tips once
+func (s *Store) loadChildren() {
+	visited := make(map[string]bool)
+	stack := make([]string, 0, len(s.tips))
+	for tip := range s.tips {
+		stack = append(stack, tip)
+	}
+
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		vertex, err := s.getVertex(id)
+		if err != nil {
+			continue
+		}
+		for _, parentID := range vertex.Parents {
+			s.children[parentID] = append(s.children[parentID], id)
+			stack = append(stack, parentID)
+		}
+	}
+}
+
+// saveTips persists the current tip set
+func (s *Store) saveTips() error {
+	tips := make([]string, 0, len(s.tips))
+	for tip := range s.tips {
+		tips = append(tips, tip)
+	}
+
+	data, err := json.Marshal(tips)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Set(tipsKey, data)
+}
+
+// HasVertex reports whether a vertex is stored
+func (s *Store) HasVertex(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hasVertex(id)
+}
+
 // hasVertex checks if a vertex exists
 func (s *Store) hasVertex(id string) bool {
 	key := fmt.Sprintf("vertex:%s", id)
@@ -154,9 +294,44 @@ func (s *Store) hasVertex(id string) bool {
 	return err == nil
 }
 
+// Header returns the header of the vertex
+func (v *Vertex) Header() *Header {
+	return &Header{
+		ID:          v.ID,
+		Hash:        v.Hash,
+		PayloadRoot: v.PayloadRoot,
+		Coinbase:    v.Coinbase,
+		Parents:     v.Parents,
+		Timestamp:   v.Timestamp,
+		Nonce:       v.Nonce,
+		Weight:      v.Weight,
+	}
+}
+
 // CalculateHash computes the hash of a vertex
 func (v *Vertex) CalculateHash() string {
-	data := fmt.Sprintf("%s:%v:%d:%d", v.ID, v.Parents, v.Timestamp.Unix(), v.Nonce)
+	return v.Header().CalculateHash()
+}
+
+// PreImage returns the hashed header fields up to the nonce; the hash is
+// the SHA-256 of the pre-image followed by the decimal nonce
+func (h *Header) PreImage() string {
+	return fmt.Sprintf("%s:%v:%s:%s:%d:", h.ID, h.Parents, h.PayloadRoot, h.Coinbase, h.Timestamp.Unix())
+}
+
+// CalculateHash computes the hash of the vertex the header belongs to
+func (h *Header) CalculateHash() string {
+	data := h.PreImage() + strconv.FormatUint(h.Nonce, 10)
 	hash := sha256.Sum256([]byte(data))
 	return fmt.Sprintf("%x", hash)
 }
+
+// HasParent reports whether id is one of the header's parents
+func (h *Header) HasParent(id string) bool {
+	for _, parentID := range h.Parents {
+		if parentID == id {
+			return true
+		}
+	}
+	return false
+}
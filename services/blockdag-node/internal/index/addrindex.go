@@ -0,0 +1,377 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/storage"
+)
+
+// keyPrefix namespaces every key written by the address index
+const keyPrefix = "addrindex:"
+
+// Default and maximum page sizes for address history queries
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Entry is one transaction in an address's history
+type Entry struct {
+	TxID      string `json:"txid"`
+	VertexID  string `json:"vertex_id"`
+	Type      string `json:"type"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	Amount    uint64 `json:"amount"`
+	Fee       uint64 `json:"fee"`
+	Nonce     uint64 `json:"nonce"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Activity summarizes the indexed transactions of an address. Received
+// counts transfers only, not block rewards.
+type Activity struct {
+	Address  string `json:"address"`
+	Received uint64 `json:"received"`
+	Sent     uint64 `json:"sent"`
+	Fees     uint64 `json:"fees"`
+	TxCount  uint64 `json:"tx_count"`
+}
+
+// AddrIndex maps addresses to the transactions the state applied that
+// touch them. It follows the StateTracker: vertices are indexed as they
+// are applied and removed as they are reverted.
+type AddrIndex struct {
+	db storage.Database
+	mu sync.Mutex
+}
+
+// NewAddrIndex creates an address index backed by db
+func NewAddrIndex(db storage.Database) *AddrIndex {
+	return &AddrIndex{db: db}
+}
+
+// IndexVertex records the transactions the state applied from a vertex
+// under their addresses. A transaction already indexed from another
+// vertex is skipped, so each ID is listed once. The vertex is written in
+// one batch with its record, so a crash cannot leave it half indexed.
+func (ai *AddrIndex) IndexVertex(vertex *dag.Vertex, txs []*ledger.Transaction) error {
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+
+	// Skip vertices that were already indexed
+	if _, err := ai.db.Get(vertexKey(vertex.ID)); err == nil {
+		return nil
+	}
+
+	batch := &indexBatch{db: ai.db, writes: make(map[string][]byte)}
+	appended := make([]string, 0, 2*len(txs)) // addresses in the order entries were added
+	for _, tx := range txs {
+		txID := tx.ID()
+		if _, err := batch.get(txKey(txID)); err == nil {
+			continue
+		}
+
+		entry := &Entry{
+			TxID:      txID,
+			VertexID:  vertex.ID,
+			Type:      tx.Type,
+			From:      tx.From,
+			To:        tx.To,
+			Amount:    tx.Amount,
+			Fee:       tx.Fee,
+			Nonce:     tx.Nonce,
+			Timestamp: vertex.Timestamp.Unix(),
+		}
+
+		for _, address := range tx.Addresses() {
+			if err := batch.appendEntry(address, entry); err != nil {
+				return err
+			}
+			appended = append(appended, address)
+		}
+		batch.writes[txKey(txID)] = []byte(vertex.ID)
+	}
+
+	record, err := json.Marshal(appended)
+	if err != nil {
+		return err
+	}
+	batch.writes[vertexKey(vertex.ID)] = record
+	return ai.db.WriteBatch(batch.writes)
+}
+
+// RemoveVertex takes back the entries IndexVertex added for a vertex.
+// Vertices must be removed in the reverse of the order they were indexed,
+// as the state reverts them, so their entries are the last of each history.
+func (ai *AddrIndex) RemoveVertex(vertexID string) error {
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+
+	record, err := ai.db.Get(vertexKey(vertexID))
+	if err != nil {
+		return nil // not indexed
+	}
+	var appended []string
+	if err := json.Unmarshal(record, &appended); err != nil {
+		return fmt.Errorf("invalid index record for vertex %s: %v", vertexID, err)
+	}
+
+	batch := &indexBatch{db: ai.db, writes: make(map[string][]byte)}
+	for i := len(appended) - 1; i >= 0; i-- {
+		entry, err := batch.popEntry(appended[i])
+		if err != nil {
+			return err
+		}
+		if entry.VertexID != vertexID {
+			return fmt.Errorf("last entry for %s is from vertex %s, not %s", appended[i], entry.VertexID, vertexID)
+		}
+		batch.writes[txKey(entry.TxID)] = nil
+	}
+
+	batch.writes[vertexKey(vertexID)] = nil
+	return ai.db.WriteBatch(batch.writes)
+}
+
+// Reindex drops the index and rebuilds it from the transactions the state
+// applies along the selected chain of the stored DAG
+func (ai *AddrIndex) Reindex(engine *consensus.Engine, dagStore *dag.Store) (int, error) {
+	ai.mu.Lock()
+	if err := ai.db.DeletePrefix(keyPrefix); err != nil {
+		ai.mu.Unlock()
+		return 0, fmt.Errorf("failed to clear address index: %v", err)
+	}
+	ai.mu.Unlock()
+
+	count := 0
+	var indexErr error
+	tracker := consensus.NewStateTracker(engine, dagStore, ledger.NewState())
+	tracker.OnApplied(func(vertex *dag.Vertex, txs []*ledger.Transaction) {
+		if indexErr == nil {
+			indexErr = ai.IndexVertex(vertex, txs)
+			count++
+		}
+	})
+	if err := tracker.Update(); err != nil {
+		return 0, err
+	}
+	if indexErr != nil {
+		return 0, indexErr
+	}
+
+	return count, nil
+}
+
+// GetAddressTransactions returns a page of an address's history, newest first.
+// The cursor is opaque; pass the returned next cursor to continue, or "" to start.
+func (ai *AddrIndex) GetAddressTransactions(address, cursor string, limit int) ([]*Entry, string, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+
+	count, err := getCount(ai.db.Get, address)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The cursor is the sequence number to stop before
+	end := count
+	if cursor != "" {
+		end, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil || end > count {
+			return nil, "", fmt.Errorf("invalid cursor: %s", cursor)
+		}
+	}
+
+	entries := make([]*Entry, 0, limit)
+	seq := end
+	for seq > 0 && len(entries) < limit {
+		seq--
+		data, err := ai.db.Get(entryKey(address, seq))
+		if err != nil {
+			return nil, "", err
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, &entry)
+	}
+
+	nextCursor := ""
+	if seq > 0 {
+		nextCursor = strconv.FormatUint(seq, 10)
+	}
+
+	return entries, nextCursor, nil
+}
+
+// GetActivity returns the totals of an address's indexed transactions
+func (ai *AddrIndex) GetActivity(address string) (*Activity, error) {
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+
+	return getActivity(ai.db.Get, address)
+}
+
+// GetTxVertex returns the ID of the vertex the state applied the transaction from
+func (ai *AddrIndex) GetTxVertex(txID string) (string, error) {
+	data, err := ai.db.Get(txKey(txID))
+	if err != nil {
+		return "", fmt.Errorf("transaction %s not found in index", txID)
+	}
+	return string(data), nil
+}
+
+// indexBatch collects the writes for one vertex; reads see them before
+// the database
+type indexBatch struct {
+	db     storage.Database
+	writes map[string][]byte
+}
+
+// get reads a key, preferring a pending write or delete
+func (b *indexBatch) get(key string) ([]byte, error) {
+	if value, exists := b.writes[key]; exists {
+		if value == nil {
+			return nil, fmt.Errorf("key not found: %s", key)
+		}
+		return value, nil
+	}
+	return b.db.Get(key)
+}
+
+// appendEntry adds an entry to the end of an address's history
+func (b *indexBatch) appendEntry(address string, entry *Entry) error {
+	count, err := getCount(b.get, address)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	b.writes[entryKey(address, count)] = data
+
+	// Fold the entry into the running totals
+	activity, err := getActivity(b.get, address)
+	if err != nil {
+		return err
+	}
+	activity.TxCount++
+	if entry.To == address {
+		activity.Received += entry.Amount
+	}
+	if entry.From == address {
+		activity.Sent += entry.Amount
+		activity.Fees += entry.Fee
+	}
+
+	return b.setTotals(address, activity, count+1)
+}
+
+// popEntry removes and returns the last entry of an address's history
+func (b *indexBatch) popEntry(address string) (*Entry, error) {
+	count, err := getCount(b.get, address)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("no entries indexed for %s", address)
+	}
+
+	data, err := b.get(entryKey(address, count-1))
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	b.writes[entryKey(address, count-1)] = nil
+
+	// Take the entry back out of the running totals
+	activity, err := getActivity(b.get, address)
+	if err != nil {
+		return nil, err
+	}
+	activity.TxCount--
+	if entry.To == address {
+		activity.Received -= entry.Amount
+	}
+	if entry.From == address {
+		activity.Sent -= entry.Amount
+		activity.Fees -= entry.Fee
+	}
+
+	return &entry, b.setTotals(address, activity, count-1)
+}
+
+// setTotals writes an address's running totals and number of entries
+func (b *indexBatch) setTotals(address string, activity *Activity, count uint64) error {
+	data, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	b.writes[keyPrefix+"activity:"+address] = data
+	b.writes[countKey(address)] = []byte(strconv.FormatUint(count, 10))
+	return nil
+}
+
+// getCount returns the number of entries indexed for an address
+func getCount(get func(string) ([]byte, error), address string) (uint64, error) {
+	data, err := get(countKey(address))
+	if err != nil {
+		return 0, nil
+	}
+	return strconv.ParseUint(string(data), 10, 64)
+}
+
+// getActivity loads the running totals of an address
+func getActivity(get func(string) ([]byte, error), address string) (*Activity, error) {
+	activity := &Activity{Address: address}
+
+	data, err := get(keyPrefix + "activity:" + address)
+	if err != nil {
+		return activity, nil
+	}
+
+	if err := json.Unmarshal(data, activity); err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
+// vertexKey is where the addresses a vertex added entries for are stored
+func vertexKey(vertexID string) string {
+	return keyPrefix + "vertex:" + vertexID
+}
+
+// txKey is where the vertex a transaction was indexed from is stored
+func txKey(txID string) string {
+	return keyPrefix + "tx:" + txID
+}
+
+// countKey is where the number of entries for an address is stored
+func countKey(address string) string {
+	return keyPrefix + "count:" + address
+}
+
+// entryKey is where the seq-th entry for an address is stored
+func entryKey(address string, seq uint64) string {
+	return fmt.Sprintf("%sentry:%s:%020d", keyPrefix, address, seq)
+}
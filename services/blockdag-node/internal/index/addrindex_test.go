@@ -0,0 +1,307 @@
+package index
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"testing"
+	"time"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/storage"
+)
+
+const (
+	alice = "0x00000000000000000000000000000000000000a1"
+	bob   = "0x00000000000000000000000000000000000000b0"
+)
+
+// transfer is an unsigned transfer; the index does not check signatures
+func transfer(from, to string, amount, fee, nonce uint64) *ledger.Transaction {
+	return &ledger.Transaction{Type: ledger.TypeTransfer, From: from, To: to, Amount: amount, Fee: fee, Nonce: nonce}
+}
+
+// vertexAt is a vertex with only the fields the index reads
+func vertexAt(id string, second int64) *dag.Vertex {
+	return &dag.Vertex{ID: id, Timestamp: time.Unix(second, 0)}
+}
+
+// history returns every entry of an address's history, newest first
+func history(t *testing.T, ai *AddrIndex, address string) []*Entry {
+	t.Helper()
+	entries, _, err := ai.GetAddressTransactions(address, "", MaxPageSize)
+	if err != nil {
+		t.Fatalf("GetAddressTransactions: %v", err)
+	}
+	return entries
+}
+
+func TestIndexVertex(t *testing.T) {
+	ai := NewAddrIndex(storage.NewMemoryDB())
+	first := transfer(alice, bob, 100, 10, 0)
+	self := transfer(alice, alice, 5, 1, 1)
+	if err := ai.IndexVertex(vertexAt("v1", 1), []*ledger.Transaction{first, self, first}); err != nil {
+		t.Fatalf("IndexVertex: %v", err)
+	}
+	// The same transaction from another vertex, and the same vertex again
+	if err := ai.IndexVertex(vertexAt("v2", 2), []*ledger.Transaction{first}); err != nil {
+		t.Fatalf("IndexVertex: %v", err)
+	}
+	if err := ai.IndexVertex(vertexAt("v1", 1), []*ledger.Transaction{transfer(bob, alice, 1, 1, 0)}); err != nil {
+		t.Fatalf("IndexVertex: %v", err)
+	}
+
+	entries := history(t, ai, alice)
+	if len(entries) != 2 || entries[0].TxID != self.ID() || entries[1].TxID != first.ID() {
+		t.Fatalf("sender history %+v, want the self transfer and the first transfer once each", entries)
+	}
+	if entries[1].VertexID != "v1" || entries[1].Timestamp != 1 || entries[1].Amount != 100 || entries[1].Fee != 10 {
+		t.Errorf("entry %+v does not describe the transfer", entries[1])
+	}
+	if got := history(t, ai, bob); len(got) != 1 || got[0].TxID != first.ID() {
+		t.Errorf("recipient history %+v", got)
+	}
+
+	activity, err := ai.GetActivity(alice)
+	if err != nil {
+		t.Fatalf("GetActivity: %v", err)
+	}
+	want := Activity{Address: alice, Received: 5, Sent: 105, Fees: 11, TxCount: 2}
+	if *activity != want {
+		t.Errorf("sender activity %+v, want %+v", *activity, want)
+	}
+	if vertexID, err := ai.GetTxVertex(first.ID()); err != nil || vertexID != "v1" {
+		t.Errorf("GetTxVertex = %q, %v; want v1", vertexID, err)
+	}
+}
+
+func TestGetAddressTransactionsPaging(t *testing.T) {
+	ai := NewAddrIndex(storage.NewMemoryDB())
+	const total = 7
+	for i := 0; i < total; i++ {
+		tx := transfer(alice, bob, uint64(i), 1, uint64(i))
+		if err := ai.IndexVertex(vertexAt(fmt.Sprintf("v%d", i), int64(i)), []*ledger.Transaction{tx}); err != nil {
+			t.Fatalf("IndexVertex: %v", err)
+		}
+	}
+
+	// Pages of three, newest first, until the cursor runs out
+	var nonces []uint64
+	cursor := ""
+	for page := 0; ; page++ {
+		entries, next, err := ai.GetAddressTransactions(alice, cursor, 3)
+		if err != nil {
+			t.Fatalf("GetAddressTransactions: %v", err)
+		}
+		if len(entries) > 3 {
+			t.Fatalf("page of %d entries, limit 3", len(entries))
+		}
+		for _, entry := range entries {
+			nonces = append(nonces, entry.Nonce)
+		}
+		if next == "" {
+			break
+		}
+		if page > total {
+			t.Fatal("paging does not end")
+		}
+		cursor = next
+	}
+	if len(nonces) != total {
+		t.Fatalf("paged %v, want %d entries", nonces, total)
+	}
+	for i, nonce := range nonces {
+		if nonce != uint64(total-1-i) {
+			t.Fatalf("paged %v, want newest first", nonces)
+		}
+	}
+
+	// An entry added between pages does not shift the next page
+	entries, next, err := ai.GetAddressTransactions(alice, "", 2)
+	if err != nil {
+		t.Fatalf("GetAddressTransactions: %v", err)
+	}
+	if err := ai.IndexVertex(vertexAt("late", 99), []*ledger.Transaction{transfer(alice, bob, 0, 1, 99)}); err != nil {
+		t.Fatalf("IndexVertex: %v", err)
+	}
+	more, _, err := ai.GetAddressTransactions(alice, next, 2)
+	if err != nil {
+		t.Fatalf("GetAddressTransactions: %v", err)
+	}
+	if entries[1].Nonce != 5 || more[0].Nonce != 4 {
+		t.Errorf("pages %d then %d, want 5 then 4", entries[1].Nonce, more[0].Nonce)
+	}
+
+	for _, cursor := range []string{"x", "-1", "100"} {
+		if _, _, err := ai.GetAddressTransactions(alice, cursor, 2); err == nil {
+			t.Errorf("accepted cursor %q", cursor)
+		}
+	}
+	if entries, next, err := ai.GetAddressTransactions("0xunknown", "", 0); err != nil || len(entries) != 0 || next != "" {
+		t.Errorf("unknown address returned %v, %q, %v", entries, next, err)
+	}
+	if entries, _, err := ai.GetAddressTransactions(alice, "", 0); err != nil || len(entries) != total+1 {
+		t.Errorf("default page has %d entries, %v", len(entries), err)
+	}
+}
+
+func TestRemoveVertex(t *testing.T) {
+	ai := NewAddrIndex(storage.NewMemoryDB())
+	first := transfer(alice, bob, 100, 10, 0)
+	second := transfer(bob, alice, 30, 3, 0)
+	if err := ai.IndexVertex(vertexAt("v1", 1), []*ledger.Transaction{first}); err != nil {
+		t.Fatalf("IndexVertex: %v", err)
+	}
+	if err := ai.IndexVertex(vertexAt("v2", 2), []*ledger.Transaction{second, first}); err != nil {
+		t.Fatalf("IndexVertex: %v", err)
+	}
+
+	if err := ai.RemoveVertex("v1"); err == nil {
+		t.Error("removed a vertex whose entries are not the last")
+	}
+	if err := ai.RemoveVertex("v2"); err != nil {
+		t.Fatalf("RemoveVertex: %v", err)
+	}
+	if _, err := ai.GetTxVertex(second.ID()); err == nil {
+		t.Error("removed transaction is still found")
+	}
+	if got := history(t, ai, alice); len(got) != 1 || got[0].TxID != first.ID() {
+		t.Errorf("history after removing v2: %+v", got)
+	}
+	activity, err := ai.GetActivity(bob)
+	if err != nil {
+		t.Fatalf("GetActivity: %v", err)
+	}
+	if want := (Activity{Address: bob, Received: 100, TxCount: 1}); *activity != want {
+		t.Errorf("activity %+v, want %+v", *activity, want)
+	}
+
+	// Removing twice is a no-op, and the vertex can be indexed again
+	if err := ai.RemoveVertex("v2"); err != nil {
+		t.Errorf("removing an unindexed vertex: %v", err)
+	}
+	if err := ai.IndexVertex(vertexAt("v3", 3), []*ledger.Transaction{second}); err != nil {
+		t.Fatalf("IndexVertex: %v", err)
+	}
+	if vertexID, err := ai.GetTxVertex(second.ID()); err != nil || vertexID != "v3" {
+		t.Errorf("GetTxVertex = %q, %v; want v3", vertexID, err)
+	}
+	if got := history(t, ai, bob); len(got) != 2 || got[0].VertexID != "v3" {
+		t.Errorf("history after indexing v3: %+v", got)
+	}
+}
+
+func TestIndexFollowsTheState(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	payer := ledger.AddressFromPublicKey(public)
+	signed := func(amount, nonce uint64) *ledger.Transaction {
+		tx := transfer(payer, bob, amount, 100, nonce)
+		if err := tx.Sign(private); err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return tx
+	}
+
+	params := &chaincfg.DevNetParams
+	db := storage.NewMemoryDB()
+	store := dag.NewStore(db)
+	genesis := params.Genesis()
+	if err := store.AddVertex(genesis); err != nil {
+		t.Fatalf("adding genesis: %v", err)
+	}
+	engine := consensus.NewEngine(store, params)
+	state := ledger.NewState()
+	tracker := consensus.NewStateTracker(engine, store, state)
+	ai := NewAddrIndex(db)
+	tracker.OnApplied(func(vertex *dag.Vertex, txs []*ledger.Transaction) {
+		if err := ai.IndexVertex(vertex, txs); err != nil {
+			t.Errorf("IndexVertex: %v", err)
+		}
+	})
+	tracker.OnReverted(func(vertexID string) {
+		if err := ai.RemoveVertex(vertexID); err != nil {
+			t.Errorf("RemoveVertex: %v", err)
+		}
+	})
+
+	count := 0
+	add := func(id string, parents []string, txs ...*ledger.Transaction) {
+		entries := make([][]byte, len(txs))
+		for i, tx := range txs {
+			entries[i], _ = tx.Encode()
+		}
+		data := ledger.EncodePayload(entries)
+		root, _ := ledger.PayloadRoot(data)
+		count++
+		vertex := &dag.Vertex{
+			ID:          id,
+			Data:        data,
+			PayloadRoot: root,
+			Parents:     parents,
+			Coinbase:    payer,
+			Timestamp:   params.GenesisTime.Add(time.Duration(count) * time.Second),
+			Weight:      params.VertexWeight(),
+		}
+		vertex.Hash = vertex.CalculateHash()
+		if err := store.AddVertex(vertex); err != nil {
+			t.Fatalf("adding %s: %v", id, err)
+		}
+		if err := tracker.Update(); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+
+	// Branch a applies one transfer and rejects an overspend and a replay
+	spend := signed(ledger.Coin, 0)
+	add("funding", []string{genesis.ID})
+	add("a1", []string{"funding"}, spend, signed(1000*ledger.Coin, 1), spend)
+	checkIndexMatchesState(t, ai, state, payer, 2, 1)
+
+	// Branch b takes over without a1's transfer, then spends twice
+	add("b1", []string{"funding"})
+	add("b2", []string{"b1"}, signed(2*ledger.Coin, 0), signed(3*ledger.Coin, 1))
+	checkIndexMatchesState(t, ai, state, payer, 3, 2)
+	if _, err := ai.GetTxVertex(spend.ID()); err == nil {
+		t.Error("the transfer of the abandoned branch is still indexed")
+	}
+
+	// Reindexing from the DAG gives the same history
+	before := history(t, ai, payer)
+	if _, err := ai.Reindex(engine, store); err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	after := history(t, ai, payer)
+	if len(after) != len(before) {
+		t.Fatalf("reindexed history %d entries, want %d", len(after), len(before))
+	}
+	for i := range before {
+		if *after[i] != *before[i] {
+			t.Errorf("reindexed entry %+v, want %+v", after[i], before[i])
+		}
+	}
+}
+
+// checkIndexMatchesState checks that the payer's indexed totals explain
+// its balance, given how many block rewards it earned
+func checkIndexMatchesState(t *testing.T, ai *AddrIndex, state *ledger.State, payer string, rewards, txCount uint64) {
+	t.Helper()
+	activity, err := ai.GetActivity(payer)
+	if err != nil {
+		t.Fatalf("GetActivity: %v", err)
+	}
+	if activity.TxCount != txCount {
+		t.Errorf("indexed %d transactions, want %d", activity.TxCount, txCount)
+	}
+
+	// The payer mines every vertex, so the fees it pays come back to it
+	account := state.GetAccount(payer)
+	want := rewards*ledger.BlockReward + activity.Received - activity.Sent
+	if account.Balance != want {
+		t.Errorf("balance %d, but the index explains %d", account.Balance, want)
+	}
+}
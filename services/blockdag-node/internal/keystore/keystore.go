@@ -0,0 +1,273 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+
+	"hackodisha/blockdag-node/internal/ledger"
+)
+
+// Scrypt cost parameters. Standard is for real keys; Light trades strength
+// for speed on test and devnet keys.
+const (
+	StandardScryptN = 1 << 18
+	LightScryptN    = 1 << 12
+	scryptR         = 8
+	scryptP         = 1
+	keyLength       = 32
+)
+
+// keyFileVersion is the version of the on-disk key format
+const keyFileVersion = 1
+
+// KeyFile is the on-disk form of an encrypted key
+type KeyFile struct {
+	Version int        `json:"version"`
+	Address string     `json:"address"`
+	PubKey  string     `json:"pubkey"`
+	Crypto  CryptoJSON `json:"crypto"`
+}
+
+// CryptoJSON holds the KDF and cipher parameters of an encrypted key
+type CryptoJSON struct {
+	KDF        string `json:"kdf"`
+	ScryptN    int    `json:"scrypt_n"`
+	ScryptR    int    `json:"scrypt_r"`
+	ScryptP    int    `json:"scrypt_p"`
+	Salt       string `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// Keystore stores passphrase-encrypted keys as files in a directory
+type Keystore struct {
+	dir     string
+	scryptN int
+}
+
+// New opens the keystore in dir, creating the directory if needed
+func New(dir string, scryptN int) (*Keystore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create keystore directory: %v", err)
+	}
+
+	return &Keystore{
+		dir:     dir,
+		scryptN: scryptN,
+	}, nil
+}
+
+// NewKey generates a key, stores it encrypted with passphrase and returns its address
+func (ks *Keystore) NewKey(passphrase string) (string, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	return ks.ImportKey(privateKey, passphrase)
+}
+
+// ImportKey stores an existing private key encrypted with passphrase
+func (ks *Keystore) ImportKey(privateKey ed25519.PrivateKey, passphrase string) (string, error) {
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	address := ledger.AddressFromPublicKey(publicKey)
+
+	path, err := ks.keyPath(address)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("key %s already exists", address)
+	}
+
+	keyFile, err := encryptKey(privateKey, passphrase, ks.scryptN)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(keyFile, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write key file: %v", err)
+	}
+
+	return address, nil
+}
+
+// List returns the addresses of all stored keys
+func (ks *Keystore) List() ([]string, error) {
+	files, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, 0, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		addresses = append(addresses, strings.TrimSuffix(name, ".json"))
+	}
+
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+// Unlock decrypts the key for address with passphrase
+func (ks *Keystore) Unlock(address, passphrase string) (ed25519.PrivateKey, error) {
+	path, err := ks.keyPath(address)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("key %s not found", address)
+	}
+
+	var keyFile KeyFile
+	if err := json.Unmarshal(data, &keyFile); err != nil {
+		return nil, fmt.Errorf("invalid key file: %v", err)
+	}
+	if keyFile.Address != address {
+		return nil, fmt.Errorf("key file for %s holds address %s", address, keyFile.Address)
+	}
+
+	return decryptKey(&keyFile, passphrase)
+}
+
+// keyPath returns the file that holds the key for address. Only valid
+// addresses are accepted, so the path cannot leave the keystore directory.
+func (ks *Keystore) keyPath(address string) (string, error) {
+	if err := ledger.ValidateAddress(address); err != nil {
+		return "", err
+	}
+	return filepath.Join(ks.dir, address+".json"), nil
+}
+
+// encryptKey encrypts the private key seed with a scrypt-derived AES-256-GCM key
+func encryptKey(privateKey ed25519.PrivateKey, passphrase string, scryptN int) (*KeyFile, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	derivedKey, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	address := ledger.AddressFromPublicKey(publicKey)
+
+	// Bind the ciphertext to the address it claims to be
+	ciphertext := gcm.Seal(nil, nonce, privateKey.Seed(), []byte(address))
+
+	return &KeyFile{
+		Version: keyFileVersion,
+		Address: address,
+		PubKey:  hex.EncodeToString(publicKey),
+		Crypto: CryptoJSON{
+			KDF:        "scrypt",
+			ScryptN:    scryptN,
+			ScryptR:    scryptR,
+			ScryptP:    scryptP,
+			Salt:       hex.EncodeToString(salt),
+			Cipher:     "aes-256-gcm",
+			Nonce:      hex.EncodeToString(nonce),
+			Ciphertext: hex.EncodeToString(ciphertext),
+		},
+	}, nil
+}
+
+// decryptKey recovers the private key from a key file
+func decryptKey(keyFile *KeyFile, passphrase string) (ed25519.PrivateKey, error) {
+	if keyFile.Version != keyFileVersion {
+		return nil, fmt.Errorf("unsupported key file version %d", keyFile.Version)
+	}
+	if keyFile.Crypto.KDF != "scrypt" || keyFile.Crypto.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported key encryption %s/%s", keyFile.Crypto.KDF, keyFile.Crypto.Cipher)
+	}
+
+	// Only the costs the keystore writes are accepted; the file could
+	// otherwise make unlocking take unbounded time and memory
+	n, r, p := keyFile.Crypto.ScryptN, keyFile.Crypto.ScryptR, keyFile.Crypto.ScryptP
+	if (n != StandardScryptN && n != LightScryptN) || r != scryptR || p != scryptP {
+		return nil, fmt.Errorf("unsupported scrypt parameters N=%d r=%d p=%d", n, r, p)
+	}
+
+	salt, err := hex.DecodeString(keyFile.Crypto.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+	nonce, err := hex.DecodeString(keyFile.Crypto.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %v", err)
+	}
+	ciphertext, err := hex.DecodeString(keyFile.Crypto.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %v", err)
+	}
+
+	derivedKey, err := scrypt.Key([]byte(passphrase), salt, n, r, p, keyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length")
+	}
+
+	seed, err := gcm.Open(nil, nonce, ciphertext, []byte(keyFile.Address))
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt key: wrong passphrase")
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid key length")
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	if ledger.AddressFromPublicKey(privateKey.Public().(ed25519.PublicKey)) != keyFile.Address {
+		return nil, fmt.Errorf("key does not match address %s", keyFile.Address)
+	}
+
+	return privateKey, nil
+}
+
+// newGCM creates an AES-GCM cipher from a 32-byte key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
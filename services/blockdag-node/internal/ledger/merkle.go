@@ -0,0 +1,134 @@
+package ledger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Domain separation prefixes keep leaves and inner nodes from colliding
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// MerkleStep is one sibling on the path from a leaf to the root
+type MerkleStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"` // sibling sits to the left of the running hash
+}
+
+// EntryID returns the ID of an encoded transaction
+func EntryID(entry []byte) string {
+	hash := sha256.Sum256(entry)
+	return hex.EncodeToString(hash[:])
+}
+
+// PayloadRoot returns the Merkle root over the transactions in a vertex payload
+func PayloadRoot(data []byte) (string, error) {
+	entries, err := DecodePayload(data)
+	if err != nil {
+		return "", err
+	}
+
+	level := make([][]byte, len(entries))
+	for i, entry := range entries {
+		level[i] = leafHash(entry)
+	}
+
+	for len(level) > 1 {
+		level = nextLevel(level)
+	}
+
+	if len(level) == 0 {
+		return hex.EncodeToString(make([]byte, sha256.Size)), nil
+	}
+	return hex.EncodeToString(level[0]), nil
+}
+
+// MerkleBranch returns the siblings needed to prove the entry at index
+func MerkleBranch(data []byte, index int) ([]MerkleStep, error) {
+	entries, err := DecodePayload(data)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(entries) {
+		return nil, fmt.Errorf("transaction index %d out of range", index)
+	}
+
+	level := make([][]byte, len(entries))
+	for i, entry := range entries {
+		level[i] = leafHash(entry)
+	}
+
+	branch := make([]MerkleStep, 0)
+	for len(level) > 1 {
+		sibling := index ^ 1
+		// An unpaired last node is promoted without a sibling
+		if sibling < len(level) {
+			branch = append(branch, MerkleStep{
+				Hash: hex.EncodeToString(level[sibling]),
+				Left: sibling < index,
+			})
+		}
+		level = nextLevel(level)
+		index /= 2
+	}
+
+	return branch, nil
+}
+
+// VerifyMerkleBranch checks that txID hashes up to root through branch
+func VerifyMerkleBranch(txID string, branch []MerkleStep, root string) error {
+	id, err := hex.DecodeString(txID)
+	if err != nil || len(id) != sha256.Size {
+		return fmt.Errorf("invalid transaction ID: %s", txID)
+	}
+
+	current := hashNode(leafPrefix, id)
+	for i, step := range branch {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil || len(sibling) != sha256.Size {
+			return fmt.Errorf("invalid branch hash at step %d", i)
+		}
+		if step.Left {
+			current = hashNode(nodePrefix, sibling, current)
+		} else {
+			current = hashNode(nodePrefix, current, sibling)
+		}
+	}
+
+	if hex.EncodeToString(current) != root {
+		return fmt.Errorf("merkle branch does not match payload root")
+	}
+	return nil
+}
+
+// leafHash hashes a transaction ID into a tree leaf
+func leafHash(entry []byte) []byte {
+	id := sha256.Sum256(entry)
+	return hashNode(leafPrefix, id[:])
+}
+
+// nextLevel pairs up nodes, promoting an unpaired last node unchanged
+func nextLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+		next = append(next, hashNode(nodePrefix, level[i], level[i+1]))
+	}
+	return next
+}
+
+// hashNode hashes the prefix followed by the given parts
+func hashNode(prefix byte, parts ...[]byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{prefix})
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
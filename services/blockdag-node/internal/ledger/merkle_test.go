@@ -0,0 +1,130 @@
+package ledger
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testPayload encodes n distinct entries
+func testPayload(n int) ([]byte, [][]byte) {
+	entries := make([][]byte, n)
+	for i := range entries {
+		entries[i] = []byte(fmt.Sprintf("entry %d", i))
+	}
+	return EncodePayload(entries), entries
+}
+
+func TestPayloadRoot(t *testing.T) {
+	empty, err := PayloadRoot(EncodePayload(nil))
+	if err != nil {
+		t.Fatalf("PayloadRoot of an empty payload: %v", err)
+	}
+	if empty != strings.Repeat("0", 64) {
+		t.Errorf("empty payload root = %s, want all zeros", empty)
+	}
+
+	// A single leaf is the root
+	payload, entries := testPayload(1)
+	root, err := PayloadRoot(payload)
+	if err != nil {
+		t.Fatalf("PayloadRoot: %v", err)
+	}
+	if want := hex.EncodeToString(leafHash(entries[0])); root != want {
+		t.Errorf("single leaf root = %s, want %s", root, want)
+	}
+
+	// Three leaves pair the first two and promote the third
+	payload, entries = testPayload(3)
+	root, err = PayloadRoot(payload)
+	if err != nil {
+		t.Fatalf("PayloadRoot: %v", err)
+	}
+	left := hashNode(nodePrefix, leafHash(entries[0]), leafHash(entries[1]))
+	if want := hex.EncodeToString(hashNode(nodePrefix, left, leafHash(entries[2]))); root != want {
+		t.Errorf("three leaf root = %s, want %s", root, want)
+	}
+
+	// Order matters
+	reordered, err := PayloadRoot(EncodePayload([][]byte{entries[1], entries[0], entries[2]}))
+	if err != nil {
+		t.Fatalf("PayloadRoot: %v", err)
+	}
+	if reordered == root {
+		t.Error("reordering the entries kept the root")
+	}
+}
+
+func TestMerkleBranchVerifies(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 5, 7, 8, 9, 16, 17} {
+		payload, entries := testPayload(n)
+		root, err := PayloadRoot(payload)
+		if err != nil {
+			t.Fatalf("PayloadRoot: %v", err)
+		}
+		for i, entry := range entries {
+			t.Run(fmt.Sprintf("%d of %d", i, n), func(t *testing.T) {
+				branch, err := MerkleBranch(payload, i)
+				if err != nil {
+					t.Fatalf("MerkleBranch: %v", err)
+				}
+				if err := VerifyMerkleBranch(EntryID(entry), branch, root); err != nil {
+					t.Errorf("VerifyMerkleBranch: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestMerkleBranchIndexOutOfRange(t *testing.T) {
+	payload, _ := testPayload(3)
+	for _, index := range []int{-1, 3} {
+		if _, err := MerkleBranch(payload, index); err == nil {
+			t.Errorf("MerkleBranch accepted index %d of 3", index)
+		}
+	}
+}
+
+func TestVerifyMerkleBranchRejectsTampering(t *testing.T) {
+	payload, entries := testPayload(5)
+	root, err := PayloadRoot(payload)
+	if err != nil {
+		t.Fatalf("PayloadRoot: %v", err)
+	}
+	branch, err := MerkleBranch(payload, 2)
+	if err != nil {
+		t.Fatalf("MerkleBranch: %v", err)
+	}
+	txID := EntryID(entries[2])
+
+	// tampered copies the branch and changes it
+	tampered := func(change func([]MerkleStep) []MerkleStep) []MerkleStep {
+		steps := append([]MerkleStep(nil), branch...)
+		return change(steps)
+	}
+
+	tests := []struct {
+		name   string
+		txID   string
+		branch []MerkleStep
+		root   string
+	}{
+		{"other transaction", EntryID(entries[3]), branch, root},
+		{"flipped side", txID, tampered(func(s []MerkleStep) []MerkleStep { s[0].Left = !s[0].Left; return s }), root},
+		{"changed sibling", txID, tampered(func(s []MerkleStep) []MerkleStep { s[1].Hash = EntryID([]byte("x")); return s }), root},
+		{"missing step", txID, tampered(func(s []MerkleStep) []MerkleStep { return s[:len(s)-1] }), root},
+		{"extra step", txID, tampered(func(s []MerkleStep) []MerkleStep { return append(s, MerkleStep{Hash: txID}) }), root},
+		{"swapped steps", txID, tampered(func(s []MerkleStep) []MerkleStep { s[0], s[1] = s[1], s[0]; return s }), root},
+		{"malformed sibling", txID, tampered(func(s []MerkleStep) []MerkleStep { s[0].Hash = "zz"; return s }), root},
+		{"malformed transaction ID", "not hex", branch, root},
+		{"other root", txID, branch, EntryID([]byte("root"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyMerkleBranch(tt.txID, tt.branch, tt.root); err == nil {
+				t.Error("VerifyMerkleBranch accepted a tampered proof")
+			}
+		})
+	}
+}
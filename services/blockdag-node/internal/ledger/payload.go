@@ -0,0 +1,65 @@
+package ledger
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// EncodePayload packs encoded transactions into a vertex payload, as the
+// block template builder does for every mined vertex. Each entry is
+// prefixed with its length as a uvarint so boundaries survive.
+func EncodePayload(entries [][]byte) []byte {
+	size := 0
+	for _, entry := range entries {
+		size += binary.MaxVarintLen64 + len(entry)
+	}
+
+	data := make([]byte, 0, size)
+	for _, entry := range entries {
+		data = binary.AppendUvarint(data, uint64(len(entry)))
+		data = append(data, entry...)
+	}
+	return data
+}
+
+// EntrySize returns the bytes an entry takes up in an encoded payload
+func EntrySize(entry []byte) int {
+	return len(binary.AppendUvarint(nil, uint64(len(entry)))) + len(entry)
+}
+
+// DecodePayload splits a vertex payload back into encoded transactions
+func DecodePayload(data []byte) ([][]byte, error) {
+	entries := make([][]byte, 0)
+	for len(data) > 0 {
+		length, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid payload length prefix")
+		}
+		data = data[n:]
+
+		if length > uint64(len(data)) {
+			return nil, fmt.Errorf("payload entry of %d bytes exceeds remaining %d bytes", length, len(data))
+		}
+		entries = append(entries, data[:length])
+		data = data[length:]
+	}
+	return entries, nil
+}
+
+// DecodeTransactions decodes every transaction in a vertex payload
+func DecodeTransactions(data []byte) ([]*Transaction, error) {
+	entries, err := DecodePayload(data)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]*Transaction, len(entries))
+	for i, entry := range entries {
+		tx, err := ParseTransaction(entry)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		transactions[i] = tx
+	}
+	return transactions, nil
+}
@@ -0,0 +1,330 @@
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Coin is the number of base units in one coin
+const Coin = 100_000_000
+
+// BlockReward is credited to the coinbase of every vertex
+const BlockReward = 50 * Coin
+
+// Account is the state of a single address
+type Account struct {
+	Balance uint64 `json:"balance"`
+	Nonce   uint64 `json:"nonce"`
+	Staked  uint64 `json:"staked"`
+}
+
+// BalanceChange describes how a transaction moves an address's balances
+type BalanceChange struct {
+	Address       string `json:"address"`
+	BalanceBefore uint64 `json:"balance_before"`
+	BalanceAfter  uint64 `json:"balance_after"`
+	StakedBefore  uint64 `json:"staked_before"`
+	StakedAfter   uint64 `json:"staked_after"`
+}
+
+// NonceChange describes how a transaction moves an address's nonce
+type NonceChange struct {
+	Address string `json:"address"`
+	Before  uint64 `json:"before"`
+	After   uint64 `json:"after"`
+}
+
+// Simulation is the outcome of applying a transaction to a copy of the state
+type Simulation struct {
+	TxID           string          `json:"txid"`
+	Accepted       bool            `json:"accepted"`
+	Reason         string          `json:"reason,omitempty"`
+	Fee            uint64          `json:"fee"`
+	Size           int             `json:"size"`
+	FeeRate        float64         `json:"fee_rate"`
+	BalanceChanges []BalanceChange `json:"balance_changes"`
+	NonceChanges   []NonceChange   `json:"nonce_changes"`
+}
+
+// VertexResult is the outcome of applying a vertex payload. It keeps the
+// accounts as they were before, so RevertVertex can undo it.
+type VertexResult struct {
+	Applied  []*Transaction // in payload order
+	Rejected int
+	undo     map[string]*Account // nil for an account that did not exist
+}
+
+// State is the account state produced by the accepted transactions
+type State struct {
+	mu       sync.RWMutex
+	accounts map[string]*Account
+	undo     map[string]*Account // accounts before the vertex being applied
+}
+
+// NewState creates an empty state
+func NewState() *State {
+	return &State{
+		accounts: make(map[string]*Account),
+	}
+}
+
+// GetAccount returns a copy of the account at address
+func (s *State) GetAccount(address string) Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if account, exists := s.accounts[address]; exists {
+		return *account
+	}
+	return Account{}
+}
+
+// Replace swaps in the accounts of other, which must not be used afterwards
+func (s *State) Replace(other *State) {
+	other.mu.Lock()
+	accounts := other.accounts
+	other.accounts = nil
+	other.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts = accounts
+}
+
+// ApplyTransaction validates the transaction against the state and applies it
+func (s *State) ApplyTransaction(tx *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.apply(tx)
+}
+
+// ApplyVertex applies every transaction in a vertex payload, skipping the
+// ones that are invalid against the state at that point, then credits the
+// block reward and the fees of the applied transactions to the coinbase.
+// A payload that does not decode changes nothing.
+func (s *State) ApplyVertex(coinbase string, data []byte) *VertexResult {
+	entries, err := DecodePayload(data)
+	if err != nil {
+		return &VertexResult{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &VertexResult{Applied: make([]*Transaction, 0, len(entries))}
+	s.undo = make(map[string]*Account)
+	defer func() {
+		result.undo = s.undo
+		s.undo = nil
+	}()
+
+	var fees uint64
+	for _, entry := range entries {
+		tx, err := ParseTransaction(entry)
+		if err != nil {
+			result.Rejected++
+			continue
+		}
+		if err := s.apply(tx); err != nil {
+			result.Rejected++
+			continue
+		}
+		result.Applied = append(result.Applied, tx)
+
+		// Data transactions have no payer, so their fee is never collected
+		if tx.Type != TypeData {
+			fees += tx.Fee
+		}
+	}
+
+	if coinbase != "" {
+		s.mutableAccount(coinbase).Balance += BlockReward + fees
+	}
+	return result
+}
+
+// RevertVertex undoes ApplyVertex. Vertices must be reverted in the
+// reverse of the order they were applied.
+func (s *State) RevertVertex(result *VertexResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for address, account := range result.undo {
+		if account == nil {
+			delete(s.accounts, address)
+			continue
+		}
+		restored := *account
+		s.accounts[address] = &restored
+	}
+}
+
+// CheckTransaction reports whether the transaction could be accepted for
+// later inclusion: it must be valid against the state, except that its
+// nonce may be ahead of the account nonce
+func (s *State) CheckTransaction(tx *Transaction) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.check(tx); err != nil {
+		if _, ahead := err.(*nonceAheadError); !ahead {
+			return err
+		}
+	}
+	return nil
+}
+
+// Simulate applies the transaction to a copy of the state and reports the
+// result without changing the state
+func (s *State) Simulate(tx *Transaction) *Simulation {
+	encoded, _ := tx.Encode()
+	simulation := &Simulation{
+		TxID:           tx.ID(),
+		Fee:            tx.Fee,
+		Size:           len(encoded),
+		BalanceChanges: make([]BalanceChange, 0),
+		NonceChanges:   make([]NonceChange, 0),
+	}
+	if len(encoded) > 0 {
+		simulation.FeeRate = float64(tx.Fee) / float64(len(encoded))
+	}
+
+	s.mu.RLock()
+	scratch := &State{accounts: make(map[string]*Account)}
+	addresses := tx.Addresses()
+	for _, address := range addresses {
+		if account, exists := s.accounts[address]; exists {
+			copied := *account
+			scratch.accounts[address] = &copied
+		}
+	}
+	s.mu.RUnlock()
+
+	before := make(map[string]Account)
+	for _, address := range addresses {
+		before[address] = scratch.GetAccount(address)
+	}
+
+	if err := scratch.ApplyTransaction(tx); err != nil {
+		simulation.Reason = err.Error()
+		return simulation
+	}
+	simulation.Accepted = true
+
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		old, updated := before[address], scratch.GetAccount(address)
+		if old.Balance != updated.Balance || old.Staked != updated.Staked {
+			simulation.BalanceChanges = append(simulation.BalanceChanges, BalanceChange{
+				Address:       address,
+				BalanceBefore: old.Balance,
+				BalanceAfter:  updated.Balance,
+				StakedBefore:  old.Staked,
+				StakedAfter:   updated.Staked,
+			})
+		}
+		if old.Nonce != updated.Nonce {
+			simulation.NonceChanges = append(simulation.NonceChanges, NonceChange{
+				Address: address,
+				Before:  old.Nonce,
+				After:   updated.Nonce,
+			})
+		}
+	}
+
+	return simulation
+}
+
+// nonceAheadError is returned when a transaction's nonce is ahead of the account
+type nonceAheadError struct {
+	expected, got uint64
+}
+
+func (e *nonceAheadError) Error() string {
+	return fmt.Sprintf("nonce too high: expected %d, got %d", e.expected, e.got)
+}
+
+// check validates the transaction against the state
+func (s *State) check(tx *Transaction) error {
+	if err := tx.validateShape(); err != nil {
+		return err
+	}
+	if tx.Type == TypeData {
+		return nil
+	}
+	if err := tx.VerifySignature(); err != nil {
+		return err
+	}
+
+	sender := s.account(tx.From)
+	if tx.Nonce < sender.Nonce {
+		return fmt.Errorf("nonce too low: expected %d, got %d", sender.Nonce, tx.Nonce)
+	}
+
+	// Amount and fee must not overflow when added
+	cost := tx.Amount + tx.Fee
+	if cost < tx.Amount {
+		return fmt.Errorf("amount plus fee overflows")
+	}
+	if sender.Balance < cost {
+		return fmt.Errorf("insufficient balance: have %d, need %d", sender.Balance, cost)
+	}
+
+	if tx.Nonce > sender.Nonce {
+		return &nonceAheadError{expected: sender.Nonce, got: tx.Nonce}
+	}
+	return nil
+}
+
+// apply validates and applies the transaction; the caller holds the lock
+func (s *State) apply(tx *Transaction) error {
+	if err := s.check(tx); err != nil {
+		return err
+	}
+	if tx.Type == TypeData {
+		return nil
+	}
+
+	sender := s.mutableAccount(tx.From)
+	sender.Balance -= tx.Amount + tx.Fee
+	sender.Nonce++
+
+	switch tx.Type {
+	case TypeTransfer:
+		s.mutableAccount(tx.To).Balance += tx.Amount
+	case TypeStake:
+		sender.Staked += tx.Amount
+	}
+
+	return nil
+}
+
+// account returns the account at address without creating it
+func (s *State) account(address string) Account {
+	if account, exists := s.accounts[address]; exists {
+		return *account
+	}
+	return Account{}
+}
+
+// mutableAccount returns the account at address, creating it if needed.
+// While a vertex is applied, the account is saved first for its undo.
+func (s *State) mutableAccount(address string) *Account {
+	account, exists := s.accounts[address]
+	if _, saved := s.undo[address]; s.undo != nil && !saved {
+		if exists {
+			before := *account
+			s.undo[address] = &before
+		} else {
+			s.undo[address] = nil
+		}
+	}
+	if !exists {
+		account = &Account{}
+		s.accounts[address] = account
+	}
+	return account
+}
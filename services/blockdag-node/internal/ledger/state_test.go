@@ -0,0 +1,259 @@
+package ledger
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+)
+
+// testAccount is a key pair and the address it owns
+type testAccount struct {
+	key     ed25519.PrivateKey
+	address string
+}
+
+func newTestAccount(t *testing.T) *testAccount {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return &testAccount{key: private, address: AddressFromPublicKey(public)}
+}
+
+// signed builds a transaction from the account and signs it
+func (a *testAccount) signed(t *testing.T, txType, to string, amount, fee, nonce uint64) *Transaction {
+	t.Helper()
+	tx := &Transaction{Type: txType, From: a.address, To: to, Amount: amount, Fee: fee, Nonce: nonce}
+	if err := tx.Sign(a.key); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return tx
+}
+
+// fundedState returns a state where the account holds one block reward
+func fundedState(a *testAccount) *State {
+	state := NewState()
+	state.ApplyVertex(a.address, EncodePayload(nil))
+	return state
+}
+
+func TestApplyTransaction(t *testing.T) {
+	alice, bob := newTestAccount(t), newTestAccount(t)
+
+	tests := []struct {
+		name   string
+		tx     func() *Transaction
+		reason string // empty when the transaction applies
+		alice  Account
+		bob    Account
+	}{
+		{"transfer", func() *Transaction { return alice.signed(t, TypeTransfer, bob.address, 10*Coin, 1000, 0) },
+			"", Account{Balance: BlockReward - 10*Coin - 1000, Nonce: 1}, Account{Balance: 10 * Coin}},
+		{"stake", func() *Transaction { return alice.signed(t, TypeStake, alice.address, 10*Coin, 1000, 0) },
+			"", Account{Balance: BlockReward - 10*Coin - 1000, Nonce: 1, Staked: 10 * Coin}, Account{}},
+		{"whole balance", func() *Transaction { return alice.signed(t, TypeTransfer, bob.address, BlockReward-1000, 1000, 0) },
+			"", Account{Nonce: 1}, Account{Balance: BlockReward - 1000}},
+		{"insufficient balance", func() *Transaction { return alice.signed(t, TypeTransfer, bob.address, BlockReward, 1, 0) },
+			"insufficient balance", Account{Balance: BlockReward}, Account{}},
+		{"amount and fee overflow", func() *Transaction { return alice.signed(t, TypeTransfer, bob.address, ^uint64(0), 1, 0) },
+			"overflows", Account{Balance: BlockReward}, Account{}},
+		{"nonce ahead", func() *Transaction { return alice.signed(t, TypeTransfer, bob.address, 1, 1, 1) },
+			"nonce too high", Account{Balance: BlockReward}, Account{}},
+		{"unsigned", func() *Transaction {
+			return &Transaction{Type: TypeTransfer, From: alice.address, To: bob.address, Amount: 1, Fee: 1}
+		}, "not signed", Account{Balance: BlockReward}, Account{}},
+		{"signed by someone else", func() *Transaction {
+			tx := &Transaction{Type: TypeTransfer, From: alice.address, To: bob.address, Amount: 1, Fee: 1}
+			tx.Sign(bob.key)
+			return tx
+		}, "public key belongs to", Account{Balance: BlockReward}, Account{}},
+		{"tampered after signing", func() *Transaction {
+			tx := alice.signed(t, TypeTransfer, bob.address, 1, 1, 0)
+			tx.Amount = 2
+			return tx
+		}, "invalid signature", Account{Balance: BlockReward}, Account{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := fundedState(alice)
+			err := state.ApplyTransaction(tt.tx())
+			if tt.reason == "" && err != nil {
+				t.Fatalf("ApplyTransaction: %v", err)
+			}
+			if tt.reason != "" && (err == nil || !strings.Contains(err.Error(), tt.reason)) {
+				t.Fatalf("got error %v, want %q", err, tt.reason)
+			}
+			if got := state.GetAccount(alice.address); got != tt.alice {
+				t.Errorf("sender %+v, want %+v", got, tt.alice)
+			}
+			if got := state.GetAccount(bob.address); got != tt.bob {
+				t.Errorf("recipient %+v, want %+v", got, tt.bob)
+			}
+		})
+	}
+}
+
+func TestApplyTransactionReplay(t *testing.T) {
+	alice, bob := newTestAccount(t), newTestAccount(t)
+	state := fundedState(alice)
+	tx := alice.signed(t, TypeTransfer, bob.address, Coin, 1000, 0)
+	if err := state.ApplyTransaction(tx); err != nil {
+		t.Fatalf("ApplyTransaction: %v", err)
+	}
+	if err := state.ApplyTransaction(tx); err == nil || !strings.Contains(err.Error(), "nonce too low") {
+		t.Errorf("replay returned %v, want nonce too low", err)
+	}
+}
+
+func TestApplyVertex(t *testing.T) {
+	alice, bob, miner := newTestAccount(t), newTestAccount(t), newTestAccount(t)
+	state := fundedState(alice)
+
+	first := alice.signed(t, TypeTransfer, bob.address, 10*Coin, 1000, 0)
+	second := alice.signed(t, TypeStake, alice.address, Coin, 500, 1)
+	data := NewDataTransaction([]byte("note"), 300)
+	entries := make([][]byte, 0)
+	for _, tx := range []*Transaction{first, second, first, data} { // first again is a replay
+		encoded, _ := tx.Encode()
+		entries = append(entries, encoded)
+	}
+	entries = append(entries, []byte("not a transaction"))
+
+	result := state.ApplyVertex(miner.address, EncodePayload(entries))
+	if len(result.Applied) != 3 || result.Rejected != 2 {
+		t.Fatalf("applied %d, rejected %d; want 3 and 2", len(result.Applied), result.Rejected)
+	}
+	if result.Applied[0].ID() != first.ID() || result.Applied[1].ID() != second.ID() || result.Applied[2].ID() != data.ID() {
+		t.Error("applied transactions are not in payload order")
+	}
+
+	// The fees of the applied transfer and stake go to the coinbase; the
+	// data transaction has no payer
+	if got := state.GetAccount(miner.address); got.Balance != BlockReward+1500 {
+		t.Errorf("coinbase balance %d, want %d", got.Balance, BlockReward+1500)
+	}
+	want := Account{Balance: BlockReward - 11*Coin - 1500, Nonce: 2, Staked: Coin}
+	if got := state.GetAccount(alice.address); got != want {
+		t.Errorf("sender %+v, want %+v", got, want)
+	}
+
+	// A payload that does not decode changes nothing
+	result = state.ApplyVertex(miner.address, []byte{0xff})
+	if len(result.Applied) != 0 || state.GetAccount(miner.address).Balance != BlockReward+1500 {
+		t.Error("an undecodable payload changed the state")
+	}
+}
+
+func TestRevertVertex(t *testing.T) {
+	alice, bob, miner := newTestAccount(t), newTestAccount(t), newTestAccount(t)
+	state := fundedState(alice)
+	before := map[string]Account{
+		alice.address: state.GetAccount(alice.address),
+		bob.address:   state.GetAccount(bob.address),
+		miner.address: state.GetAccount(miner.address),
+	}
+
+	payload := func(txs ...*Transaction) []byte {
+		entries := make([][]byte, len(txs))
+		for i, tx := range txs {
+			entries[i], _ = tx.Encode()
+		}
+		return EncodePayload(entries)
+	}
+	first := state.ApplyVertex(miner.address, payload(alice.signed(t, TypeTransfer, bob.address, Coin, 100, 0)))
+	second := state.ApplyVertex(bob.address, payload(alice.signed(t, TypeTransfer, bob.address, Coin, 100, 1)))
+
+	state.RevertVertex(second)
+	if got := state.GetAccount(alice.address); got.Nonce != 1 || got.Balance != BlockReward-Coin-100 {
+		t.Errorf("sender after one revert %+v", got)
+	}
+	state.RevertVertex(first)
+	for address, want := range before {
+		if got := state.GetAccount(address); got != want {
+			t.Errorf("%s after reverting %+v, want %+v", address, got, want)
+		}
+	}
+
+	// Accounts the vertices created are gone, not left empty
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	for _, address := range []string{bob.address, miner.address} {
+		if _, exists := state.accounts[address]; exists {
+			t.Errorf("account %s survived the revert", address)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	alice, bob := newTestAccount(t), newTestAccount(t)
+	state := fundedState(alice)
+
+	tx := alice.signed(t, TypeTransfer, bob.address, 10*Coin, 1000, 0)
+	simulation := state.Simulate(tx)
+	if !simulation.Accepted || simulation.Reason != "" {
+		t.Fatalf("simulation rejected: %s", simulation.Reason)
+	}
+	encoded, _ := tx.Encode()
+	if simulation.TxID != tx.ID() || simulation.Fee != 1000 || simulation.Size != len(encoded) {
+		t.Errorf("simulation %+v does not describe the transaction", simulation)
+	}
+	if simulation.FeeRate != float64(1000)/float64(len(encoded)) {
+		t.Errorf("fee rate %v", simulation.FeeRate)
+	}
+
+	wantBalances := map[string]BalanceChange{
+		alice.address: {Address: alice.address, BalanceBefore: BlockReward, BalanceAfter: BlockReward - 10*Coin - 1000},
+		bob.address:   {Address: bob.address, BalanceAfter: 10 * Coin},
+	}
+	if len(simulation.BalanceChanges) != len(wantBalances) {
+		t.Fatalf("balance changes %+v", simulation.BalanceChanges)
+	}
+	for _, change := range simulation.BalanceChanges {
+		if change != wantBalances[change.Address] {
+			t.Errorf("balance change %+v, want %+v", change, wantBalances[change.Address])
+		}
+	}
+	wantNonce := NonceChange{Address: alice.address, Before: 0, After: 1}
+	if len(simulation.NonceChanges) != 1 || simulation.NonceChanges[0] != wantNonce {
+		t.Errorf("nonce changes %+v, want %+v", simulation.NonceChanges, wantNonce)
+	}
+
+	// The state itself is untouched
+	if got := state.GetAccount(alice.address); got != (Account{Balance: BlockReward}) {
+		t.Errorf("sender changed to %+v", got)
+	}
+	if got := state.GetAccount(bob.address); got != (Account{}) {
+		t.Errorf("recipient changed to %+v", got)
+	}
+}
+
+func TestSimulateRejects(t *testing.T) {
+	alice, bob := newTestAccount(t), newTestAccount(t)
+	state := fundedState(alice)
+
+	tests := []struct {
+		name   string
+		tx     *Transaction
+		reason string
+	}{
+		{"insufficient balance", alice.signed(t, TypeTransfer, bob.address, BlockReward, 1, 0), "insufficient balance"},
+		{"nonce ahead", alice.signed(t, TypeStake, alice.address, 1, 1, 5), "nonce too high"},
+		{"unfunded sender", bob.signed(t, TypeTransfer, alice.address, 1, 1, 0), "insufficient balance"},
+		{"missing recipient", alice.signed(t, TypeTransfer, "", 1, 1, 0), "missing a recipient"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulation := state.Simulate(tt.tx)
+			if simulation.Accepted || !strings.Contains(simulation.Reason, tt.reason) {
+				t.Errorf("accepted %v with reason %q, want %q", simulation.Accepted, simulation.Reason, tt.reason)
+			}
+			if len(simulation.BalanceChanges) != 0 || len(simulation.NonceChanges) != 0 {
+				t.Errorf("rejected simulation reports changes %+v %+v", simulation.BalanceChanges, simulation.NonceChanges)
+			}
+			if simulation.Fee != tt.tx.Fee {
+				t.Errorf("fee %d, want %d", simulation.Fee, tt.tx.Fee)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package ledger
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Transaction types
+const (
+	TypeData     = "data"
+	TypeTransfer = "transfer"
+	TypeStake    = "stake"
+)
+
+// Transaction is the decoded form of a transaction carried in a vertex payload
+type Transaction struct {
+	Type   string `json:"type"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Amount uint64 `json:"amount,omitempty"`
+	Fee    uint64 `json:"fee"`
+	Nonce  uint64 `json:"nonce"`
+	Data   []byte `json:"data,omitempty"`
+	Time   int64  `json:"time,omitempty"`
+
+	PubKey    string `json:"pubkey,omitempty"`    // hex ed25519 public key of the sender
+	Signature string `json:"signature,omitempty"` // hex ed25519 signature over SigningBytes
+}
+
+// NewDataTransaction wraps opaque data in a transaction without account effects
+func NewDataTransaction(data []byte, fee uint64) *Transaction {
+	return &Transaction{
+		Type: TypeData,
+		Fee:  fee,
+		Data: data,
+		Time: time.Now().UnixNano(),
+	}
+}
+
+// ParseTransaction decodes an encoded transaction and checks its shape
+func ParseTransaction(raw []byte) (*Transaction, error) {
+	var tx Transaction
+	if err := json.Unmarshal(raw, &tx); err != nil {
+		return nil, fmt.Errorf("invalid transaction encoding: %v", err)
+	}
+
+	if err := tx.validateShape(); err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// IsStructured reports whether raw looks like an encoded transaction
+// rather than opaque data, i.e. it is a JSON object with a type field
+func IsStructured(raw []byte) bool {
+	var probe struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(raw, &probe) == nil && probe.Type != ""
+}
+
+// Encode returns the canonical encoding of the transaction
+func (tx *Transaction) Encode() ([]byte, error) {
+	return json.Marshal(tx)
+}
+
+// ID returns the transaction ID, the SHA-256 of its canonical encoding
+func (tx *Transaction) ID() string {
+	data, err := tx.Encode()
+	if err != nil {
+		return ""
+	}
+	return EntryID(data)
+}
+
+// SigningBytes returns the encoding the sender signs: the transaction
+// with its public key set and the signature left empty
+func (tx *Transaction) SigningBytes() ([]byte, error) {
+	unsigned := *tx
+	unsigned.Signature = ""
+	return unsigned.Encode()
+}
+
+// Sign sets the sender public key and signs the transaction
+func (tx *Transaction) Sign(privateKey ed25519.PrivateKey) error {
+	tx.PubKey = hex.EncodeToString(privateKey.Public().(ed25519.PublicKey))
+
+	message, err := tx.SigningBytes()
+	if err != nil {
+		return err
+	}
+	tx.Signature = hex.EncodeToString(ed25519.Sign(privateKey, message))
+	return nil
+}
+
+// VerifySignature checks the signature and that the public key owns the sender address
+func (tx *Transaction) VerifySignature() error {
+	if tx.PubKey == "" || tx.Signature == "" {
+		return fmt.Errorf("transaction is not signed")
+	}
+
+	publicKey, err := hex.DecodeString(tx.PubKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key")
+	}
+	signature, err := hex.DecodeString(tx.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid signature encoding")
+	}
+
+	if address := AddressFromPublicKey(publicKey); address != tx.From {
+		return fmt.Errorf("public key belongs to %s, not sender %s", address, tx.From)
+	}
+
+	message, err := tx.SigningBytes()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, message, signature) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// AddressFromPublicKey derives an address: 0x followed by the first 20
+// bytes of the SHA-256 of the public key, in hex
+func AddressFromPublicKey(publicKey ed25519.PublicKey) string {
+	hash := sha256.Sum256(publicKey)
+	return "0x" + hex.EncodeToString(hash[:20])
+}
+
+// ValidateAddress checks that address has the form AddressFromPublicKey produces
+func ValidateAddress(address string) error {
+	if !strings.HasPrefix(address, "0x") || len(address) != 42 {
+		return fmt.Errorf("invalid address %q: expected 0x followed by 40 hex characters", address)
+	}
+	if _, err := hex.DecodeString(address[2:]); err != nil {
+		return fmt.Errorf("invalid address %q: %v", address, err)
+	}
+	return nil
+}
+
+// Addresses returns the distinct addresses touched by the transaction
+func (tx *Transaction) Addresses() []string {
+	addresses := make([]string, 0, 2)
+	if tx.From != "" {
+		addresses = append(addresses, tx.From)
+	}
+	if tx.To != "" && tx.To != tx.From {
+		addresses = append(addresses, tx.To)
+	}
+	return addresses
+}
+
+// validateShape checks the fields required by the transaction type
+func (tx *Transaction) validateShape() error {
+	switch tx.Type {
+	case TypeData:
+		return nil
+	case TypeTransfer, TypeStake:
+		if tx.From == "" {
+			return fmt.Errorf("%s transaction is missing a sender", tx.Type)
+		}
+		if tx.To == "" {
+			return fmt.Errorf("%s transaction is missing a recipient", tx.Type)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown transaction type: %q", tx.Type)
+	}
+}
@@ -0,0 +1,144 @@
+package mempool
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"hackodisha/blockdag-node/internal/ledger"
+)
+
+// MinFeeRate is the lowest fee rate the estimator will suggest, in fee per byte
+const MinFeeRate = 1.0
+
+// MaxTargetConfirmations bounds the confirmation target of an estimate
+const MaxTargetConfirmations = 1000
+
+// FeeEstimate holds suggested fee rates in fee per byte
+type FeeEstimate struct {
+	TargetConfirmations int     `json:"target_confirmations"`
+	Low                 float64 `json:"low"`
+	Medium              float64 `json:"medium"`
+	High                float64 `json:"high"`
+	MempoolSize         int     `json:"mempool_size"`
+	RecentSamples       int     `json:"recent_samples"`
+}
+
+// vertexSample is the fee data of one accepted vertex
+type vertexSample struct {
+	rates []float64
+}
+
+// FeeEstimator suggests fee rates from the mempool and recently accepted vertices
+type FeeEstimator struct {
+	mempool *Mempool
+	mu      sync.RWMutex
+	recent  []vertexSample // ring buffer of the last window vertices
+	next    int
+	window  int
+}
+
+// NewFeeEstimator creates a fee estimator that remembers the last window
+// vertices; a window below one remembers one
+func NewFeeEstimator(mempool *Mempool, window int) *FeeEstimator {
+	window = max(window, 1)
+	return &FeeEstimator{
+		mempool: mempool,
+		recent:  make([]vertexSample, 0, window),
+		window:  window,
+	}
+}
+
+// RecordPayload records the fee rates of the transactions in an accepted vertex payload
+func (fe *FeeEstimator) RecordPayload(data []byte) {
+	entries, err := ledger.DecodePayload(data)
+	if err != nil {
+		return
+	}
+
+	sample := vertexSample{rates: make([]float64, 0, len(entries))}
+	for _, entry := range entries {
+		tx, err := ledger.ParseTransaction(entry)
+		if err != nil || len(entry) == 0 {
+			continue
+		}
+		sample.rates = append(sample.rates, float64(tx.Fee)/float64(len(entry)))
+	}
+
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	if len(fe.recent) < fe.window {
+		fe.recent = append(fe.recent, sample)
+	} else {
+		fe.recent[fe.next] = sample
+	}
+	fe.next = (fe.next + 1) % fe.window
+}
+
+// EstimateFee suggests fee rates for inclusion within targetConfirmations
+// vertices. A longer target needs a smaller share of the queue ahead of it
+// and a lower percentile of the recent vertices' rates, so estimates never
+// grow with the target.
+func (fe *FeeEstimator) EstimateFee(targetConfirmations int) *FeeEstimate {
+	targetConfirmations = min(max(targetConfirmations, 1), MaxTargetConfirmations)
+
+	fe.mu.RLock()
+	recentRates := make([]float64, 0)
+	txPerVertex := 0
+	for _, sample := range fe.recent {
+		recentRates = append(recentRates, sample.rates...)
+		txPerVertex += len(sample.rates)
+	}
+	if len(fe.recent) > 0 {
+		txPerVertex /= len(fe.recent)
+	}
+	fe.mu.RUnlock()
+	sort.Float64s(recentRates)
+
+	// The rate needed to be within the first targetConfirmations vertices'
+	// worth of the mempool queue, ordered by fee rate
+	transactions := fe.mempool.GetTransactions()
+	mempoolRates := make([]float64, 0, len(transactions))
+	for _, tx := range transactions {
+		mempoolRates = append(mempoolRates, tx.FeeRate())
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(mempoolRates)))
+
+	queueRate := 0.0
+	capacity := max(txPerVertex, 1) * targetConfirmations
+	if capacity < len(mempoolRates) {
+		queueRate = mempoolRates[capacity]
+	}
+
+	// One vertex keeps the percentiles; each doubling of the target lowers them
+	scale := 1 / (1 + math.Log2(float64(targetConfirmations)))
+
+	estimate := &FeeEstimate{
+		TargetConfirmations: targetConfirmations,
+		Low:                 math.Max(queueRate, percentile(recentRates, 0.25*scale)),
+		Medium:              math.Max(queueRate, percentile(recentRates, 0.50*scale)),
+		High:                math.Max(queueRate, percentile(recentRates, 0.90*scale)),
+		MempoolSize:         len(transactions),
+		RecentSamples:       len(recentRates),
+	}
+
+	// Keep the suggestions ordered and above the floor
+	estimate.Low = math.Max(estimate.Low, MinFeeRate)
+	estimate.Medium = math.Max(estimate.Medium, estimate.Low)
+	estimate.High = math.Max(estimate.High, estimate.Medium)
+
+	return estimate
+}
+
+// percentile returns the p-th percentile of sorted values, or 0 if empty
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
@@ -0,0 +1,98 @@
+package mempool
+
+import (
+	"fmt"
+	"testing"
+
+	"hackodisha/blockdag-node/internal/ledger"
+)
+
+// dataTransaction returns the i-th data transaction, paying fee
+func dataTransaction(t *testing.T, i int, fee uint64) *ledger.Transaction {
+	t.Helper()
+	return ledger.NewDataTransaction([]byte(fmt.Sprintf("note %04d", i)), fee)
+}
+
+// payload encodes transactions as a vertex payload
+func payload(t *testing.T, txs ...*ledger.Transaction) []byte {
+	t.Helper()
+	entries := make([][]byte, len(txs))
+	for i, tx := range txs {
+		encoded, err := tx.Encode()
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		entries[i] = encoded
+	}
+	return ledger.EncodePayload(entries)
+}
+
+func TestEstimateFeeWithoutData(t *testing.T) {
+	estimator := NewFeeEstimator(NewMempool(100), 10)
+
+	for _, target := range []int{-5, 0, 1, 6, MaxTargetConfirmations + 1} {
+		estimate := estimator.EstimateFee(target)
+		if estimate.Low != MinFeeRate || estimate.Medium != MinFeeRate || estimate.High != MinFeeRate {
+			t.Errorf("target %d: estimate %+v, want the minimum rate", target, estimate)
+		}
+		if estimate.TargetConfirmations < 1 || estimate.TargetConfirmations > MaxTargetConfirmations {
+			t.Errorf("target %d became %d", target, estimate.TargetConfirmations)
+		}
+		if estimate.MempoolSize != 0 || estimate.RecentSamples != 0 {
+			t.Errorf("target %d: estimate %+v counts samples", target, estimate)
+		}
+	}
+
+	// Undecodable and empty payloads add nothing
+	estimator.RecordPayload([]byte{0xff})
+	estimator.RecordPayload(ledger.EncodePayload(nil))
+	if estimate := estimator.EstimateFee(1); estimate.High != MinFeeRate || estimate.RecentSamples != 0 {
+		t.Errorf("estimate %+v after empty payloads", estimate)
+	}
+}
+
+func TestEstimateFeeDoesNotGrowWithTarget(t *testing.T) {
+	pool := NewMempool(1000)
+	estimator := NewFeeEstimator(pool, 10)
+
+	// Recent vertices of ten transactions with rising fees
+	for v := 0; v < 10; v++ {
+		txs := make([]*ledger.Transaction, 10)
+		for i := range txs {
+			txs[i] = dataTransaction(t, v*10+i, uint64(1000*(i+1)))
+		}
+		estimator.RecordPayload(payload(t, txs...))
+	}
+
+	// And a queue of a few vertices' worth
+	for i := 0; i < 50; i++ {
+		tx, err := NewTransaction(dataTransaction(t, 1000+i, uint64(500*(i+1))))
+		if err != nil {
+			t.Fatalf("NewTransaction: %v", err)
+		}
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction: %v", err)
+		}
+	}
+
+	previous := estimator.EstimateFee(1)
+	if previous.RecentSamples != 100 || previous.MempoolSize != 50 {
+		t.Fatalf("estimate %+v, want 100 samples and 50 queued", previous)
+	}
+	for _, target := range []int{2, 3, 5, 10, 50, 100, MaxTargetConfirmations} {
+		estimate := estimator.EstimateFee(target)
+		if estimate.Low > previous.Low || estimate.Medium > previous.Medium || estimate.High > previous.High {
+			t.Errorf("target %d estimates %+v, above %+v for target %d", target, estimate, previous, previous.TargetConfirmations)
+		}
+		if estimate.Low > estimate.Medium || estimate.Medium > estimate.High || estimate.Low < MinFeeRate {
+			t.Errorf("target %d estimates %+v out of order", target, estimate)
+		}
+		previous = estimate
+	}
+
+	// Without a queue, the recent rates alone still fall with the target
+	pool.Clear()
+	if first, last := estimator.EstimateFee(1), estimator.EstimateFee(MaxTargetConfirmations); first.High <= last.High {
+		t.Errorf("high estimate %v for one vertex and %v for %d", first.High, last.High, MaxTargetConfirmations)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"sort"
 	"sync"
 	"time"
+
+	"hackodisha/blockdag-node/internal/ledger"
 )
 
 // Transaction represents a transaction in the mempool
@@ -13,13 +15,46 @@ type Transaction struct {
 	Timestamp time.Time `json:"timestamp"`
 	Fee       uint64    `json:"fee"`
 	Size      int       `json:"size"`
+	Sender    string    `json:"sender,omitempty"` // empty for opaque data
+	Nonce     uint64    `json:"nonce"`
+}
+
+// NewTransaction wraps a ledger transaction for the mempool
+func NewTransaction(ltx *ledger.Transaction) (*Transaction, error) {
+	encoded, err := ltx.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		ID:        ledger.EntryID(encoded),
+		Data:      encoded,
+		Timestamp: time.Now(),
+		Fee:       ltx.Fee,
+		Size:      len(encoded),
+		Sender:    ltx.From,
+		Nonce:     ltx.Nonce,
+	}, nil
+}
+
+// FeeRate returns the transaction's fee per byte
+func (tx *Transaction) FeeRate() float64 {
+	if tx.Size == 0 {
+		return 0
+	}
+	return float64(tx.Fee) / float64(tx.Size)
 }
 
+// TransactionHandler is called after a transaction has been added to the mempool
+type TransactionHandler func(tx *Transaction)
+
 // Mempool manages pending transactions
 type Mempool struct {
 	mu           sync.RWMutex
 	transactions map[string]*Transaction
 	maxSize      int
+	handlersMu   sync.RWMutex
+	handlers     []TransactionHandler
 }
 
 // NewMempool creates a new mempool
@@ -30,8 +65,34 @@ func NewMempool(maxSize int) *Mempool {
 	}
 }
 
+// OnTransactionAdded registers a handler that runs for every new transaction
+func (m *Mempool) OnTransactionAdded(handler TransactionHandler) {
+	m.handlersMu.Lock()
+	defer m.handlersMu.Unlock()
+
+	m.handlers = append(m.handlers, handler)
+}
+
 // AddTransaction adds a transaction to the mempool
 func (m *Mempool) AddTransaction(tx *Transaction) error {
+	if !m.addTransaction(tx) {
+		return nil
+	}
+
+	// Notify handlers outside the lock so they can read the mempool
+	m.handlersMu.RLock()
+	handlers := m.handlers
+	m.handlersMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(tx)
+	}
+
+	return nil
+}
+
+// addTransaction stores the transaction and reports whether it was new
+func (m *Mempool) addTransaction(tx *Transaction) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -43,11 +104,11 @@ func (m *Mempool) AddTransaction(tx *Transaction) error {
 
 	// Check if transaction already exists
 	if _, exists := m.transactions[tx.ID]; exists {
-		return nil // Transaction already exists
+		return false
 	}
 
 	m.transactions[tx.ID] = tx
-	return nil
+	return true
 }
 
 // GetTransaction retrieves a transaction by ID
@@ -67,6 +128,21 @@ func (m *Mempool) RemoveTransaction(id string) {
 	delete(m.transactions, id)
 }
 
+// RemovePayload removes the transactions included in an accepted vertex payload
+func (m *Mempool) RemovePayload(data []byte) {
+	entries, err := ledger.DecodePayload(data)
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, entry := range entries {
+		delete(m.transactions, ledger.EntryID(entry))
+	}
+}
+
 // GetTransactions returns all transactions in the mempool
 func (m *Mempool) GetTransactions() []*Transaction {
 	m.mu.RLock()
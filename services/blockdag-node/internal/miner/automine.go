@@ -0,0 +1,134 @@
+package miner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/mempool"
+)
+
+// MaxForcedVertices bounds the vertices a single Mine call produces
+const MaxForcedVertices = 1000
+
+// Mine produces n vertices one after another from the current tips and
+// mempool, including empty ones. It searches for nonces with the
+// configured threads unless the first one already meets the target, as
+// on a devnet.
+func (m *Miner) Mine(ctx context.Context, n int) ([]*dag.Vertex, error) {
+	if n <= 0 || n > MaxForcedVertices {
+		return nil, fmt.Errorf("vertex count must be between 1 and %d", MaxForcedVertices)
+	}
+	if !m.synced() {
+		return nil, errNotSynced
+	}
+
+	m.forceMu.Lock()
+	defer m.forceMu.Unlock()
+
+	m.mu.RLock()
+	threads := m.threads
+	m.mu.RUnlock()
+
+	vertices := make([]*dag.Vertex, 0, n)
+	for i := 0; i < n; i++ {
+		template, err := m.templates.Build()
+		if err != nil {
+			return vertices, err
+		}
+		for _, id := range template.Stale {
+			m.mempool.RemoveTransaction(id)
+		}
+
+		vertex := m.newVertex(template, m.MiningAddress())
+		started := time.Now()
+		if m.meetsTarget(vertex.Header()) {
+			vertex.Hash = vertex.CalculateHash()
+		} else if vertex, err = m.findNonce(ctx, vertex, threads); err != nil {
+			return vertices, err
+		}
+
+		if err := m.commitVertex(vertex, template.Transactions); err != nil {
+			return vertices, err
+		}
+
+		m.telemetry.recordFound(vertex.ID, time.Since(started))
+		vertices = append(vertices, vertex)
+	}
+
+	return vertices, nil
+}
+
+// AutoMiner produces vertices on demand for development networks: one
+// for every transaction entering the mempool, or one per interval
+type AutoMiner struct {
+	miner    *Miner
+	interval time.Duration
+	wake     chan struct{} // signalled when a transaction arrives
+}
+
+// NewAutoMiner creates an auto miner. With a zero interval it mines a
+// vertex soon after each new transaction; transactions that arrive while
+// a vertex is being mined share the next one.
+func NewAutoMiner(miner *Miner, mempool *mempool.Mempool, interval time.Duration) *AutoMiner {
+	a := &AutoMiner{
+		miner:    miner,
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+	}
+
+	if interval == 0 {
+		mempool.OnTransactionAdded(a.onTransactionAdded)
+	}
+	return a
+}
+
+// Start runs the auto miner until ctx is cancelled
+func (a *AutoMiner) Start(ctx context.Context) {
+	var ticks <-chan time.Time // nil, never ready, when mining per transaction
+	if a.interval == 0 {
+		log.Println("Auto-mining a vertex per transaction")
+	} else {
+		log.Printf("Auto-mining a vertex every %s", a.interval)
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.wake:
+			a.mine(ctx)
+		case <-ticks:
+			a.mine(ctx)
+		}
+	}
+}
+
+// onTransactionAdded wakes the mining goroutine. It runs in the mempool
+// handler, often on a peer's read goroutine, so it must not mine itself.
+func (a *AutoMiner) onTransactionAdded(tx *mempool.Transaction) {
+	select {
+	case a.wake <- struct{}{}:
+	default: // a vertex is already due
+	}
+}
+
+// mine produces one vertex, logging failures. Nothing is mined while the
+// DAG is syncing.
+func (a *AutoMiner) mine(ctx context.Context) {
+	if !a.miner.synced() {
+		return
+	}
+
+	vertices, err := a.miner.Mine(ctx, 1)
+	if err != nil {
+		log.Printf("Auto-mining error: %v", err)
+		return
+	}
+	log.Printf("Auto-mined vertex %s", vertices[0].ID)
+}
@@ -7,80 +7,255 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
+	"math"
 	"math/big"
+	"runtime"
 	"sync"
 	"time"
 
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/clock"
 	"hackodisha/blockdag-node/internal/consensus"
 	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
 	"hackodisha/blockdag-node/internal/mempool"
+	"hackodisha/blockdag-node/internal/pow"
 )
 
+// maxNonce bounds the nonce space searched for one header before the
+// timestamp is rolled forward
+const maxNonce = math.MaxUint32
+
+// checkInterval is how many nonces a worker tries between cancellation
+// checks; small enough that memory-hard algorithms still stop promptly
+const checkInterval = 1 << 8
+
+// MaxThreads bounds the worker goroutines of a miner
+func MaxThreads() int {
+	return 4 * runtime.NumCPU()
+}
+
+// errNotSynced is returned for mining requests while the DAG is catching up
+var errNotSynced = fmt.Errorf("node is still syncing the DAG")
+
+// StatusHandler is called after the mining loop starts or stops
+type StatusHandler func(mining bool)
+
 // Miner implements Proof of Work mining for BlockDAG
 type Miner struct {
 	dagStore        *dag.Store
 	consensusEngine *consensus.Engine
 	mempool         *mempool.Mempool
+	templates       *TemplateBuilder
+	params          *chaincfg.Params
+	algorithm       pow.Algorithm
 	target          *big.Int
+	threads         int
 	mu              sync.RWMutex
 	mining          bool
-	stopChan        chan struct{}
+	miningAddress   string      // receives the rewards of mined vertices
+	isSynced        func() bool // reports whether the DAG has caught up; nil if always
+	telemetry       *telemetry
+	clock           clock.Clock // stamps vertices and issued work
+	commitMu        sync.Mutex  // serializes adding mined vertices
+	forceMu         sync.Mutex  // serializes Mine calls
+
+	// The running mining loop; runMu serializes Start and Stop
+	runMu     sync.Mutex
+	runCancel context.CancelFunc
+	runDone   chan struct{}
+
+	handlersMu sync.RWMutex
+	handlers   []StatusHandler
+
+	// Work handed out to external miners
+	workMu      sync.Mutex
+	work        map[string]*issuedWork
+	workVersion uint64
+	workStale   chan struct{} // closed when the latest work goes stale
+	workFee     float64       // lowest fee rate in the latest work
+
+	// The template being searched and how to abandon it
+	templateMu     sync.Mutex
+	templateCancel context.CancelFunc
+	templateFee    float64 // lowest fee rate in the template
 }
 
-// NewMiner creates a new miner
-func NewMiner(dagStore *dag.Store, consensusEngine *consensus.Engine, mempool *mempool.Mempool) *Miner {
-	// Set a simple target (in production, this would be dynamic)
-	target := big.NewInt(1)
-	target.Lsh(target, 256-16) // 16 leading zeros
+// NewMiner creates a new miner that searches with the given number of
+// worker goroutines, or one per CPU if threads is not positive, and at
+// most MaxThreads
+func NewMiner(dagStore *dag.Store, consensusEngine *consensus.Engine, mempool *mempool.Mempool, templates *TemplateBuilder, params *chaincfg.Params, threads int) *Miner {
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	threads = min(threads, MaxThreads())
 
-	return &Miner{
+	m := &Miner{
 		dagStore:        dagStore,
 		consensusEngine: consensusEngine,
 		mempool:         mempool,
-		target:          target,
-		stopChan:        make(chan struct{}),
+		templates:       templates,
+		params:          params,
+		algorithm:       params.PowAlgorithm,
+		target:          params.Target(),
+		threads:         threads,
+		telemetry:       newTelemetry(),
+		clock:           clock.System,
+		work:            make(map[string]*issuedWork),
+		workStale:       make(chan struct{}),
+		workFee:         math.Inf(1),
 	}
+
+	// New tips or better transactions make the current template stale
+	dagStore.OnVertexAdded(m.onVertexAdded)
+	mempool.OnTransactionAdded(m.onTransactionAdded)
+
+	return m
 }
 
-// Start begins the mining process
-func (m *Miner) Start(ctx context.Context) error {
-	m.mu.Lock()
-	if m.mining {
-		m.mu.Unlock()
+// SetClock replaces the system clock that stamps vertices and issued
+// work, for instance with a simulation's virtual one. Hash rates and
+// pacing keep the system clock. It must be called before mining.
+func (m *Miner) SetClock(clock clock.Clock) {
+	m.clock = clock
+}
+
+// Start launches the mining loop with the given number of worker
+// goroutines, at most MaxThreads, or the current number if threads is not
+// positive. A stopped miner can be started again.
+func (m *Miner) Start(threads int) error {
+	if threads > MaxThreads() {
+		return fmt.Errorf("threads must be at most %d", MaxThreads())
+	}
+
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	if m.runCancel != nil {
 		return fmt.Errorf("miner is already running")
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	m.mu.Lock()
+	if threads > 0 {
+		m.threads = threads
+	}
 	m.mining = true
+	threads = m.threads
 	m.mu.Unlock()
 
-	log.Println("Starting miner...")
+	m.runCancel = cancel
+	m.runDone = done
+	m.telemetry.reset(threads)
 
-	for {
-		select {
-		case <-ctx.Done():
-			m.mu.Lock()
-			m.mining = false
-			m.mu.Unlock()
-			return ctx.Err()
-		case <-m.stopChan:
-			m.mu.Lock()
-			m.mining = false
-			m.mu.Unlock()
-			return nil
-		default:
-			if err := m.mineBlock(); err != nil {
-				log.Printf("Mining error: %v", err)
-				time.Sleep(1 * time.Second)
+	log.Printf("Starting miner with %d threads...", threads)
+	go func() {
+		defer close(done)
+		m.run(ctx, threads)
+	}()
+
+	m.notifyStatus(true)
+	return nil
+}
+
+// Stop stops the mining loop and waits for it to exit. It reports whether
+// the miner was running.
+func (m *Miner) Stop() bool {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	if m.runCancel == nil {
+		return false
+	}
+
+	m.runCancel()
+	<-m.runDone
+	m.runCancel = nil
+	m.runDone = nil
+
+	m.mu.Lock()
+	m.mining = false
+	m.mu.Unlock()
+
+	log.Println("Miner stopped")
+	m.notifyStatus(false)
+	return true
+}
+
+// OnStatusChanged registers a handler that runs whenever the mining loop
+// starts or stops
+func (m *Miner) OnStatusChanged(handler StatusHandler) {
+	m.handlersMu.Lock()
+	defer m.handlersMu.Unlock()
+
+	m.handlers = append(m.handlers, handler)
+}
+
+// notifyStatus runs the status handlers
+func (m *Miner) notifyStatus(mining bool) {
+	m.handlersMu.RLock()
+	handlers := m.handlers
+	m.handlersMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(mining)
+	}
+}
+
+// run mines vertices until ctx is cancelled
+func (m *Miner) run(ctx context.Context, threads int) {
+	for ctx.Err() == nil {
+		if err := m.mineBlock(ctx, threads); err != nil {
+			log.Printf("Mining error: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(1 * time.Second):
 			}
 		}
 	}
 }
 
-// Stop stops the mining process
-func (m *Miner) Stop() {
-	select {
-	case m.stopChan <- struct{}{}:
-	default:
+// SetMiningAddress sets the address credited with the rewards of mined vertices
+func (m *Miner) SetMiningAddress(address string) error {
+	if err := ledger.ValidateAddress(address); err != nil {
+		return err
 	}
+
+	m.mu.Lock()
+	changed := m.miningAddress != address
+	m.miningAddress = address
+	m.mu.Unlock()
+
+	if changed {
+		m.invalidateTemplate("mining address changed")
+	}
+	return nil
+}
+
+// SetSyncCheck holds mining back while isSynced reports false, so the node
+// does not mine on an outdated view of the DAG
+func (m *Miner) SetSyncCheck(isSynced func() bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.isSynced = isSynced
+}
+
+// synced reports whether mining may go ahead
+func (m *Miner) synced() bool {
+	m.mu.RLock()
+	isSynced := m.isSynced
+	m.mu.RUnlock()
+
+	return isSynced == nil || isSynced()
+}
+
+// MiningAddress returns the address credited with the rewards of mined vertices
+func (m *Miner) MiningAddress() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.miningAddress
 }
 
 // IsMining returns whether the miner is currently mining
@@ -91,37 +266,75 @@ func (m *Miner) IsMining() bool {
 }
 
 // mineBlock attempts to mine a new block
-func (m *Miner) mineBlock() error {
-	// Get current tips
-	tips := m.dagStore.GetTips()
-
-	// Get transactions from mempool
-	transactions := m.mempool.GetTransactions()
-	if len(transactions) == 0 {
-		// No transactions to mine, wait a bit
-		time.Sleep(100 * time.Millisecond)
+func (m *Miner) mineBlock(ctx context.Context, threads int) error {
+	if !m.synced() {
+		// Wait for the DAG to catch up
+		select {
+		case <-ctx.Done():
+		case <-time.After(1 * time.Second):
+		}
 		return nil
 	}
 
-	// Create new vertex
-	vertex := &dag.Vertex{
-		ID:        generateVertexID(),
-		Parents:   tips,
-		Timestamp: time.Now(),
-		Weight:    1, // Base weight
+	template, err := m.templates.Build()
+	if err != nil {
+		return err
 	}
 
-	// Add transaction data
-	vertex.Data = m.packTransactions(transactions)
+	// Drop transactions whose nonce has already been used
+	for _, id := range template.Stale {
+		m.mempool.RemoveTransaction(id)
+	}
 
-	// Mine the block (find nonce)
-	nonce, err := m.findNonce(vertex)
+	if len(template.Transactions) == 0 {
+		// No transactions to mine, wait a bit
+		select {
+		case <-ctx.Done():
+		case <-time.After(100 * time.Millisecond):
+		}
+		return nil
+	}
+
+	vertex := m.newVertex(template, m.MiningAddress())
+
+	// Search until solved, stopped, or the template goes stale
+	searchCtx := m.beginTemplate(ctx, template.Transactions)
+	started := time.Now()
+	solved, err := m.findNonce(searchCtx, vertex, threads)
+	m.endTemplate()
 	if err != nil {
+		// Stopped, or the template went stale and is rebuilt next round
+		return nil
+	}
+	vertex = solved
+
+	if err := m.commitVertex(vertex, template.Transactions); err != nil {
 		return err
 	}
 
-	vertex.Nonce = nonce
-	vertex.Hash = vertex.CalculateHash()
+	m.telemetry.recordFound(vertex.ID, time.Since(started))
+	log.Printf("Mined block %s with nonce %d", vertex.ID, vertex.Nonce)
+	return nil
+}
+
+// newVertex creates an unsolved vertex from a template
+func (m *Miner) newVertex(template *Template, coinbase string) *dag.Vertex {
+	return &dag.Vertex{
+		ID:          generateVertexID(),
+		Data:        template.Data,
+		PayloadRoot: template.PayloadRoot,
+		Coinbase:    coinbase,
+		Parents:     template.Parents,
+		Timestamp:   m.clock.Now(),
+		Weight:      m.params.VertexWeight(),
+	}
+}
+
+// commitVertex validates a solved vertex, adds it to the DAG and removes
+// its transactions from the mempool
+func (m *Miner) commitVertex(vertex *dag.Vertex, transactions []*mempool.Transaction) error {
+	m.commitMu.Lock()
+	defer m.commitMu.Unlock()
 
 	// Validate the vertex
 	if err := m.consensusEngine.IsValidVertex(vertex); err != nil {
@@ -137,43 +350,143 @@ func (m *Miner) mineBlock() error {
 	for _, tx := range transactions {
 		m.mempool.RemoveTransaction(tx.ID)
 	}
-
-	log.Printf("Mined block %s with nonce %d", vertex.ID, nonce)
 	return nil
 }
 
-// findNonce finds a valid nonce for the vertex
-func (m *Miner) findNonce(vertex *dag.Vertex) (uint64, error) {
-	// Simple PoW implementation
-	for nonce := uint64(0); nonce < 1000000; nonce++ {
-		vertex.Nonce = nonce
-		hash := vertex.CalculateHash()
+// beginTemplate records the template being searched and returns a context
+// that is cancelled when it goes stale
+func (m *Miner) beginTemplate(ctx context.Context, transactions []*mempool.Transaction) context.Context {
+	searchCtx, cancel := context.WithCancel(ctx)
 
-		// Convert hash to big.Int
-		hashBytes, err := hex.DecodeString(hash)
-		if err != nil {
-			continue
-		}
+	lowest := math.Inf(1)
+	for _, tx := range transactions {
+		lowest = math.Min(lowest, tx.FeeRate())
+	}
 
-		hashInt := new(big.Int).SetBytes(hashBytes)
+	m.templateMu.Lock()
+	m.templateCancel = cancel
+	m.templateFee = lowest
+	m.templateMu.Unlock()
 
-		// Check if hash meets target
-		if hashInt.Cmp(m.target) < 0 {
-			return nonce, nil
-		}
+	return searchCtx
+}
+
+// endTemplate releases the current template
+func (m *Miner) endTemplate() {
+	m.templateMu.Lock()
+	defer m.templateMu.Unlock()
+
+	if m.templateCancel != nil {
+		m.templateCancel()
+		m.templateCancel = nil
 	}
+	m.templateFee = math.Inf(1)
+}
 
-	return 0, fmt.Errorf("could not find valid nonce")
+// onVertexAdded invalidates the templates when the tips change
+func (m *Miner) onVertexAdded(vertex *dag.Vertex) {
+	m.invalidateTemplate("new tip " + vertex.ID)
+	m.invalidateWork()
 }
 
-// packTransactions packs transactions into vertex data
-func (m *Miner) packTransactions(transactions []*mempool.Transaction) []byte {
-	// Simple packing - in production, this would be more sophisticated
-	data := make([]byte, 0)
-	for _, tx := range transactions {
-		data = append(data, tx.Data...)
+// onTransactionAdded invalidates a template when a transaction pays a
+// better fee rate than the worst one it includes
+func (m *Miner) onTransactionAdded(tx *mempool.Transaction) {
+	m.templateMu.Lock()
+	better := tx.FeeRate() > m.templateFee
+	m.templateMu.Unlock()
+
+	if better {
+		m.invalidateTemplate("better transaction " + tx.ID)
+	}
+
+	m.workMu.Lock()
+	betterWork := tx.FeeRate() > m.workFee
+	m.workMu.Unlock()
+
+	if betterWork {
+		m.invalidateWork()
 	}
-	return data
+}
+
+// invalidateTemplate abandons the current search so it is rebuilt
+func (m *Miner) invalidateTemplate(reason string) {
+	m.templateMu.Lock()
+	defer m.templateMu.Unlock()
+
+	if m.templateCancel != nil {
+		log.Printf("Mining template stale: %s", reason)
+		m.templateCancel()
+		m.templateCancel = nil
+		m.telemetry.recordStale()
+	}
+}
+
+// findNonce searches for a valid nonce with one worker per thread, each
+// covering an interleaved slice of the nonce space. A worker that exhausts
+// its slice rolls its copy of the timestamp forward and starts over.
+func (m *Miner) findNonce(ctx context.Context, vertex *dag.Vertex, threads int) (*dag.Vertex, error) {
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	found := make(chan *dag.Vertex, threads)
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < threads; worker++ {
+		wg.Add(1)
+		go func(start uint64) {
+			defer wg.Done()
+			if solved := m.searchNonces(workerCtx, *vertex, start, uint64(threads)); solved != nil {
+				found <- solved
+			}
+		}(uint64(worker))
+	}
+
+	// Close the channel once every worker has returned
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	solved, ok := <-found
+	cancel()
+	if !ok {
+		return nil, ctx.Err()
+	}
+	return solved, nil
+}
+
+// searchNonces tries nonces start, start+stride, ... on its own copy of the vertex
+func (m *Miner) searchNonces(ctx context.Context, vertex dag.Vertex, start, stride uint64) *dag.Vertex {
+	worker := int(start)
+	m.telemetry.startWorker(worker)
+
+	tried := 0
+	for {
+		for nonce := start; nonce <= maxNonce; nonce += stride {
+			if tried++; tried%checkInterval == 0 {
+				m.telemetry.recordHashes(worker, checkInterval)
+				if ctx.Err() != nil {
+					return nil
+				}
+			}
+
+			vertex.Nonce = nonce
+			if m.meetsTarget(vertex.Header()) {
+				m.telemetry.recordHashes(worker, uint64(tried%checkInterval))
+				vertex.Hash = vertex.CalculateHash()
+				return &vertex
+			}
+		}
+
+		// Nonce space exhausted; roll the timestamp to get a fresh header
+		vertex.Timestamp = vertex.Timestamp.Add(time.Second)
+	}
+}
+
+// meetsTarget reports whether the header's proof-of-work hash meets the target
+func (m *Miner) meetsTarget(header *dag.Header) bool {
+	return m.algorithm.CheckTarget(m.algorithm.Hash(header), m.target)
 }
 
 // generateVertexID generates a unique vertex ID
@@ -184,15 +497,58 @@ func generateVertexID() string {
 	return hex.EncodeToString(hash[:8])
 }
 
+// Stats are the miner's current statistics
+type Stats struct {
+	Mining            bool      `json:"mining"`
+	Threads           int       `json:"threads"`
+	MiningAddress     string    `json:"mining_address"`
+	Network           string    `json:"network"`
+	PowAlgorithm      string    `json:"pow_algorithm"`
+	Target            string    `json:"target"`
+	ProofOfWork       bool      `json:"proof_of_work"`
+	Synced            bool      `json:"synced"`
+	MempoolSize       int       `json:"mempool_size"`
+	CurrentTips       int       `json:"current_tips"`
+	Hashrate          float64   `json:"hashrate"`
+	WorkerHashrates   []float64 `json:"worker_hashrates"`
+	TotalHashes       uint64    `json:"total_hashes"`
+	VerticesFound     uint64    `json:"vertices_found"`
+	VerticesSubmitted uint64    `json:"vertices_submitted"`
+	StaleTemplates    uint64    `json:"stale_templates"`
+	AvgSolveSeconds   float64   `json:"avg_solve_seconds"`
+}
+
 // GetMiningStats returns current mining statistics
-func (m *Miner) GetMiningStats() map[string]interface{} {
+func (m *Miner) GetMiningStats() Stats {
+	workerRates := m.telemetry.hashRates()
+	var hashRate float64
+	for _, rate := range workerRates {
+		hashRate += rate
+	}
+
+	counters := m.telemetry.snapshot()
+	synced := m.synced()
+
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	return map[string]interface{}{
-		"mining":       m.mining,
-		"target":       m.target.Text(16),
-		"mempool_size": m.mempool.GetTransactionCount(),
-		"current_tips": len(m.dagStore.GetTips()),
+	return Stats{
+		Mining:            m.mining,
+		Threads:           m.threads,
+		MiningAddress:     m.miningAddress,
+		Network:           m.params.Name,
+		PowAlgorithm:      m.algorithm.Name(),
+		Target:            fmt.Sprintf("%064x", m.target),
+		ProofOfWork:       m.params.RequiresPoW(),
+		Synced:            synced,
+		MempoolSize:       m.mempool.GetTransactionCount(),
+		CurrentTips:       len(m.dagStore.GetTips()),
+		Hashrate:          hashRate,
+		WorkerHashrates:   workerRates,
+		TotalHashes:       counters.totalHashes,
+		VerticesFound:     counters.found,
+		VerticesSubmitted: counters.submitted,
+		StaleTemplates:    counters.stale,
+		AvgSolveSeconds:   counters.avgSolveTime.Seconds(),
 	}
 }
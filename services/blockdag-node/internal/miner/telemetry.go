@@ -0,0 +1,263 @@
+package miner
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"hackodisha/blockdag-node/internal/consensus"
+)
+
+// hashRateWindow is the time constant of each worker's moving average
+const hashRateWindow = 10 * time.Second
+
+// hashRateIdle is how long a worker may go without reporting before its
+// hash rate reads as zero
+const hashRateIdle = 5 * time.Second
+
+// telemetry records what the miner has done since the node started
+type telemetry struct {
+	mu          sync.Mutex
+	workers     []workerRate
+	totalHashes uint64
+	found       uint64 // vertices mined by the node's own workers
+	submitted   uint64 // vertices solved by external miners
+	stale       uint64 // templates abandoned before they were solved
+	solveTime   time.Duration
+	own         map[string]bool // IDs of vertices found or submitted and not yet final
+
+	// Colors of the node's vertices merged by finalized chain vertices,
+	// which no longer change. colorsMu serializes folding them in.
+	colorsMu  sync.Mutex
+	finalTip  string // the newest chain vertex folded into the counts
+	finalBlue int
+	finalRed  int
+}
+
+// colorFinalityDepth is how deep in the selected chain a vertex's coloring
+// is final, as for finalized vertices
+const colorFinalityDepth = consensus.FinalityDepth
+
+// workerRate is the exponential moving average of one worker's hash rate
+type workerRate struct {
+	rate float64
+	last time.Time
+}
+
+func newTelemetry() *telemetry {
+	return &telemetry{
+		own: make(map[string]bool),
+	}
+}
+
+// reset sizes the worker rates for a new mining run
+func (t *telemetry) reset(threads int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.workers = make([]workerRate, threads)
+}
+
+// startWorker marks the start of a worker's search so time spent
+// building templates does not count against its rate
+func (t *telemetry) startWorker(worker int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if worker < len(t.workers) {
+		t.workers[worker].last = time.Now()
+	}
+}
+
+// recordHashes folds the hashes a worker computed since its last report
+// into its moving average
+func (t *telemetry) recordHashes(worker int, hashes uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.totalHashes += hashes
+	if worker >= len(t.workers) {
+		return
+	}
+
+	now := time.Now()
+	w := &t.workers[worker]
+	elapsed := now.Sub(w.last)
+	if w.last.IsZero() || elapsed <= 0 {
+		w.last = now
+		return
+	}
+
+	// Weight the sample by how much of the window it covers
+	alpha := 1 - math.Exp(-elapsed.Seconds()/hashRateWindow.Seconds())
+	w.rate += alpha * (float64(hashes)/elapsed.Seconds() - w.rate)
+	w.last = now
+}
+
+// recordFound counts a vertex mined by the node's workers
+func (t *telemetry) recordFound(vertexID string, solveTime time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.found++
+	t.solveTime += solveTime
+	t.own[vertexID] = true
+}
+
+// recordSubmitted counts a vertex solved by an external miner
+func (t *telemetry) recordSubmitted(vertexID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.submitted++
+	t.own[vertexID] = true
+}
+
+// recordStale counts an abandoned template
+func (t *telemetry) recordStale() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stale++
+}
+
+// telemetryCounters is a consistent copy of the telemetry counters
+type telemetryCounters struct {
+	totalHashes, found, submitted, stale uint64
+	avgSolveTime                         time.Duration
+}
+
+// snapshot copies the counters
+func (t *telemetry) snapshot() telemetryCounters {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counters := telemetryCounters{
+		totalHashes: t.totalHashes,
+		found:       t.found,
+		submitted:   t.submitted,
+		stale:       t.stale,
+	}
+	if t.found > 0 {
+		counters.avgSolveTime = t.solveTime / time.Duration(t.found)
+	}
+	return counters
+}
+
+// hashRates returns each worker's average, zero for idle workers
+func (t *telemetry) hashRates() []float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rates := make([]float64, len(t.workers))
+	for i, w := range t.workers {
+		if time.Since(w.last) < hashRateIdle {
+			rates[i] = w.rate
+		}
+	}
+	return rates
+}
+
+// ownVertices returns the IDs of the node's vertices that are not final
+func (t *telemetry) ownVertices() map[string]bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	own := make(map[string]bool, len(t.own))
+	for id := range t.own {
+		own[id] = true
+	}
+	return own
+}
+
+// finalize folds the colors of own vertices in a final mergeset into the
+// counts and forgets their IDs
+func (t *telemetry) finalize(chainID string, blues, reds []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, id := range blues {
+		if t.own[id] {
+			delete(t.own, id)
+			t.finalBlue++
+		}
+	}
+	for _, id := range reds {
+		if t.own[id] {
+			delete(t.own, id)
+			t.finalRed++
+		}
+	}
+	t.finalTip = chainID
+}
+
+// OwnVertexColors counts the vertices this node produced by their
+// GHOSTDAG color along the heaviest chain. Vertices the chain has not
+// merged yet are pending. Only the chain above the last final vertex is
+// walked; colors below it are kept as counts.
+func (m *Miner) OwnVertexColors() (blue, red, pending int, err error) {
+	t := m.telemetry
+	t.colorsMu.Lock()
+	defer t.colorsMu.Unlock()
+
+	tips := m.dagStore.GetTips()
+	if len(tips) == 0 {
+		return 0, 0, 0, nil
+	}
+	sorted, err := m.consensusEngine.SortByBlueWork(tips)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	// Walk down to the last final vertex, tip first
+	chain := make([]*consensus.GhostdagData, 0)
+	ids := make([]string, 0)
+	id := sorted[0]
+	for id != "" && id != t.finalTip {
+		data, err := m.consensusEngine.GetGhostdagData(id)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		chain = append(chain, data)
+		ids = append(ids, id)
+		id = data.SelectedParent
+	}
+
+	// Fold in the mergesets that became final, oldest first. A chain that
+	// no longer holds the last final vertex is not folded again.
+	if id != t.finalTip && len(chain) > colorFinalityDepth {
+		chain, ids = chain[:colorFinalityDepth], ids[:colorFinalityDepth]
+	}
+	for len(chain) > colorFinalityDepth {
+		last := len(chain) - 1
+		t.finalize(ids[last], chain[last].MergeSetBlues, chain[last].MergeSetReds)
+		chain, ids = chain[:last], ids[:last]
+	}
+
+	own := t.ownVertices()
+	colored := make(map[string]bool)
+	for _, data := range chain {
+		for _, id := range data.MergeSetBlues {
+			if own[id] && !colored[id] {
+				colored[id] = true
+				blue++
+			}
+		}
+		for _, id := range data.MergeSetReds {
+			if own[id] && !colored[id] {
+				colored[id] = true
+				red++
+			}
+		}
+	}
+
+	// The chain tip is blue but in no mergeset yet
+	if tip := sorted[0]; own[tip] && !colored[tip] {
+		colored[tip] = true
+		blue++
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.finalBlue + blue, t.finalRed + red, len(own) - blue - red, nil
+}
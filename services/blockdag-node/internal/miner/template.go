@@ -0,0 +1,191 @@
+package miner
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/internal/mempool"
+)
+
+// TemplateConfig bounds the vertices the template builder produces
+type TemplateConfig struct {
+	MaxVertexSize int // bytes of encoded transaction payload, at most chaincfg.MaxPayloadSize
+	MaxParents    int
+}
+
+// DefaultTemplateConfig returns the default template limits
+func DefaultTemplateConfig() TemplateConfig {
+	return TemplateConfig{
+		MaxVertexSize: chaincfg.MaxPayloadSize,
+		MaxParents:    10,
+	}
+}
+
+// Template is the content of a vertex waiting for a nonce
+type Template struct {
+	Parents      []string
+	Transactions []*mempool.Transaction
+	Data         []byte // the transactions as a length-prefixed list, see ledger.EncodePayload
+	PayloadRoot  string
+	Fees         uint64
+	Stale        []string // mempool transactions whose nonce has already been used
+}
+
+// TemplateBuilder assembles vertex templates from the tips and the mempool
+type TemplateBuilder struct {
+	dagStore        *dag.Store
+	consensusEngine *consensus.Engine
+	mempool         *mempool.Mempool
+	state           *ledger.State
+	config          TemplateConfig
+}
+
+// NewTemplateBuilder creates a template builder. A MaxVertexSize of 0 or
+// above the consensus limit is clamped to chaincfg.MaxPayloadSize.
+func NewTemplateBuilder(dagStore *dag.Store, consensusEngine *consensus.Engine, mempool *mempool.Mempool, state *ledger.State, config TemplateConfig) *TemplateBuilder {
+	if config.MaxVertexSize <= 0 || config.MaxVertexSize > chaincfg.MaxPayloadSize {
+		config.MaxVertexSize = chaincfg.MaxPayloadSize
+	}
+
+	return &TemplateBuilder{
+		dagStore:        dagStore,
+		consensusEngine: consensusEngine,
+		mempool:         mempool,
+		state:           state,
+		config:          config,
+	}
+}
+
+// Build assembles a template: the tips with the most blue work as parents,
+// and the best paying transactions that fit, in an order that keeps each
+// sender's nonces consecutive
+func (b *TemplateBuilder) Build() (*Template, error) {
+	parents, err := b.selectParents()
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, stale := b.selectTransactions()
+
+	entries := make([][]byte, len(transactions))
+	var fees uint64
+	for i, tx := range transactions {
+		entries[i] = tx.Data
+		fees += tx.Fee
+	}
+
+	data := ledger.EncodePayload(entries)
+	payloadRoot, err := ledger.PayloadRoot(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{
+		Parents:      parents,
+		Transactions: transactions,
+		Data:         data,
+		PayloadRoot:  payloadRoot,
+		Fees:         fees,
+		Stale:        stale,
+	}, nil
+}
+
+// selectParents picks up to MaxParents tips, heaviest blue work first
+func (b *TemplateBuilder) selectParents() ([]string, error) {
+	tips, err := b.consensusEngine.SortByBlueWork(b.dagStore.GetTips())
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank tips: %v", err)
+	}
+
+	if b.config.MaxParents > 0 && len(tips) > b.config.MaxParents {
+		tips = tips[:b.config.MaxParents]
+	}
+	return tips, nil
+}
+
+// selectTransactions greedily takes the highest fee rate transaction whose
+// sender has no earlier nonce pending, until the payload is full. Once a
+// sender's transaction does not fit, its later nonces are skipped too.
+func (b *TemplateBuilder) selectTransactions() ([]*mempool.Transaction, []string) {
+	queues := make(map[string][]*mempool.Transaction)
+	candidates := &feeHeap{}
+	stale := make([]string, 0)
+
+	for _, tx := range b.mempool.GetTransactions() {
+		if tx.Sender == "" {
+			heap.Push(candidates, tx) // opaque data has no ordering constraint
+			continue
+		}
+		queues[tx.Sender] = append(queues[tx.Sender], tx)
+	}
+
+	// Each sender's queue must start at the account nonce with no gaps
+	for sender, queue := range queues {
+		sort.Slice(queue, func(i, j int) bool { return queue[i].Nonce < queue[j].Nonce })
+
+		next := b.state.GetAccount(sender).Nonce
+		ready := make([]*mempool.Transaction, 0, len(queue))
+		for _, tx := range queue {
+			switch {
+			case tx.Nonce < next:
+				stale = append(stale, tx.ID)
+			case tx.Nonce == next:
+				ready = append(ready, tx)
+				next++
+			}
+		}
+
+		queues[sender] = ready
+		if len(ready) > 0 {
+			heap.Push(candidates, ready[0])
+		}
+	}
+
+	selected := make([]*mempool.Transaction, 0)
+	size := 0
+	for candidates.Len() > 0 {
+		tx := heap.Pop(candidates).(*mempool.Transaction)
+
+		entrySize := ledger.EntrySize(tx.Data)
+		if size+entrySize > b.config.MaxVertexSize {
+			continue
+		}
+		selected = append(selected, tx)
+		size += entrySize
+
+		// Unlock the sender's next nonce
+		if tx.Sender != "" {
+			queue := queues[tx.Sender][1:]
+			queues[tx.Sender] = queue
+			if len(queue) > 0 {
+				heap.Push(candidates, queue[0])
+			}
+		}
+	}
+
+	return selected, stale
+}
+
+// feeHeap is a max-heap of transactions by fee rate
+type feeHeap []*mempool.Transaction
+
+func (h feeHeap) Len() int { return len(h) }
+func (h feeHeap) Less(i, j int) bool {
+	if h[i].FeeRate() != h[j].FeeRate() {
+		return h[i].FeeRate() > h[j].FeeRate()
+	}
+	return h[i].ID < h[j].ID
+}
+func (h feeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *feeHeap) Push(x interface{}) { *h = append(*h, x.(*mempool.Transaction)) }
+func (h *feeHeap) Pop() interface{} {
+	old := *h
+	tx := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return tx
+}
@@ -0,0 +1,178 @@
+package miner
+
+import (
+	"fmt"
+	"testing"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/internal/mempool"
+	"hackodisha/blockdag-node/storage"
+)
+
+const sender = "0x00000000000000000000000000000000000000a1"
+
+// newTestBuilder returns a template builder over a DevNet DAG holding
+// only genesis, and the mempool it draws from
+func newTestBuilder(t *testing.T, config TemplateConfig) (*TemplateBuilder, *mempool.Mempool) {
+	t.Helper()
+	params := &chaincfg.DevNetParams
+	store := dag.NewStore(storage.NewMemoryDB())
+	if err := store.AddVertex(params.Genesis()); err != nil {
+		t.Fatalf("adding genesis: %v", err)
+	}
+	pool := mempool.NewMempool(100)
+	return NewTemplateBuilder(store, consensus.NewEngine(store, params), pool, ledger.NewState(), config), pool
+}
+
+// addTx puts a transaction into the mempool and returns it
+func addTx(t *testing.T, pool *mempool.Mempool, ltx *ledger.Transaction) *mempool.Transaction {
+	t.Helper()
+	tx, err := mempool.NewTransaction(ltx)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	if err := pool.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction: %v", err)
+	}
+	return tx
+}
+
+func TestBuildPayloadIsTheSelectedTransactions(t *testing.T) {
+	builder, pool := newTestBuilder(t, DefaultTemplateConfig())
+	for i := 0; i < 5; i++ {
+		addTx(t, pool, ledger.NewDataTransaction([]byte(fmt.Sprintf("note %d", i)), uint64(100+i)))
+	}
+
+	template, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	entries, err := ledger.DecodePayload(template.Data)
+	if err != nil {
+		t.Fatalf("DecodePayload: %v", err)
+	}
+	if len(entries) != 5 || len(template.Transactions) != 5 {
+		t.Fatalf("payload holds %d entries for %d transactions, want 5", len(entries), len(template.Transactions))
+	}
+
+	var fees uint64
+	for i, entry := range entries {
+		tx := template.Transactions[i]
+		if string(entry) != string(tx.Data) {
+			t.Errorf("entry %d is %q, want transaction %s", i, entry, tx.ID)
+		}
+		if _, err := ledger.ParseTransaction(entry); err != nil {
+			t.Errorf("entry %d does not parse: %v", i, err)
+		}
+		if i > 0 && template.Transactions[i-1].FeeRate() < tx.FeeRate() {
+			t.Errorf("transaction %d pays more per byte than the one before it", i)
+		}
+		fees += tx.Fee
+	}
+	if template.Fees != fees {
+		t.Errorf("fees %d, want %d", template.Fees, fees)
+	}
+	if root, _ := ledger.PayloadRoot(template.Data); template.PayloadRoot != root {
+		t.Errorf("payload root %s, want %s", template.PayloadRoot, root)
+	}
+}
+
+func TestBuildKeepsSenderNoncesInOrder(t *testing.T) {
+	builder, pool := newTestBuilder(t, DefaultTemplateConfig())
+
+	// Later nonces pay more, but cannot go before the earlier ones
+	for _, nonce := range []uint64{2, 0, 1} {
+		addTx(t, pool, &ledger.Transaction{Type: ledger.TypeTransfer, From: sender, To: "0xb", Amount: 1, Fee: 100 * (nonce + 1), Nonce: nonce})
+	}
+	gap := addTx(t, pool, &ledger.Transaction{Type: ledger.TypeTransfer, From: sender, To: "0xb", Amount: 1, Fee: 1000, Nonce: 5})
+
+	template, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if len(template.Transactions) != 3 {
+		t.Fatalf("selected %d transactions, want the three without a gap", len(template.Transactions))
+	}
+	for i, tx := range template.Transactions {
+		if tx.ID == gap.ID {
+			t.Error("selected a transaction after a nonce gap")
+		}
+		if tx.Nonce != uint64(i) {
+			t.Errorf("transaction %d has nonce %d", i, tx.Nonce)
+		}
+	}
+}
+
+func TestBuildRespectsMaxVertexSize(t *testing.T) {
+	config := DefaultTemplateConfig()
+	config.MaxVertexSize = 300
+	builder, pool := newTestBuilder(t, config)
+	for i := 0; i < 10; i++ {
+		addTx(t, pool, ledger.NewDataTransaction([]byte(fmt.Sprintf("note %d", i)), 100))
+	}
+
+	template, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if len(template.Data) > config.MaxVertexSize {
+		t.Errorf("payload of %d bytes, limit %d", len(template.Data), config.MaxVertexSize)
+	}
+	if len(template.Transactions) == 0 || len(template.Transactions) == 10 {
+		t.Errorf("selected %d of 10 transactions, want the limit to cut some", len(template.Transactions))
+	}
+
+	// Whatever was left out would not have fit
+	size := len(template.Data)
+	for _, tx := range pool.GetTransactions() {
+		selected := false
+		for _, chosen := range template.Transactions {
+			selected = selected || chosen.ID == tx.ID
+		}
+		if !selected && size+ledger.EntrySize(tx.Data) <= config.MaxVertexSize {
+			t.Errorf("left out transaction %s that fits", tx.ID)
+		}
+	}
+}
+
+func TestBuildSelectsHeaviestParents(t *testing.T) {
+	config := DefaultTemplateConfig()
+	config.MaxParents = 2
+	builder, _ := newTestBuilder(t, config)
+	params := &chaincfg.DevNetParams
+	genesis := params.Genesis().ID
+
+	// Three tips: a chain of two and two single vertices
+	add := func(id string, parents ...string) {
+		vertex := &dag.Vertex{ID: id, Parents: parents, Data: ledger.EncodePayload(nil), Timestamp: params.GenesisTime, Weight: params.VertexWeight()}
+		vertex.PayloadRoot, _ = ledger.PayloadRoot(vertex.Data)
+		vertex.Hash = vertex.CalculateHash()
+		if err := builder.dagStore.AddVertex(vertex); err != nil {
+			t.Fatalf("adding %s: %v", id, err)
+		}
+	}
+	add("a1", genesis)
+	add("a2", "a1")
+	add("b", genesis)
+	add("c", genesis)
+
+	template, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if len(template.Parents) != 2 || template.Parents[0] != "a2" {
+		t.Errorf("parents %v, want a2 first and at most 2", template.Parents)
+	}
+}
+
+func TestNewTemplateBuilderClampsMaxVertexSize(t *testing.T) {
+	for _, size := range []int{0, -1, chaincfg.MaxPayloadSize + 1} {
+		builder, _ := newTestBuilder(t, TemplateConfig{MaxVertexSize: size})
+		if builder.config.MaxVertexSize != chaincfg.MaxPayloadSize {
+			t.Errorf("MaxVertexSize %d became %d, want %d", size, builder.config.MaxVertexSize, chaincfg.MaxPayloadSize)
+		}
+	}
+}
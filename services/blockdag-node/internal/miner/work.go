@@ -0,0 +1,201 @@
+package miner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/internal/mempool"
+)
+
+// workTTL is how long issued work can still be submitted
+const workTTL = 2 * time.Minute
+
+// maxTimestampRoll bounds how far past the current time an external miner
+// may roll a header's timestamp
+const maxTimestampRoll = 2 * time.Minute
+
+// Work is a vertex template handed to an external miner. The miner
+// appends a decimal nonce to HeaderPreImage and hashes it with Algorithm
+// until the hash is at or below Target, then submits the header with that
+// nonce. It may roll the header timestamp forward for more nonce space,
+// which changes the pre-image the same way Header.PreImage does.
+type Work struct {
+	Header         *dag.Header `json:"header"`
+	HeaderPreImage string      `json:"header_preimage"`
+	Algorithm      string      `json:"algorithm"`
+	Target         string      `json:"target"`
+	PayTo          string      `json:"pay_to"`
+	Transactions   int         `json:"transactions"`
+	Fees           uint64      `json:"fees"`
+	Reward         uint64      `json:"reward"`
+	LongPollID     string      `json:"longpoll_id"`
+}
+
+// issuedWork is the vertex behind work handed to an external miner
+type issuedWork struct {
+	vertex       *dag.Vertex
+	transactions []*mempool.Transaction
+	issued       time.Time
+}
+
+// GetWork builds a template for an external miner paying to payTo, or to
+// the mining address if payTo is empty
+func (m *Miner) GetWork(payTo string) (*Work, error) {
+	if !m.synced() {
+		return nil, errNotSynced
+	}
+	if payTo == "" {
+		payTo = m.MiningAddress()
+	}
+	if payTo == "" {
+		return nil, fmt.Errorf("no pay-to address given and no mining address set")
+	}
+	if err := ledger.ValidateAddress(payTo); err != nil {
+		return nil, err
+	}
+
+	// Read the version first so a change during the build is not missed
+	m.workMu.Lock()
+	version := m.workVersion
+	m.workMu.Unlock()
+
+	template, err := m.templates.Build()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range template.Stale {
+		m.mempool.RemoveTransaction(id)
+	}
+
+	vertex := m.newVertex(template, payTo)
+
+	lowest := math.Inf(-1) // an empty template is improved by any transaction
+	if len(template.Transactions) > 0 {
+		lowest = math.Inf(1)
+		for _, tx := range template.Transactions {
+			lowest = math.Min(lowest, tx.FeeRate())
+		}
+	}
+
+	m.workMu.Lock()
+	m.pruneWork()
+	m.work[vertex.ID] = &issuedWork{
+		vertex:       vertex,
+		transactions: template.Transactions,
+		issued:       m.clock.Now(),
+	}
+	if version == m.workVersion {
+		m.workFee = lowest
+	}
+	m.workMu.Unlock()
+
+	header := vertex.Header()
+	return &Work{
+		Header:         header,
+		HeaderPreImage: header.PreImage(),
+		Algorithm:      m.algorithm.Name(),
+		Target:         fmt.Sprintf("%064x", m.target),
+		PayTo:          payTo,
+		Transactions:   len(template.Transactions),
+		Fees:           template.Fees,
+		Reward:         ledger.BlockReward,
+		LongPollID:     strconv.FormatUint(version, 10),
+	}, nil
+}
+
+// WaitForStaleWork blocks until work issued under longPollID goes stale
+// or ctx is done. It returns at once if the work is already stale.
+func (m *Miner) WaitForStaleWork(ctx context.Context, longPollID string) {
+	m.workMu.Lock()
+	if longPollID != strconv.FormatUint(m.workVersion, 10) {
+		m.workMu.Unlock()
+		return
+	}
+	stale := m.workStale
+	m.workMu.Unlock()
+
+	select {
+	case <-stale:
+	case <-ctx.Done():
+	}
+}
+
+// SubmitWork accepts a header solved by an external miner. The ID selects
+// the issued work; the timestamp and nonce are taken from the header, and
+// the hash, if present, must match.
+func (m *Miner) SubmitWork(header *dag.Header) (*dag.Vertex, error) {
+	m.workMu.Lock()
+	work, exists := m.work[header.ID]
+	m.workMu.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown or expired work %s", header.ID)
+	}
+
+	if header.Timestamp.Before(work.vertex.Timestamp.Truncate(time.Second)) {
+		return nil, fmt.Errorf("timestamp is before the work was issued")
+	}
+	if header.Timestamp.After(m.clock.Now().Add(maxTimestampRoll)) {
+		return nil, fmt.Errorf("timestamp is too far in the future")
+	}
+
+	vertex := *work.vertex
+	vertex.Timestamp = header.Timestamp
+	vertex.Nonce = header.Nonce
+	vertex.Hash = vertex.CalculateHash()
+
+	if header.Hash != "" && header.Hash != vertex.Hash {
+		return nil, fmt.Errorf("hash mismatch: expected %s, got %s", vertex.Hash, header.Hash)
+	}
+	if !m.meetsTarget(vertex.Header()) {
+		return nil, fmt.Errorf("proof of work for %s does not meet the target", vertex.Hash)
+	}
+
+	if err := m.consensusEngine.IsValidVertex(&vertex); err != nil {
+		return nil, fmt.Errorf("invalid vertex: %v", err)
+	}
+
+	// Claim the work so a second solution is not accepted
+	m.workMu.Lock()
+	_, exists = m.work[header.ID]
+	delete(m.work, header.ID)
+	m.workMu.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("work %s was already submitted", header.ID)
+	}
+
+	if err := m.commitVertex(&vertex, work.transactions); err != nil {
+		return nil, err
+	}
+
+	m.telemetry.recordSubmitted(vertex.ID)
+	log.Printf("Accepted submitted block %s with nonce %d", vertex.ID, vertex.Nonce)
+	return &vertex, nil
+}
+
+// invalidateWork marks the latest work stale and wakes long-polling miners.
+// Issued work can still be submitted until it expires.
+func (m *Miner) invalidateWork() {
+	m.workMu.Lock()
+	defer m.workMu.Unlock()
+
+	m.workVersion++
+	m.workFee = math.Inf(1)
+	close(m.workStale)
+	m.workStale = make(chan struct{})
+}
+
+// pruneWork drops expired work; the caller holds workMu
+func (m *Miner) pruneWork() {
+	now := m.clock.Now()
+	for id, work := range m.work {
+		if now.Sub(work.issued) > workTTL {
+			delete(m.work, id)
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	mrand "math/rand"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Address book layout. New addresses are bucketed by the network group of
+// the address and of the peer that sent it, so one source cannot fill the
+// book; tried addresses, which have completed a handshake, by their own group.
+const (
+	newBucketCount   = 64
+	triedBucketCount = 16
+	bucketSize       = 64
+)
+
+// Retry backoff for addresses that failed to connect
+const (
+	addrRetryBase = 10 * time.Second
+	addrRetryMax  = 10 * time.Minute
+)
+
+// maxAddrFailures is how many failed attempts an address that never
+// connected survives
+const maxAddrFailures = 8
+
+// maxAddressLength bounds addresses accepted from the network
+const maxAddressLength = 255
+
+// KnownAddress is an entry of the address book
+type KnownAddress struct {
+	Address     string    `json:"address"`
+	Services    uint64    `json:"services"`
+	Source      string    `json:"source"` // peer the address came from; empty for configured peers
+	LastSeen    time.Time `json:"last_seen"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSuccess time.Time `json:"last_success"`
+	Failures    int       `json:"failures"` // failed attempts since the last success
+	Tried       bool      `json:"tried"`
+
+	bucket int
+}
+
+// AddressBook remembers peer addresses across restarts, split into new
+// addresses heard about and tried addresses that have been connected to
+type AddressBook struct {
+	path string
+
+	mu          sync.Mutex
+	key         []byte // randomizes bucket placement per node
+	addresses   map[string]*KnownAddress
+	local       map[string]bool       // addresses of this node, never stored
+	newCounts   [newBucketCount]int   // entries per new bucket
+	triedCounts [triedBucketCount]int // entries per tried bucket
+	rand        *mrand.Rand
+}
+
+// addressBookFile is the persisted form of the address book
+type addressBookFile struct {
+	Key       string          `json:"key"`
+	Addresses []*KnownAddress `json:"addresses"`
+}
+
+// NewAddressBook loads the address book stored at path, starting an empty
+// one if there is none or it cannot be read. With an empty path the book
+// is kept in memory only.
+func NewAddressBook(path string) *AddressBook {
+	b := &AddressBook{
+		path:      path,
+		addresses: make(map[string]*KnownAddress),
+		local:     make(map[string]bool),
+		rand:      mrand.New(mrand.NewSource(time.Now().UnixNano())),
+	}
+
+	if err := b.load(); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Starting with an empty address book: %v", err)
+		}
+		b.addresses = make(map[string]*KnownAddress)
+		b.newCounts = [newBucketCount]int{}
+		b.triedCounts = [triedBucketCount]int{}
+		b.key = make([]byte, 32)
+		rand.Read(b.key)
+	}
+	return b
+}
+
+// load reads the persisted address book
+func (b *AddressBook) load() error {
+	if b.path == "" {
+		return os.ErrNotExist
+	}
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return err
+	}
+
+	var file addressBookFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid address book %s: %v", b.path, err)
+	}
+	key, err := hex.DecodeString(file.Key)
+	if err != nil || len(key) != 32 {
+		return fmt.Errorf("invalid address book key in %s", b.path)
+	}
+	b.key = key
+
+	for _, known := range file.Addresses {
+		if known == nil || validateAddress(known.Address) != nil {
+			continue
+		}
+		if known.Tried {
+			known.bucket = b.triedBucket(known.Address)
+			if b.triedCounts[known.bucket] >= bucketSize {
+				continue
+			}
+			b.triedCounts[known.bucket]++
+		} else {
+			known.bucket = b.newBucket(known.Address, known.Source)
+			if b.newCounts[known.bucket] >= bucketSize {
+				continue
+			}
+			b.newCounts[known.bucket]++
+		}
+		b.addresses[known.Address] = known
+	}
+	return nil
+}
+
+// Save writes the address book to disk
+func (b *AddressBook) Save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	b.mu.Lock()
+	file := addressBookFile{
+		Key:       hex.EncodeToString(b.key),
+		Addresses: make([]*KnownAddress, 0, len(b.addresses)),
+	}
+	for _, known := range b.addresses {
+		copied := *known
+		file.Addresses = append(file.Addresses, &copied)
+	}
+	b.mu.Unlock()
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write a temporary file first so a crash never leaves half a book
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write address book: %v", err)
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// Add records an address heard from source, reporting whether it was new
+func (b *AddressBook) Add(address NetAddress, source string) bool {
+	if validateAddress(address.Address) != nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.local[address.Address] {
+		return false
+	}
+
+	seen := time.Unix(address.Timestamp, 0)
+	if address.Timestamp == 0 || seen.After(time.Now()) {
+		seen = time.Now()
+	}
+
+	if known, exists := b.addresses[address.Address]; exists {
+		if seen.After(known.LastSeen) {
+			known.LastSeen = seen
+		}
+		known.Services |= address.Services
+		return false
+	}
+
+	bucket := b.newBucket(address.Address, source)
+	if b.newCounts[bucket] >= bucketSize {
+		b.evictNew(bucket)
+	}
+	b.addresses[address.Address] = &KnownAddress{
+		Address:  address.Address,
+		Services: address.Services,
+		Source:   source,
+		LastSeen: seen,
+		bucket:   bucket,
+	}
+	b.newCounts[bucket]++
+	return true
+}
+
+// Attempt records a connection attempt to an address
+func (b *AddressBook) Attempt(address string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	known, exists := b.addresses[address]
+	if !exists {
+		return
+	}
+	known.LastAttempt = time.Now()
+	known.Failures++
+
+	// Forget new addresses that keep failing
+	if !known.Tried && known.Failures > maxAddrFailures {
+		b.remove(known)
+	}
+}
+
+// Good records a completed handshake with an address, moving it to the
+// tried buckets
+func (b *AddressBook) Good(address string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	known, exists := b.addresses[address]
+	if !exists {
+		known = &KnownAddress{Address: address}
+		b.addresses[address] = known
+	} else if !known.Tried {
+		b.newCounts[known.bucket]--
+	} else {
+		b.triedCounts[known.bucket]--
+	}
+
+	known.LastSuccess = time.Now()
+	known.LastSeen = known.LastSuccess
+	known.Failures = 0
+	known.Tried = true
+	known.bucket = b.triedBucket(address)
+
+	if b.triedCounts[known.bucket] >= bucketSize {
+		b.demoteTried(known.bucket, known)
+	}
+	b.triedCounts[known.bucket]++
+}
+
+// SetLocal forgets an address that turned out to be this node and ignores
+// it from then on
+func (b *AddressBook) SetLocal(address string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.local[address] = true
+	if known, exists := b.addresses[address]; exists {
+		b.remove(known)
+	}
+}
+
+// Due reports whether an address may be dialed, i.e. it is not backing
+// off after a failure
+func (b *AddressBook) Due(address string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	known, exists := b.addresses[address]
+	return !exists || !time.Now().Before(known.nextAttempt())
+}
+
+// Pick chooses an address to connect to, half the time from the tried
+// addresses, skipping excluded ones and those still backing off
+func (b *AddressBook) Pick(exclude func(address string) bool) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var tried, fresh []*KnownAddress
+	for _, known := range b.addresses {
+		if now.Before(known.nextAttempt()) || exclude(known.Address) {
+			continue
+		}
+		if known.Tried {
+			tried = append(tried, known)
+		} else {
+			fresh = append(fresh, known)
+		}
+	}
+
+	candidates := fresh
+	if len(tried) > 0 && (len(fresh) == 0 || b.rand.Intn(2) == 0) {
+		candidates = tried
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	return candidates[b.rand.Intn(len(candidates))].Address, true
+}
+
+// Sample returns up to n random addresses to share with a peer
+func (b *AddressBook) Sample(n int) []NetAddress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	addresses := make([]NetAddress, 0, len(b.addresses))
+	for _, known := range b.addresses {
+		if !known.Tried && known.Failures > 0 {
+			continue // never shared until it has worked once
+		}
+		addresses = append(addresses, NetAddress{
+			Address:   known.Address,
+			Services:  known.Services,
+			Timestamp: known.LastSeen.Unix(),
+		})
+	}
+
+	b.rand.Shuffle(len(addresses), func(i, j int) {
+		addresses[i], addresses[j] = addresses[j], addresses[i]
+	})
+	if len(addresses) > n {
+		addresses = addresses[:n]
+	}
+	return addresses
+}
+
+// Size returns the number of new and tried addresses
+func (b *AddressBook) Size() (fresh, tried int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, known := range b.addresses {
+		if known.Tried {
+			tried++
+		} else {
+			fresh++
+		}
+	}
+	return fresh, tried
+}
+
+// remove deletes an entry; the caller holds b.mu
+func (b *AddressBook) remove(known *KnownAddress) {
+	if known.Tried {
+		b.triedCounts[known.bucket]--
+	} else {
+		b.newCounts[known.bucket]--
+	}
+	delete(b.addresses, known.Address)
+}
+
+// evictNew makes room in a full new bucket by dropping its worst entry:
+// the most failures, then the longest unseen. The caller holds b.mu.
+func (b *AddressBook) evictNew(bucket int) {
+	var worst *KnownAddress
+	for _, known := range b.addresses {
+		if known.Tried || known.bucket != bucket {
+			continue
+		}
+		if worst == nil || known.Failures > worst.Failures ||
+			(known.Failures == worst.Failures && known.LastSeen.Before(worst.LastSeen)) {
+			worst = known
+		}
+	}
+	if worst != nil {
+		b.remove(worst)
+	}
+}
+
+// demoteTried makes room in a full tried bucket by moving its least
+// recently connected entry back to the new buckets. The caller holds b.mu.
+func (b *AddressBook) demoteTried(bucket int, keep *KnownAddress) {
+	var oldest *KnownAddress
+	for _, known := range b.addresses {
+		if !known.Tried || known.bucket != bucket || known == keep {
+			continue
+		}
+		if oldest == nil || known.LastSuccess.Before(oldest.LastSuccess) {
+			oldest = known
+		}
+	}
+	if oldest == nil {
+		return
+	}
+
+	b.triedCounts[bucket]--
+	oldest.Tried = false
+	oldest.bucket = b.newBucket(oldest.Address, oldest.Source)
+	if b.newCounts[oldest.bucket] >= bucketSize {
+		b.evictNew(oldest.bucket)
+	}
+	b.newCounts[oldest.bucket]++
+}
+
+// newBucket places an address by its group and the group of its source
+func (b *AddressBook) newBucket(address, source string) int {
+	return b.bucketHash(addressGroup(address), addressGroup(source)) % newBucketCount
+}
+
+// triedBucket places an address by its group and the address itself
+func (b *AddressBook) triedBucket(address string) int {
+	return b.bucketHash(addressGroup(address), address) % triedBucketCount
+}
+
+// bucketHash hashes parts under the book's key
+func (b *AddressBook) bucketHash(parts ...string) int {
+	hash := sha256.New()
+	hash.Write(b.key)
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return int(binary.BigEndian.Uint32(hash.Sum(nil)[:4]) & 0x7fffffff)
+}
+
+// nextAttempt is when the address may be tried again, backing off
+// exponentially with each failure
+func (k *KnownAddress) nextAttempt() time.Time {
+	if k.Failures == 0 {
+		return k.LastAttempt
+	}
+	backoff := addrRetryBase << uint(k.Failures-1)
+	if backoff > addrRetryMax || backoff <= 0 {
+		backoff = addrRetryMax
+	}
+	return k.LastAttempt.Add(backoff)
+}
+
+// addressGroup returns the network group of an address: the /16 of an
+// IPv4 address, the /32 of an IPv6 one, or the host name
+func addressGroup(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return host
+	case ip.To4() != nil:
+		return ip.To4().Mask(net.CIDRMask(16, 32)).String()
+	default:
+		return ip.Mask(net.CIDRMask(32, 128)).String()
+	}
+}
+
+// validateAddress checks an address is a host and port that can be dialed
+func validateAddress(address string) error {
+	if len(address) > maxAddressLength {
+		return fmt.Errorf("address is too long")
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("address %s has no host", address)
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return fmt.Errorf("address %s is unspecified", address)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("address %s has an invalid port", address)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package p2p
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// checkCounts compares the per-bucket counts with the entries of the book
+func checkCounts(t *testing.T, b *AddressBook) {
+	t.Helper()
+	var fresh [newBucketCount]int
+	var tried [triedBucketCount]int
+	for _, known := range b.addresses {
+		if known.Tried {
+			if want := b.triedBucket(known.Address); known.bucket != want {
+				t.Errorf("tried %s in bucket %d, want %d", known.Address, known.bucket, want)
+			}
+			tried[known.bucket]++
+		} else {
+			if want := b.newBucket(known.Address, known.Source); known.bucket != want {
+				t.Errorf("new %s in bucket %d, want %d", known.Address, known.bucket, want)
+			}
+			fresh[known.bucket]++
+		}
+	}
+	if fresh != b.newCounts || tried != b.triedCounts {
+		t.Errorf("bucket counts %v and %v, want %v and %v", b.newCounts, b.triedCounts, fresh, tried)
+	}
+}
+
+func TestAddressBookOneSourceFillsOneBucket(t *testing.T) {
+	b := NewAddressBook("")
+	const source = "20.0.0.1:8333"
+
+	// Addresses from one /16, all heard from one peer, share a bucket
+	for i := 0; i < 3*bucketSize; i++ {
+		b.Add(NetAddress{Address: fmt.Sprintf("10.1.%d.%d:8333", i/250, i%250+1)}, source)
+	}
+	if fresh, tried := b.Size(); fresh != bucketSize || tried != 0 {
+		t.Errorf("book holds %d new and %d tried, want one full bucket", fresh, tried)
+	}
+	checkCounts(t, b)
+
+	// The same peer spreads addresses from many groups over many buckets
+	for i := 0; i < 3*bucketSize; i++ {
+		b.Add(NetAddress{Address: fmt.Sprintf("10.%d.0.1:8333", 10+i)}, source)
+	}
+	used := 0
+	for _, count := range b.newCounts {
+		if count > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("addresses from %d groups used %d buckets", 3*bucketSize, used)
+	}
+	checkCounts(t, b)
+}
+
+func TestAddressBookGoodMovesToTried(t *testing.T) {
+	b := NewAddressBook("")
+	for i := 0; i < 20; i++ {
+		b.Add(NetAddress{Address: fmt.Sprintf("10.%d.0.1:8333", i)}, "20.0.0.1:8333")
+	}
+	for i := 0; i < 5; i++ {
+		b.Good(fmt.Sprintf("10.%d.0.1:8333", i))
+	}
+	b.Good("30.0.0.1:8333") // never heard of, e.g. an inbound peer's listener
+
+	if fresh, tried := b.Size(); fresh != 15 || tried != 6 {
+		t.Errorf("book holds %d new and %d tried, want 15 and 6", fresh, tried)
+	}
+	checkCounts(t, b)
+}
+
+func TestAddressBookFullTriedBucketDemotes(t *testing.T) {
+	b := NewAddressBook("")
+
+	// Find more addresses than one tried bucket holds that all map to it
+	target := b.triedBucket("10.0.0.1:8333")
+	addresses := make([]string, 0, bucketSize+1)
+	for i := 0; len(addresses) <= bucketSize; i++ {
+		address := fmt.Sprintf("10.%d.%d.1:8333", i/250, i%250)
+		if b.triedBucket(address) == target {
+			addresses = append(addresses, address)
+		}
+	}
+
+	for _, address := range addresses {
+		b.Good(address)
+	}
+	if b.triedCounts[target] != bucketSize {
+		t.Errorf("tried bucket holds %d, want it full at %d", b.triedCounts[target], bucketSize)
+	}
+	if fresh, tried := b.Size(); fresh != 1 || tried != bucketSize {
+		t.Errorf("book holds %d new and %d tried, want one demoted", fresh, tried)
+	}
+	if !b.addresses[addresses[len(addresses)-1]].Tried {
+		t.Error("the address just connected to was demoted")
+	}
+	checkCounts(t, b)
+}
+
+func TestAddressBookReloadKeepsBuckets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	b := NewAddressBook(path)
+	for i := 0; i < 50; i++ {
+		b.Add(NetAddress{Address: fmt.Sprintf("10.%d.%d.1:8333", i%7, i)}, fmt.Sprintf("20.%d.0.1:8333", i%3))
+	}
+	for i := 0; i < 10; i++ {
+		b.Good(fmt.Sprintf("10.%d.%d.1:8333", i%7, i))
+	}
+	b.Add(NetAddress{Address: "bad address"}, "")
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	reloaded := NewAddressBook(path)
+	if string(reloaded.key) != string(b.key) {
+		t.Fatal("reloaded book has a different key")
+	}
+	if len(reloaded.addresses) != len(b.addresses) {
+		t.Fatalf("reloaded %d addresses, want %d", len(reloaded.addresses), len(b.addresses))
+	}
+	for address, known := range b.addresses {
+		loaded := reloaded.addresses[address]
+		if loaded == nil || loaded.Tried != known.Tried || loaded.bucket != known.bucket {
+			t.Errorf("%s reloaded as %+v, want %+v", address, loaded, known)
+		}
+	}
+	if reloaded.newCounts != b.newCounts || reloaded.triedCounts != b.triedCounts {
+		t.Error("reloaded bucket counts differ")
+	}
+	checkCounts(t, reloaded)
+}
+
+func TestAddressGroup(t *testing.T) {
+	tests := []struct {
+		address string
+		group   string
+	}{
+		{"10.1.2.3:8333", "10.1.0.0"},
+		{"10.1.200.4", "10.1.0.0"},
+		{"[2001:db8:1::1]:8333", "2001:db8::"},
+		{"[::ffff:10.1.2.3]:8333", "10.1.0.0"},
+		{"seed.example.org:8333", "seed.example.org"},
+	}
+	for _, tt := range tests {
+		if got := addressGroup(tt.address); got != tt.group {
+			t.Errorf("addressGroup(%q) = %q, want %q", tt.address, got, tt.group)
+		}
+	}
+}
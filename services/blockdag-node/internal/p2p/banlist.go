@@ -0,0 +1,179 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"hackodisha/blockdag-node/internal/clock"
+)
+
+// DefaultBanDuration is how long a misbehaving peer stays banned
+const DefaultBanDuration = 24 * time.Hour
+
+// Ban keeps a host from connecting until it expires
+type Ban struct {
+	Host    string    `json:"host"`
+	Reason  string    `json:"reason"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// BanList remembers banned hosts across restarts. Hosts rather than node
+// IDs are banned, as a new ID costs nothing.
+type BanList struct {
+	path string
+
+	mu    sync.Mutex
+	bans  map[string]*Ban
+	clock clock.Clock
+}
+
+// NewBanList loads the ban list stored at path, starting an empty one if
+// there is none or it cannot be read. With an empty path the list is kept
+// in memory only. Bans that have expired are dropped when next read.
+func NewBanList(path string) *BanList {
+	b := &BanList{
+		path:  path,
+		bans:  make(map[string]*Ban),
+		clock: clock.System,
+	}
+	if path == "" {
+		return b
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Starting with an empty ban list: %v", err)
+		}
+		return b
+	}
+
+	var bans []*Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		log.Printf("Starting with an empty ban list: invalid ban list %s: %v", path, err)
+		return b
+	}
+	for _, ban := range bans {
+		if ban != nil && ban.Host != "" {
+			b.bans[ban.Host] = ban
+		}
+	}
+	return b
+}
+
+// SetClock replaces the system clock that bans are created and expire by
+func (b *BanList) SetClock(clock clock.Clock) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clock = clock
+}
+
+// Ban bans a host for duration, replacing any earlier ban
+func (b *BanList) Ban(host string, duration time.Duration, reason string) error {
+	if duration <= 0 {
+		return fmt.Errorf("ban duration must be positive")
+	}
+
+	b.mu.Lock()
+	now := b.clock.Now()
+	b.bans[host] = &Ban{
+		Host:    host,
+		Reason:  reason,
+		Created: now,
+		Expires: now.Add(duration),
+	}
+	b.mu.Unlock()
+
+	return b.save()
+}
+
+// Unban lifts the ban on a host, reporting whether there was one
+func (b *BanList) Unban(host string) (bool, error) {
+	b.mu.Lock()
+	_, exists := b.bans[host]
+	delete(b.bans, host)
+	b.mu.Unlock()
+
+	if !exists {
+		return false, nil
+	}
+	return true, b.save()
+}
+
+// IsBanned reports whether a host is banned
+func (b *BanList) IsBanned(host string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ban, exists := b.bans[host]
+	if !exists {
+		return false
+	}
+	if !b.clock.Now().Before(ban.Expires) {
+		delete(b.bans, host)
+		return false
+	}
+	return true
+}
+
+// List returns the bans in force, soonest to expire first
+func (b *BanList) List() []Ban {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	bans := make([]Ban, 0, len(b.bans))
+	for host, ban := range b.bans {
+		if !now.Before(ban.Expires) {
+			delete(b.bans, host)
+			continue
+		}
+		bans = append(bans, *ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Expires.Before(bans[j].Expires)
+	})
+	return bans
+}
+
+// save writes the ban list to disk
+func (b *BanList) save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	bans := b.List()
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write ban list: %v", err)
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// banHost returns the host part of a peer address, which is what bans
+// apply to
+func banHost(address string) (string, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	if host == "" || len(host) > maxAddressLength {
+		return "", fmt.Errorf("invalid peer address %q", address)
+	}
+	return host, nil
+}
@@ -0,0 +1,127 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a manual clock. After moves it forward at once, so waiting
+// on it returns straight away having taken the time it asked for.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	fired := make(chan time.Time, 1)
+	fired <- c.advance(d)
+	return fired
+}
+
+// advance moves the clock forward by d and returns the new time
+func (c *testClock) advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+func TestBanListPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banlist.json")
+	clock := newTestClock()
+	bans := NewBanList(path)
+	bans.SetClock(clock)
+
+	if err := bans.Ban("10.0.0.1", time.Hour, "invalid vertex"); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if err := bans.Ban("10.0.0.2", 2*time.Hour, "unrequested data"); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if err := bans.Ban("10.0.0.3", 0, "no duration"); err == nil {
+		t.Error("accepted a ban without a duration")
+	}
+
+	reloaded := NewBanList(path)
+	reloaded.SetClock(clock)
+	list := reloaded.List()
+	if len(list) != 2 || list[0].Host != "10.0.0.1" || list[1].Host != "10.0.0.2" {
+		t.Fatalf("reloaded %+v, want both bans, soonest to expire first", list)
+	}
+	if list[0].Reason != "invalid vertex" || !list[0].Expires.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("reloaded ban %+v", list[0])
+	}
+
+	// An unban is saved too
+	if lifted, err := reloaded.Unban("10.0.0.2"); !lifted || err != nil {
+		t.Fatalf("Unban: %v, %v", lifted, err)
+	}
+	if lifted, _ := reloaded.Unban("10.0.0.2"); lifted {
+		t.Error("lifted a ban twice")
+	}
+	again := NewBanList(path)
+	again.SetClock(clock)
+	if again.IsBanned("10.0.0.2") || !again.IsBanned("10.0.0.1") {
+		t.Errorf("after the unban, reloaded %+v", again.List())
+	}
+}
+
+func TestBanListExpires(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banlist.json")
+	clock := newTestClock()
+	bans := NewBanList(path)
+	bans.SetClock(clock)
+
+	if err := bans.Ban("10.0.0.1", time.Hour, "invalid vertex"); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if err := bans.Ban("10.0.0.2", 2*time.Hour, "invalid vertex"); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+
+	clock.advance(time.Hour - time.Second)
+	if !bans.IsBanned("10.0.0.1") {
+		t.Error("ban lifted before it expired")
+	}
+	clock.advance(time.Second)
+	if bans.IsBanned("10.0.0.1") {
+		t.Error("ban still in force when it expired")
+	}
+	if list := bans.List(); len(list) != 1 || list[0].Host != "10.0.0.2" {
+		t.Errorf("listed %+v, want only the ban still in force", list)
+	}
+
+	// A ban that expired while the list was on disk is not loaded back in force
+	clock.advance(time.Hour)
+	reloaded := NewBanList(path)
+	reloaded.SetClock(clock)
+	if reloaded.IsBanned("10.0.0.2") || len(reloaded.List()) != 0 {
+		t.Errorf("reloaded %+v after every ban expired", reloaded.List())
+	}
+}
+
+func TestBanListStartsEmptyOnBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banlist.json")
+	if err := os.WriteFile(path, []byte("not json"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if list := NewBanList(path).List(); len(list) != 0 {
+		t.Errorf("loaded %+v from an invalid file", list)
+	}
+	if list := NewBanList(filepath.Join(t.TempDir(), "missing.json")).List(); len(list) != 0 {
+		t.Errorf("loaded %+v from a missing file", list)
+	}
+}
@@ -0,0 +1,189 @@
+package p2p
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hackodisha/blockdag-node/internal/clock"
+)
+
+// sendQueueSize bounds the messages waiting to be written to one peer
+const sendQueueSize = 256
+
+// writeTimeout bounds how long writing one frame may take
+const writeTimeout = 30 * time.Second
+
+// MessageHandler processes a message read from a peer
+type MessageHandler func(Message)
+
+// ErrorHandler is told about malformed frames the codec read past
+type ErrorHandler func(*MessageError)
+
+// Codec frames messages over one peer connection. Reads and writes run on
+// their own goroutines, so a slow reader never blocks senders beyond the
+// bounded send queue.
+type Codec struct {
+	conn  net.Conn
+	magic uint32
+
+	out       chan Message
+	quit      chan struct{}
+	closeOnce sync.Once
+	err       error // why the codec closed, set before quit is closed
+	limiter   *rateLimiter
+	clock     clock.Clock
+
+	bytesSent     atomic.Uint64
+	bytesReceived atomic.Uint64
+}
+
+// NewCodec creates a codec for a connection on the network with magic
+func NewCodec(conn net.Conn, magic uint32) *Codec {
+	return &Codec{
+		conn:  conn,
+		magic: magic,
+		out:   make(chan Message, sendQueueSize),
+		quit:  make(chan struct{}),
+		clock: clock.System,
+	}
+}
+
+// Start launches the read and write goroutines. Messages are passed to
+// handler one at a time, in the order they arrive. Malformed frames that
+// leave the stream readable go to onError; any other read error closes the
+// codec.
+func (c *Codec) Start(handler MessageHandler, onError ErrorHandler) {
+	go c.readLoop(handler, onError)
+	go c.writeLoop()
+}
+
+// Send queues a message for the peer
+func (c *Codec) Send(msg Message) error {
+	select {
+	case <-c.quit:
+		return fmt.Errorf("connection closed")
+	default:
+	}
+
+	select {
+	case c.out <- msg:
+		return nil
+	case <-c.quit:
+		return fmt.Errorf("connection closed")
+	default:
+		return fmt.Errorf("send queue full")
+	}
+}
+
+// SendWait queues a message for the peer, waiting for room in the send
+// queue rather than failing when it is full
+func (c *Codec) SendWait(msg Message) error {
+	select {
+	case <-c.quit:
+		return fmt.Errorf("connection closed")
+	default:
+	}
+
+	select {
+	case c.out <- msg:
+		return nil
+	case <-c.quit:
+		return fmt.Errorf("connection closed")
+	}
+}
+
+// Close closes the connection and stops both goroutines
+func (c *Codec) Close() {
+	c.closeWithError(nil)
+}
+
+// Done is closed once the codec has closed
+func (c *Codec) Done() <-chan struct{} {
+	return c.quit
+}
+
+// Err returns why the codec closed, or nil if it was closed locally
+func (c *Codec) Err() error {
+	<-c.quit
+	return c.err
+}
+
+// BytesSent returns the bytes written to the peer
+func (c *Codec) BytesSent() uint64 {
+	return c.bytesSent.Load()
+}
+
+// BytesReceived returns the bytes read from the peer
+func (c *Codec) BytesReceived() uint64 {
+	return c.bytesReceived.Load()
+}
+
+// closeWithError records the first reason for closing and closes
+func (c *Codec) closeWithError(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.quit)
+		c.conn.Close()
+	})
+}
+
+// readLoop decodes frames until the connection fails or a frame cannot be
+// read past
+func (c *Codec) readLoop(handler MessageHandler, onError ErrorHandler) {
+	reader := bufio.NewReader(c.conn)
+	for {
+		msg, n, err := ReadMessage(reader, c.magic)
+		c.bytesReceived.Add(uint64(n))
+		msgErr, skippable := err.(*MessageError)
+		skippable = skippable && msgErr.Skippable
+		if err != nil && !skippable {
+			c.closeWithError(err)
+			return
+		}
+
+		// Every whole frame counts against the limits, garbage included
+		if !c.limiter.received(n, c.quit) {
+			return
+		}
+		if skippable {
+			onError(msgErr)
+			continue
+		}
+		if msg == nil {
+			continue // unknown command
+		}
+
+		handler(msg)
+	}
+}
+
+// writeLoop writes queued messages until the codec closes
+func (c *Codec) writeLoop() {
+	for {
+		select {
+		case <-c.quit:
+			return
+		case msg := <-c.out:
+			c.conn.SetWriteDeadline(c.clock.Now().Add(writeTimeout))
+			n, err := WriteMessage(c.conn, c.magic, msg)
+			c.bytesSent.Add(uint64(n))
+			if !c.limiter.sent(n, c.quit) {
+				return
+			}
+			if err != nil {
+				if _, local := err.(*MessageError); local {
+					// Our own message broke a limit; drop it, not the peer
+					log.Printf("Dropping outgoing %s: %v", msg.Command(), err)
+					continue
+				}
+				c.closeWithError(err)
+				return
+			}
+		}
+	}
+}
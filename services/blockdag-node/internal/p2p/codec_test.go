@@ -0,0 +1,170 @@
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// startTestCodec runs a codec on one end of a pipe and returns the other
+// end with the channels the codec reports to
+func startTestCodec(t *testing.T) (*Codec, net.Conn, chan Message, chan *MessageError) {
+	t.Helper()
+	local, remote := net.Pipe()
+	codec := NewCodec(local, testMagic)
+	t.Cleanup(func() {
+		codec.Close()
+		remote.Close()
+	})
+
+	messages := make(chan Message, 16)
+	errs := make(chan *MessageError, 16)
+	codec.Start(func(msg Message) { messages <- msg }, func(err *MessageError) { errs <- err })
+	return codec, remote, messages, errs
+}
+
+func TestCodecSkipsMalformedFrames(t *testing.T) {
+	badChecksum := rawFrame(testMagic, CmdPing, []byte(`{"nonce":1}`))
+	badChecksum[21] ^= 0xff
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"checksum mismatch", badChecksum},
+		{"malformed payload", rawFrame(testMagic, CmdPing, []byte(`not json`))},
+		{"invalid contents", rawFrame(testMagic, CmdVertex, []byte(`{}`))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, remote, messages, errs := startTestCodec(t)
+			go func() {
+				remote.Write(tt.frame)
+				remote.Write(rawFrame(testMagic, "future", []byte(`{}`)))
+				remote.Write(rawFrame(testMagic, CmdPong, []byte(`{"nonce":2}`)))
+			}()
+
+			select {
+			case err := <-errs:
+				if !err.Skippable {
+					t.Errorf("reported %v as not skippable", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the malformed frame was not reported")
+			}
+
+			// Neither the bad frame nor the unknown one stops the stream
+			select {
+			case msg := <-messages:
+				if pong, ok := msg.(*MsgPong); !ok || pong.Nonce != 2 {
+					t.Errorf("got %+v, want the pong after the bad frame", msg)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the message after the bad frame was not delivered")
+			}
+			select {
+			case <-codec.Done():
+				t.Fatalf("codec closed: %v", codec.Err())
+			default:
+			}
+		})
+	}
+}
+
+func TestCodecClosesOnUnrecoverableFrame(t *testing.T) {
+	oversize := rawFrame(testMagic, CmdPing, nil)
+	oversize[19] = 0xff // declared length over the ping limit
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"wrong magic", rawFrame(testMagic+1, CmdPing, []byte(`{"nonce":1}`))},
+		{"oversize payload", oversize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, remote, messages, _ := startTestCodec(t)
+			go remote.Write(tt.frame)
+
+			select {
+			case <-codec.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("codec stayed open")
+			}
+			if _, ok := codec.Err().(*MessageError); !ok {
+				t.Errorf("closed with %v, want a *MessageError", codec.Err())
+			}
+			select {
+			case msg := <-messages:
+				t.Errorf("delivered %+v", msg)
+			default:
+			}
+		})
+	}
+}
+
+func TestCodecSendsMessages(t *testing.T) {
+	codec, remote, _, _ := startTestCodec(t)
+	if err := codec.Send(&MsgPing{Nonce: 5}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg, n, err := ReadMessage(remote, testMagic)
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if ping, ok := msg.(*MsgPing); !ok || ping.Nonce != 5 {
+		t.Errorf("got %+v, want the ping sent", msg)
+	}
+	// The counter is updated after the write returns
+	deadline := time.Now().Add(5 * time.Second)
+	for codec.BytesSent() != uint64(n) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if codec.BytesSent() != uint64(n) {
+		t.Errorf("BytesSent = %d, want %d", codec.BytesSent(), n)
+	}
+
+	codec.Close()
+	if err := codec.Send(&MsgPing{}); err == nil {
+		t.Error("Send succeeded on a closed codec")
+	}
+}
+
+func TestCodecSendWaitPastTheQueue(t *testing.T) {
+	codec, remote, _, _ := startTestCodec(t)
+
+	// More replies than the queue holds, as a full getdata produces
+	count := sendQueueSize + 10
+	sent := make(chan error, 1)
+	go func() {
+		for i := 0; i < count; i++ {
+			if err := codec.SendWait(&MsgPing{Nonce: uint64(i)}); err != nil {
+				sent <- err
+				return
+			}
+		}
+		sent <- nil
+	}()
+
+	remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < count; i++ {
+		msg, _, err := ReadMessage(remote, testMagic)
+		if err != nil {
+			t.Fatalf("ReadMessage %d: %v", i, err)
+		}
+		if ping, ok := msg.(*MsgPing); !ok || ping.Nonce != uint64(i) {
+			t.Fatalf("got %+v, want ping %d", msg, i)
+		}
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("SendWait: %v", err)
+	}
+
+	codec.Close()
+	if err := codec.SendWait(&MsgPing{}); err == nil {
+		t.Error("SendWait succeeded on a closed codec")
+	}
+}
@@ -0,0 +1,240 @@
+package p2p
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultTargetOutbound is the number of outbound peers kept by default
+const DefaultTargetOutbound = 8
+
+// connectInterval is how often the connection manager tops up its peers
+const connectInterval = 5 * time.Second
+
+// saveInterval is how often the address book is written to disk
+const saveInterval = 2 * time.Minute
+
+// Addr relay: small announcements of recently seen addresses are passed on
+// to a few peers so new nodes become known without being asked for
+const (
+	maxRelayedAddrs = 10
+	addrRelayFanout = 2
+	addrRelayMaxAge = 10 * time.Minute
+)
+
+// peerDiscovered learns addresses from a peer that completed the handshake.
+// Outbound peers are known to be reachable and are asked for more; inbound
+// peers are remembered under the address they listen on.
+func (n *Node) peerDiscovered(peer *Peer) {
+	if !peer.Inbound {
+		n.book.Good(peer.Address)
+		if err := n.sendMessage(peer, &MsgGetAddr{}); err != nil {
+			log.Printf("Failed to request addresses from peer %s: %v", peer.Address, err)
+		}
+		return
+	}
+
+	if address := peer.listenAddress(); address != "" {
+		n.book.Add(NetAddress{Address: address, Services: peer.info().Services, Timestamp: time.Now().Unix()}, peer.Address)
+	}
+}
+
+// handleGetAddr answers a peer's first getaddr with a sample of the book
+func (n *Node) handleGetAddr(peer *Peer) error {
+	peer.mu.Lock()
+	answered := peer.sentAddr
+	peer.sentAddr = true
+	peer.mu.Unlock()
+
+	// Answering once per connection stops the book being scraped
+	if answered {
+		return nil
+	}
+	return n.sendMessage(peer, &MsgAddr{Addresses: n.book.Sample(MaxAddrPerMsg)})
+}
+
+// handleAddr adds the addresses a peer shared to the book, relaying small
+// announcements of fresh ones
+func (n *Node) handleAddr(peer *Peer, msg *MsgAddr) error {
+	relay := make([]NetAddress, 0)
+	for _, address := range msg.Addresses {
+		if !n.book.Add(address, peer.Address) {
+			continue
+		}
+		if len(msg.Addresses) <= maxRelayedAddrs && time.Since(time.Unix(address.Timestamp, 0)) < addrRelayMaxAge {
+			relay = append(relay, address)
+		}
+	}
+
+	if len(relay) > 0 {
+		n.relayAddresses(peer, relay)
+	}
+	return nil
+}
+
+// relayAddresses passes new addresses on to a few random peers other than
+// the one they came from
+func (n *Node) relayAddresses(from *Peer, addresses []NetAddress) {
+	peers := n.readyPeers()
+	rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+
+	sent := 0
+	for _, peer := range peers {
+		if peer == from {
+			continue
+		}
+		if err := n.sendMessage(peer, &MsgAddr{Addresses: addresses}); err != nil {
+			log.Printf("Failed to relay addresses to peer %s: %v", peer.Address, err)
+		}
+		if sent++; sent == addrRelayFanout {
+			return
+		}
+	}
+}
+
+// listenAddress is where an inbound peer accepts connections
+func (p *Peer) listenAddress() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.version == nil {
+		return ""
+	}
+	return advertisedAddress(p.Address, p.version.ListenAddress)
+}
+
+// advertisedAddress combines the host a peer connected from with the port
+// it says it listens on, or returns "" if either is unusable
+func advertisedAddress(remote, listen string) string {
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return ""
+	}
+
+	address := net.JoinHostPort(host, port)
+	if validateAddress(address) != nil {
+		return ""
+	}
+	return address
+}
+
+// ConnManager keeps a node connected: it dials addresses from the book
+// until the target number of outbound peers is reached, and keeps
+// reconnecting to persistent peers
+type ConnManager struct {
+	node       *Node
+	book       *AddressBook
+	target     int
+	persistent []string
+
+	mu      sync.Mutex
+	dialing map[string]bool
+}
+
+// NewConnManager creates a connection manager that keeps target outbound
+// peers. Bootstrap addresses seed the book; persistent ones are always
+// reconnected.
+func NewConnManager(node *Node, book *AddressBook, target int, bootstrap, persistent []string) *ConnManager {
+	for _, address := range append(append([]string{}, bootstrap...), persistent...) {
+		if err := validateAddress(address); err != nil {
+			log.Printf("Ignoring peer address %q: %v", address, err)
+			continue
+		}
+		book.Add(NetAddress{Address: address, Timestamp: time.Now().Unix()}, "")
+	}
+
+	return &ConnManager{
+		node:       node,
+		book:       book,
+		target:     target,
+		persistent: persistent,
+		dialing:    make(map[string]bool),
+	}
+}
+
+// Start maintains connections until ctx is cancelled, saving the address
+// book as it goes
+func (c *ConnManager) Start(ctx context.Context) {
+	connectTicker := time.NewTicker(connectInterval)
+	defer connectTicker.Stop()
+	saveTicker := time.NewTicker(saveInterval)
+	defer saveTicker.Stop()
+
+	c.connect()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-connectTicker.C:
+			c.connect()
+		case <-saveTicker.C:
+			if err := c.book.Save(); err != nil {
+				log.Printf("Failed to save address book: %v", err)
+			}
+		}
+	}
+}
+
+// connect dials persistent peers that are down and book addresses until
+// the outbound target is met
+func (c *ConnManager) connect() {
+	excluded := func(address string) bool {
+		c.mu.Lock()
+		dialing := c.dialing[address]
+		c.mu.Unlock()
+		return dialing || c.node.isConnected(address) || c.node.isBanned(address)
+	}
+
+	for _, address := range c.persistent {
+		// Persistent peers stay in the book however often they fail
+		c.book.Add(NetAddress{Address: address, Timestamp: time.Now().Unix()}, "")
+		if !excluded(address) && c.book.Due(address) {
+			c.dial(address)
+		}
+	}
+
+	for c.node.outboundCount()+c.dialingCount() < c.target {
+		address, ok := c.book.Pick(excluded)
+		if !ok {
+			return
+		}
+		c.dial(address)
+	}
+}
+
+// dial connects to an address in the background
+func (c *ConnManager) dial(address string) {
+	c.mu.Lock()
+	c.dialing[address] = true
+	c.mu.Unlock()
+
+	c.book.Attempt(address)
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.dialing, address)
+			c.mu.Unlock()
+		}()
+
+		if err := c.node.AddPeer(address); err != nil {
+			log.Printf("%v", err)
+		}
+	}()
+}
+
+// dialingCount returns the number of dials in progress
+func (c *ConnManager) dialingCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.dialing)
+}
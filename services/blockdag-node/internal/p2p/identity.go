@@ -0,0 +1,71 @@
+package p2p
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Identity is the node's static key pair. Its ID, derived from the public
+// key, names the node to its peers.
+type Identity struct {
+	PrivateKey *ecdh.PrivateKey
+	ID         string
+}
+
+// LoadOrCreateIdentity reads the X25519 key stored at path, generating
+// and storing a new one if the file does not exist
+func LoadOrCreateIdentity(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		identity, err := GenerateIdentity()
+		if err != nil {
+			return nil, err
+		}
+		encoded := hex.EncodeToString(identity.PrivateKey.Bytes())
+		if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write node key: %v", err)
+		}
+		return identity, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node key: %v", err)
+	}
+
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid node key in %s: %v", path, err)
+	}
+	privateKey, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node key in %s: %v", path, err)
+	}
+	return newIdentity(privateKey), nil
+}
+
+// GenerateIdentity creates an identity with a fresh key that is not stored
+func GenerateIdentity() (*Identity, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newIdentity(privateKey), nil
+}
+
+// newIdentity derives the ID of a key pair
+func newIdentity(privateKey *ecdh.PrivateKey) *Identity {
+	return &Identity{
+		PrivateKey: privateKey,
+		ID:         NodeID(privateKey.PublicKey()),
+	}
+}
+
+// NodeID is the hex of the first 20 bytes of the SHA-256 of a public key
+func NodeID(publicKey *ecdh.PublicKey) string {
+	hash := sha256.Sum256(publicKey.Bytes())
+	return hex.EncodeToString(hash[:20])
+}
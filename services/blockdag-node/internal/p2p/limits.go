@@ -0,0 +1,209 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"hackodisha/blockdag-node/internal/clock"
+)
+
+// Limits bounds the connections a node keeps and the traffic it takes from
+// them. A zero field means no limit.
+type Limits struct {
+	MaxInbound   int // inbound connections
+	MaxOutbound  int // outbound connections
+	MaxPerSubnet int // connections from one /16 (IPv4) or /32 (IPv6); loopback is exempt
+
+	PeerMessageRate float64 // messages per second read from one peer
+	PeerByteRate    float64 // bytes per second read from one peer
+	TotalByteRate   float64 // bytes per second sent and received over all peers
+}
+
+// DefaultLimits are generous enough for a full sync from one peer while
+// keeping a single peer well below what the node can process
+func DefaultLimits() Limits {
+	return Limits{
+		MaxInbound:      64,
+		MaxOutbound:     16,
+		MaxPerSubnet:    4,
+		PeerMessageRate: 500,
+		PeerByteRate:    2 << 20,
+		TotalByteRate:   16 << 20,
+	}
+}
+
+// rateBurst is how many seconds of traffic a bucket may take at once
+const rateBurst = 2
+
+// tokenBucket refills at rate tokens per second up to a burst. Takes may
+// overdraw it, so one message larger than the burst still goes through
+// and the next waits for the debt to be repaid.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	clock  clock.Clock
+}
+
+// newTokenBucket creates a full bucket refilling by clock, or nil for no
+// limit
+func newTokenBucket(rate float64, clock clock.Clock) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  rate * rateBurst,
+		tokens: rate * rateBurst,
+		last:   clock.Now(),
+		clock:  clock,
+	}
+}
+
+// take removes n tokens, waiting while the bucket is in debt. It reports
+// false if quit closed first.
+func (b *tokenBucket) take(n int, quit <-chan struct{}) bool {
+	if b == nil {
+		return true
+	}
+
+	for {
+		b.mu.Lock()
+		now := b.clock.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+
+		if b.tokens > 0 {
+			b.tokens -= float64(n)
+			b.mu.Unlock()
+			return true
+		}
+		wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-quit:
+			return false
+		case <-b.clock.After(wait + time.Millisecond):
+		}
+	}
+}
+
+// rateLimiter throttles one peer's traffic against its own buckets and
+// the node-wide budget
+type rateLimiter struct {
+	messages *tokenBucket
+	bytes    *tokenBucket
+	total    *tokenBucket // shared by all peers
+}
+
+// newRateLimiter creates a limiter for a peer under limits, sharing total
+func newRateLimiter(limits Limits, total *tokenBucket, clock clock.Clock) *rateLimiter {
+	return &rateLimiter{
+		messages: newTokenBucket(limits.PeerMessageRate, clock),
+		bytes:    newTokenBucket(limits.PeerByteRate, clock),
+		total:    total,
+	}
+}
+
+// received waits until a message of n bytes read from the peer fits the
+// limits. Holding up the read loop pushes back on the peer through TCP.
+func (l *rateLimiter) received(n int, quit <-chan struct{}) bool {
+	if l == nil {
+		return true
+	}
+	return l.messages.take(1, quit) && l.bytes.take(n, quit) && l.total.take(n, quit)
+}
+
+// sent waits until n bytes written to the peer fit the node-wide budget
+func (l *rateLimiter) sent(n int, quit <-chan struct{}) bool {
+	if l == nil {
+		return true
+	}
+	return l.total.take(n, quit)
+}
+
+// connSlots counts connections against the limits. A slot is reserved
+// before a connection does any work and released when it closes.
+type connSlots struct {
+	mu       sync.Mutex
+	limits   Limits
+	inbound  int
+	outbound int
+	subnets  map[string]int
+}
+
+// newConnSlots creates slot accounting for limits
+func newConnSlots(limits Limits) *connSlots {
+	return &connSlots{
+		limits:  limits,
+		subnets: make(map[string]int),
+	}
+}
+
+// reserve takes a slot for a connection to or from address, returning the
+// function that frees it
+func (s *connSlots) reserve(address string, inbound bool) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case inbound && s.limits.MaxInbound > 0 && s.inbound >= s.limits.MaxInbound:
+		return nil, fmt.Errorf("inbound connection limit of %d reached", s.limits.MaxInbound)
+	case !inbound && s.limits.MaxOutbound > 0 && s.outbound >= s.limits.MaxOutbound:
+		return nil, fmt.Errorf("outbound connection limit of %d reached", s.limits.MaxOutbound)
+	}
+
+	subnet := ""
+	if !isLoopback(address) {
+		subnet = addressGroup(address)
+		if s.limits.MaxPerSubnet > 0 && s.subnets[subnet] >= s.limits.MaxPerSubnet {
+			return nil, fmt.Errorf("connection limit of %d for subnet %s reached", s.limits.MaxPerSubnet, subnet)
+		}
+		s.subnets[subnet]++
+	}
+	if inbound {
+		s.inbound++
+	} else {
+		s.outbound++
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			if inbound {
+				s.inbound--
+			} else {
+				s.outbound--
+			}
+			if subnet != "" {
+				if s.subnets[subnet]--; s.subnets[subnet] == 0 {
+					delete(s.subnets, subnet)
+				}
+			}
+		})
+	}, nil
+}
+
+// isLoopback reports whether address is on this machine
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,143 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+)
+
+// stoppedClock never fires, so a wait on it only ends by quitting
+type stoppedClock struct {
+	*testClock
+}
+
+func (stoppedClock) After(time.Duration) <-chan time.Time {
+	return nil
+}
+
+func TestTokenBucketDebt(t *testing.T) {
+	clock := newTestClock()
+	bucket := newTokenBucket(10, clock)
+	start := clock.Now()
+
+	// One take larger than the burst goes through and leaves a debt
+	if !bucket.take(50, nil) {
+		t.Fatal("take refused")
+	}
+	if elapsed := clock.Now().Sub(start); elapsed != 0 {
+		t.Errorf("a take from a full bucket waited %s", elapsed)
+	}
+
+	// The next waits until the 30 tokens owed have been refilled
+	if !bucket.take(1, nil) {
+		t.Fatal("take refused")
+	}
+	if elapsed, want := clock.Now().Sub(start), 3*time.Second+time.Millisecond; elapsed != want {
+		t.Errorf("take in debt waited %s, want %s", elapsed, want)
+	}
+
+	// Refilling stops at the burst
+	clock.advance(time.Hour)
+	if !bucket.take(1, nil) {
+		t.Fatal("take refused")
+	}
+	if bucket.tokens != 10*rateBurst-1 {
+		t.Errorf("%v tokens left after an hour, want the burst less one", bucket.tokens)
+	}
+}
+
+func TestTokenBucketQuitsWhileInDebt(t *testing.T) {
+	bucket := newTokenBucket(10, stoppedClock{newTestClock()})
+	bucket.take(100, nil)
+
+	quit := make(chan struct{})
+	close(quit)
+	if bucket.take(1, quit) {
+		t.Error("take in debt went through after quit")
+	}
+}
+
+func TestRateLimiterWithoutLimits(t *testing.T) {
+	limiter := newRateLimiter(Limits{}, newTokenBucket(0, newTestClock()), stoppedClock{newTestClock()})
+	for i := 0; i < 1000; i++ {
+		if !limiter.received(1<<20, nil) || !limiter.sent(1<<20, nil) {
+			t.Fatal("unlimited traffic was held up")
+		}
+	}
+}
+
+func TestConnSlotsSubnets(t *testing.T) {
+	slots := newConnSlots(Limits{MaxInbound: 3, MaxOutbound: 1, MaxPerSubnet: 2})
+
+	reserve := func(address string, inbound bool) func() {
+		t.Helper()
+		release, err := slots.reserve(address, inbound)
+		if err != nil {
+			t.Fatalf("reserving %s: %v", address, err)
+		}
+		return release
+	}
+	refused := func(address string, inbound bool) {
+		t.Helper()
+		if _, err := slots.reserve(address, inbound); err == nil {
+			t.Errorf("reserved %s past the limits", address)
+		}
+	}
+
+	// Two connections fill 10.1.0.0/16, whichever way they go
+	first := reserve("10.1.0.1:8333", true)
+	reserve("10.1.200.2:8333", false)
+	refused("10.1.3.3:8333", true)
+	refused("10.2.0.1:8333", false) // outbound is full
+
+	reserve("10.2.0.1:8333", true)
+	reserve("10.2.0.2:8333", true)
+	refused("10.3.0.1:8333", true) // inbound is full
+	if slots.subnets["10.1.0.0"] != 2 || slots.subnets["10.2.0.0"] != 2 {
+		t.Errorf("subnet counts %v", slots.subnets)
+	}
+
+	// Releasing frees the subnet and the inbound slot, once
+	first()
+	first()
+	if slots.subnets["10.1.0.0"] != 1 || slots.inbound != 2 {
+		t.Errorf("after one release: subnets %v, %d inbound", slots.subnets, slots.inbound)
+	}
+	reserve("10.1.5.5:8333", true)
+}
+
+func TestConnSlotsGroups(t *testing.T) {
+	slots := newConnSlots(Limits{MaxPerSubnet: 1})
+
+	// Loopback is exempt from the subnet limit
+	releases := make([]func(), 0)
+	for i := 0; i < 3; i++ {
+		release, err := slots.reserve("127.0.0.1:8333", true)
+		if err != nil {
+			t.Fatalf("loopback connection %d: %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+	if len(slots.subnets) != 0 {
+		t.Errorf("loopback counted against subnets %v", slots.subnets)
+	}
+
+	// IPv6 addresses are grouped by /32
+	release, err := slots.reserve("[2001:db8:1::1]:8333", true)
+	if err != nil {
+		t.Fatalf("reserving: %v", err)
+	}
+	releases = append(releases, release)
+	if _, err := slots.reserve("[2001:db8:2::1]:8333", true); err == nil {
+		t.Error("reserved a second connection from the same /32")
+	}
+	if _, err := slots.reserve("[2001:db9::1]:8333", true); err != nil {
+		t.Errorf("refused another /32: %v", err)
+	}
+
+	for _, release := range releases {
+		release()
+	}
+	if slots.inbound != 1 || len(slots.subnets) != 1 {
+		t.Errorf("after releasing: %d inbound, subnets %v", slots.inbound, slots.subnets)
+	}
+}
@@ -0,0 +1,105 @@
+package p2p
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Liveness: every peer is pinged regularly and must answer with the same
+// nonce, which also measures the round-trip time
+const (
+	livenessInterval = 5 * time.Second
+	pingInterval     = 30 * time.Second
+	pingTimeout      = time.Minute
+)
+
+// stallTimeout is how long a peer may leave a getdata unanswered
+const stallTimeout = requestTimeout
+
+// requestData asks a peer for items, tracking them so a peer that never
+// answers is detected as stalled
+func (n *Node) requestData(peer *Peer, items []InvVect) error {
+	now := n.clock.Now()
+	peer.mu.Lock()
+	for _, item := range items {
+		if _, exists := peer.requested[item]; !exists {
+			peer.requested[item] = now
+		}
+	}
+	peer.mu.Unlock()
+
+	return n.sendMessage(peer, &MsgGetData{Items: items})
+}
+
+// answered records that a peer replied to a getdata for an item, with the
+// item itself or a reject, reporting whether the item was asked for
+func (p *Peer) answered(item InvVect) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, requested := p.requested[item]
+	delete(p.requested, item)
+	return requested
+}
+
+// handlePong records the round-trip time of the outstanding ping. Pongs
+// with another nonce are late or unsolicited and ignored.
+func (n *Node) handlePong(peer *Peer, msg *MsgPong) {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+
+	if peer.pingNonce == 0 || msg.Nonce != peer.pingNonce {
+		return
+	}
+	peer.rtt = n.clock.Now().Sub(peer.pingSent)
+	peer.pingNonce = 0
+}
+
+// checkLiveness pings peers that are due and drops those that stopped
+// answering pings or getdata requests
+func (n *Node) checkLiveness() {
+	for _, peer := range n.readyPeers() {
+		if reason := peer.stalled(n.clock.Now()); reason != "" {
+			n.disconnect(peer, reason)
+			continue
+		}
+
+		if nonce := peer.nextPing(n.clock.Now()); nonce != 0 {
+			if err := n.sendMessage(peer, &MsgPing{Nonce: nonce}); err != nil {
+				n.disconnect(peer, fmt.Sprintf("failed to send ping: %v", err))
+			}
+		}
+	}
+}
+
+// stalled explains why a peer is no longer answering at now, or returns ""
+func (p *Peer) stalled(now time.Time) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pingNonce != 0 && now.Sub(p.pingSent) > pingTimeout {
+		return "ping timed out"
+	}
+	for item, requested := range p.requested {
+		if now.Sub(requested) > stallTimeout {
+			return fmt.Sprintf("stalled: getdata for %s unanswered", item.Hash)
+		}
+	}
+	return ""
+}
+
+// nextPing starts a ping if one is due at now, returning its nonce or 0
+func (p *Peer) nextPing(now time.Time) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pingNonce != 0 || now.Sub(p.pingSent) < pingInterval {
+		return 0
+	}
+	for p.pingNonce == 0 {
+		p.pingNonce = rand.Uint64()
+	}
+	p.pingSent = now
+	return p.pingNonce
+}
@@ -0,0 +1,69 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPingMeasuresRTT(t *testing.T) {
+	clock := newTestClock()
+	n := &Node{clock: clock}
+	peer := &Peer{Address: "peer", requested: make(map[InvVect]time.Time)}
+
+	nonce := peer.nextPing(clock.Now())
+	if nonce == 0 {
+		t.Fatal("a new peer was not pinged")
+	}
+	if again := peer.nextPing(clock.Now().Add(pingInterval)); again != 0 {
+		t.Error("pinged again with a ping outstanding")
+	}
+
+	// A pong with another nonce is ignored, the right one sets the RTT
+	clock.advance(80 * time.Millisecond)
+	n.handlePong(peer, &MsgPong{Nonce: nonce + 1})
+	if peer.pingNonce != nonce {
+		t.Fatal("a pong with another nonce answered the ping")
+	}
+	n.handlePong(peer, &MsgPong{Nonce: nonce})
+	if peer.rtt != 80*time.Millisecond || peer.pingNonce != 0 {
+		t.Errorf("RTT %s with nonce %d outstanding, want 80ms and none", peer.rtt, peer.pingNonce)
+	}
+
+	// The next ping waits for the interval from the last one
+	if peer.nextPing(clock.Now()) != 0 {
+		t.Error("pinged again before the interval")
+	}
+	if peer.nextPing(clock.Now().Add(pingInterval)) == 0 {
+		t.Error("not pinged after the interval")
+	}
+}
+
+func TestPeerStalls(t *testing.T) {
+	start := newTestClock().Now()
+	item := InvVect{Type: InvVertex, Hash: "v1"}
+
+	// An unanswered ping
+	peer := &Peer{Address: "peer", requested: make(map[InvVect]time.Time)}
+	peer.nextPing(start)
+	if reason := peer.stalled(start.Add(pingTimeout)); reason != "" {
+		t.Errorf("stalled at the ping timeout: %s", reason)
+	}
+	if reason := peer.stalled(start.Add(pingTimeout + time.Second)); reason == "" {
+		t.Error("not stalled after the ping timed out")
+	}
+
+	// An unanswered getdata, until the item or a reject arrives
+	peer = &Peer{Address: "peer", requested: map[InvVect]time.Time{item: start}}
+	if reason := peer.stalled(start.Add(stallTimeout + time.Second)); reason == "" {
+		t.Error("not stalled after a getdata went unanswered")
+	}
+	if !peer.answered(item) {
+		t.Error("the requested item was not recorded as asked for")
+	}
+	if reason := peer.stalled(start.Add(stallTimeout + time.Second)); reason != "" {
+		t.Errorf("stalled after the getdata was answered: %s", reason)
+	}
+	if peer.answered(item) {
+		t.Error("an item was answered twice")
+	}
+}
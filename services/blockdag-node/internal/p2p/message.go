@@ -0,0 +1,272 @@
+package p2p
+
+import (
+	"fmt"
+
+	"hackodisha/blockdag-node/internal/dag"
+)
+
+// Message commands
+const (
+	CmdVersion = "version"
+	CmdVerAck  = "verack"
+	CmdPing    = "ping"
+	CmdPong    = "pong"
+	CmdInv     = "inv"
+	CmdGetData = "getdata"
+	CmdVertex  = "vertex"
+	CmdTx      = "tx"
+	CmdAddr    = "addr"
+	CmdGetAddr = "getaddr"
+	CmdReject  = "reject"
+
+	CmdGetHeaders = "getheaders"
+	CmdHeaders    = "headers"
+)
+
+// Limits on the contents of a single message
+const (
+	MaxInvPerMsg      = 1000
+	MaxAddrPerMsg     = 1000
+	MaxTipsPerMsg     = 100
+	MaxLocatorSize    = 500
+	MaxHeadersPerMsg  = 2000
+	maxVersionSize    = 16 << 10
+	maxPingSize       = 64
+	maxInvSize        = 256 << 10
+	maxVertexSize     = 2 << 20 // a payload of chaincfg.MaxPayloadSize in base64, and the header
+	maxTxSize         = 1 << 20
+	maxAddrSize       = 256 << 10
+	maxRejectSize     = 1 << 10
+	maxGetHeadersSize = 64 << 10
+	maxHeadersSize    = 2 << 20
+)
+
+// Message is a typed P2P message. Payloads are encoded as JSON.
+type Message interface {
+	// Command is the name carried in the frame header
+	Command() string
+
+	// MaxPayloadSize bounds the encoded payload
+	MaxPayloadSize() int
+}
+
+// validator is implemented by messages with limits beyond their size
+type validator interface {
+	validate() error
+}
+
+// InvType identifies what an inventory item refers to
+type InvType string
+
+// Inventory types
+const (
+	InvVertex InvType = "vertex"
+	InvTx     InvType = "tx"
+)
+
+// InvVect announces or requests one item by hash
+type InvVect struct {
+	Type InvType `json:"type"`
+	Hash string  `json:"hash"` // vertex ID or transaction ID
+}
+
+// NetAddress is a peer address learned from the network
+type NetAddress struct {
+	Address   string `json:"address"`
+	Services  uint64 `json:"services"`
+	Timestamp int64  `json:"timestamp"` // unix seconds the address was last seen
+}
+
+// MsgVersion opens the handshake
+type MsgVersion struct {
+	ProtocolVersion uint32   `json:"protocol_version"`
+	Network         uint32   `json:"network"`
+	Genesis         string   `json:"genesis"`
+	NodeID          string   `json:"node_id"`
+	Services        uint64   `json:"services"`
+	Tips            []string `json:"tips"`
+	ListenAddress   string   `json:"listen_address,omitempty"`
+	UserAgent       string   `json:"user_agent"`
+	Timestamp       int64    `json:"timestamp"`
+}
+
+// MsgVerAck acknowledges a version message
+type MsgVerAck struct{}
+
+// MsgPing asks the peer to echo the nonce in a pong
+type MsgPing struct {
+	Nonce uint64 `json:"nonce"`
+}
+
+// MsgPong answers a ping
+type MsgPong struct {
+	Nonce uint64 `json:"nonce"`
+}
+
+// MsgInv announces items the sender has
+type MsgInv struct {
+	Items []InvVect `json:"items"`
+}
+
+// MsgGetData requests announced items
+type MsgGetData struct {
+	Items []InvVect `json:"items"`
+}
+
+// MsgVertex carries a full vertex
+type MsgVertex struct {
+	Vertex *dag.Vertex `json:"vertex"`
+}
+
+// MsgTx carries an encoded transaction
+type MsgTx struct {
+	Data []byte `json:"data"`
+}
+
+// MsgGetAddr asks for a sample of the peer's address book
+type MsgGetAddr struct{}
+
+// MsgAddr shares known peer addresses
+type MsgAddr struct {
+	Addresses []NetAddress `json:"addresses"`
+}
+
+// MsgReject tells the peer why one of its messages was refused
+type MsgReject struct {
+	Rejected string `json:"command"` // command of the refused message
+	Reason   string `json:"reason"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// MsgGetHeaders asks for the headers of the vertices outside the past of
+// the locator, in topological order
+type MsgGetHeaders struct {
+	Locator []string `json:"locator"` // tips and finalized vertices of the sender, newest first
+}
+
+// MsgHeaders answers getheaders; fewer than MaxHeadersPerMsg headers means
+// the sender has no more
+type MsgHeaders struct {
+	Headers []*dag.Header `json:"headers"`
+}
+
+func (*MsgVersion) Command() string    { return CmdVersion }
+func (*MsgVerAck) Command() string     { return CmdVerAck }
+func (*MsgPing) Command() string       { return CmdPing }
+func (*MsgPong) Command() string       { return CmdPong }
+func (*MsgInv) Command() string        { return CmdInv }
+func (*MsgGetData) Command() string    { return CmdGetData }
+func (*MsgVertex) Command() string     { return CmdVertex }
+func (*MsgTx) Command() string         { return CmdTx }
+func (*MsgAddr) Command() string       { return CmdAddr }
+func (*MsgGetAddr) Command() string    { return CmdGetAddr }
+func (*MsgReject) Command() string     { return CmdReject }
+func (*MsgGetHeaders) Command() string { return CmdGetHeaders }
+func (*MsgHeaders) Command() string    { return CmdHeaders }
+
+func (*MsgVersion) MaxPayloadSize() int    { return maxVersionSize }
+func (*MsgVerAck) MaxPayloadSize() int     { return maxPingSize }
+func (*MsgPing) MaxPayloadSize() int       { return maxPingSize }
+func (*MsgPong) MaxPayloadSize() int       { return maxPingSize }
+func (*MsgInv) MaxPayloadSize() int        { return maxInvSize }
+func (*MsgGetData) MaxPayloadSize() int    { return maxInvSize }
+func (*MsgVertex) MaxPayloadSize() int     { return maxVertexSize }
+func (*MsgTx) MaxPayloadSize() int         { return maxTxSize }
+func (*MsgAddr) MaxPayloadSize() int       { return maxAddrSize }
+func (*MsgGetAddr) MaxPayloadSize() int    { return maxPingSize }
+func (*MsgReject) MaxPayloadSize() int     { return maxRejectSize }
+func (*MsgGetHeaders) MaxPayloadSize() int { return maxGetHeadersSize }
+func (*MsgHeaders) MaxPayloadSize() int    { return maxHeadersSize }
+
+func (m *MsgVersion) validate() error {
+	if len(m.Tips) > MaxTipsPerMsg {
+		return fmt.Errorf("%d tips exceeds the limit of %d", len(m.Tips), MaxTipsPerMsg)
+	}
+	return nil
+}
+
+func (m *MsgInv) validate() error { return validateInv(m.Items) }
+
+func (m *MsgGetData) validate() error { return validateInv(m.Items) }
+
+func (m *MsgVertex) validate() error {
+	if m.Vertex == nil {
+		return fmt.Errorf("missing vertex")
+	}
+	return nil
+}
+
+func (m *MsgAddr) validate() error {
+	if len(m.Addresses) > MaxAddrPerMsg {
+		return fmt.Errorf("%d addresses exceeds the limit of %d", len(m.Addresses), MaxAddrPerMsg)
+	}
+	return nil
+}
+
+func (m *MsgGetHeaders) validate() error {
+	if len(m.Locator) > MaxLocatorSize {
+		return fmt.Errorf("locator of %d entries exceeds the limit of %d", len(m.Locator), MaxLocatorSize)
+	}
+	return nil
+}
+
+func (m *MsgHeaders) validate() error {
+	if len(m.Headers) > MaxHeadersPerMsg {
+		return fmt.Errorf("%d headers exceeds the limit of %d", len(m.Headers), MaxHeadersPerMsg)
+	}
+	for _, header := range m.Headers {
+		if header == nil {
+			return fmt.Errorf("missing header")
+		}
+	}
+	return nil
+}
+
+// validateInv checks the item count and types of an inventory list
+func validateInv(items []InvVect) error {
+	if len(items) > MaxInvPerMsg {
+		return fmt.Errorf("%d inventory items exceeds the limit of %d", len(items), MaxInvPerMsg)
+	}
+	for _, item := range items {
+		if item.Type != InvVertex && item.Type != InvTx {
+			return fmt.Errorf("unknown inventory type %q", item.Type)
+		}
+	}
+	return nil
+}
+
+// newMessage returns an empty message for a command, or nil if the
+// command is unknown
+func newMessage(command string) Message {
+	switch command {
+	case CmdVersion:
+		return &MsgVersion{}
+	case CmdVerAck:
+		return &MsgVerAck{}
+	case CmdPing:
+		return &MsgPing{}
+	case CmdPong:
+		return &MsgPong{}
+	case CmdInv:
+		return &MsgInv{}
+	case CmdGetData:
+		return &MsgGetData{}
+	case CmdVertex:
+		return &MsgVertex{}
+	case CmdTx:
+		return &MsgTx{}
+	case CmdAddr:
+		return &MsgAddr{}
+	case CmdGetAddr:
+		return &MsgGetAddr{}
+	case CmdReject:
+		return &MsgReject{}
+	case CmdGetHeaders:
+		return &MsgGetHeaders{}
+	case CmdHeaders:
+		return &MsgHeaders{}
+	default:
+		return nil
+	}
+}
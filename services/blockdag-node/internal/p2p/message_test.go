@@ -0,0 +1,78 @@
+package p2p
+
+import (
+	"testing"
+
+	"hackodisha/blockdag-node/internal/dag"
+)
+
+func TestMessageValidate(t *testing.T) {
+	items := func(n int) []InvVect { return make([]InvVect, n) }
+	vertexItems := func(n int) []InvVect {
+		list := items(n)
+		for i := range list {
+			list[i] = InvVect{InvVertex, "v"}
+		}
+		return list
+	}
+
+	tests := []struct {
+		name  string
+		msg   validator
+		valid bool
+	}{
+		{"version at the tip limit", &MsgVersion{Tips: make([]string, MaxTipsPerMsg)}, true},
+		{"version over the tip limit", &MsgVersion{Tips: make([]string, MaxTipsPerMsg+1)}, false},
+		{"inv at the item limit", &MsgInv{Items: vertexItems(MaxInvPerMsg)}, true},
+		{"inv over the item limit", &MsgInv{Items: vertexItems(MaxInvPerMsg + 1)}, false},
+		{"inv with an unknown type", &MsgInv{Items: []InvVect{{"block", "v"}}}, false},
+		{"getdata with both types", &MsgGetData{Items: []InvVect{{InvVertex, "v"}, {InvTx, "t"}}}, true},
+		{"getdata over the item limit", &MsgGetData{Items: vertexItems(MaxInvPerMsg + 1)}, false},
+		{"vertex", &MsgVertex{Vertex: &dag.Vertex{ID: "v"}}, true},
+		{"vertex missing", &MsgVertex{}, false},
+		{"addr at the limit", &MsgAddr{Addresses: make([]NetAddress, MaxAddrPerMsg)}, true},
+		{"addr over the limit", &MsgAddr{Addresses: make([]NetAddress, MaxAddrPerMsg+1)}, false},
+		{"getheaders at the locator limit", &MsgGetHeaders{Locator: make([]string, MaxLocatorSize)}, true},
+		{"getheaders over the locator limit", &MsgGetHeaders{Locator: make([]string, MaxLocatorSize+1)}, false},
+		{"headers", &MsgHeaders{Headers: []*dag.Header{{ID: "v"}}}, true},
+		{"headers over the limit", &MsgHeaders{Headers: make([]*dag.Header, MaxHeadersPerMsg+1)}, false},
+		{"headers with a missing header", &MsgHeaders{Headers: []*dag.Header{{ID: "v"}, nil}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.msg.validate()
+			if tt.valid && err != nil {
+				t.Errorf("validate: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("validate accepted an invalid message")
+			}
+		})
+	}
+}
+
+func TestNewMessageCommands(t *testing.T) {
+	commands := []string{
+		CmdVersion, CmdVerAck, CmdPing, CmdPong, CmdInv, CmdGetData, CmdVertex,
+		CmdTx, CmdAddr, CmdGetAddr, CmdReject, CmdGetHeaders, CmdHeaders,
+	}
+	for _, command := range commands {
+		msg := newMessage(command)
+		if msg == nil {
+			t.Errorf("newMessage(%q) = nil", command)
+			continue
+		}
+		if msg.Command() != command {
+			t.Errorf("newMessage(%q) has command %q", command, msg.Command())
+		}
+		if len(command) > commandSize {
+			t.Errorf("command %q does not fit the frame header", command)
+		}
+		if msg.MaxPayloadSize() > MaxMessagePayload {
+			t.Errorf("%s allows %d bytes, over the frame limit", command, msg.MaxPayloadSize())
+		}
+	}
+	if msg := newMessage("future"); msg != nil {
+		t.Errorf("newMessage of an unknown command = %+v", msg)
+	}
+}
@@ -0,0 +1,104 @@
+package p2p
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+)
+
+// BanThreshold is the misbehavior score at which a peer is banned
+const BanThreshold = 100
+
+// Misbehavior scores. Anything that can only come from a broken or hostile
+// peer is banned at once; mistakes an honest peer might make add up.
+const (
+	scoreInvalidVertex = BanThreshold
+	scoreMalformed     = 20
+	scoreUnrequested   = 10
+	scoreRepeated      = 10 // the same expensive request again
+)
+
+// misbehaving adds to a peer's score, banning its host once the score
+// reaches BanThreshold
+func (n *Node) misbehaving(peer *Peer, score int, reason string) {
+	peer.mu.Lock()
+	before := peer.score
+	peer.score += score
+	after := peer.score
+	peer.mu.Unlock()
+
+	log.Printf("Peer %s misbehaved (score %d): %s", peer.Address, after, reason)
+	if before >= BanThreshold || after < BanThreshold {
+		return
+	}
+
+	if err := n.Ban(peer.Address, DefaultBanDuration, reason); err != nil {
+		log.Printf("Failed to ban peer %s: %v", peer.Address, err)
+		n.disconnect(peer, reason)
+	}
+}
+
+// invalidHeader scores a peer for a header that failed validation. A
+// timestamp too far ahead may be our own clock, so it is not held against
+// the peer.
+func (n *Node) invalidHeader(peer *Peer, header *dag.Header, err error) {
+	if header.Timestamp.After(n.clock.Now().Add(consensus.MaxTimeOffset)) {
+		return
+	}
+	n.misbehaving(peer, scoreInvalidVertex, fmt.Sprintf("invalid vertex %s: %v", header.ID, err))
+}
+
+// Ban bans the host of address and disconnects its peers
+func (n *Node) Ban(address string, duration time.Duration, reason string) error {
+	host, err := banHost(address)
+	if err != nil {
+		return err
+	}
+	if err := n.bans.Ban(host, duration, reason); err != nil {
+		return err
+	}
+	log.Printf("Banned %s until %s: %s", host, n.clock.Now().Add(duration).UTC().Format(time.RFC3339), reason)
+
+	n.mu.RLock()
+	banned := make([]*Peer, 0)
+	for _, peer := range n.peers {
+		if peerHost, _ := banHost(peer.Address); peerHost == host {
+			banned = append(banned, peer)
+		}
+	}
+	for peer := range n.pending {
+		if peerHost, _ := banHost(peer.Address); peerHost == host {
+			banned = append(banned, peer)
+		}
+	}
+	n.mu.RUnlock()
+
+	for _, peer := range banned {
+		n.disconnect(peer, "banned: "+reason)
+	}
+	return nil
+}
+
+// Unban lifts the ban on the host of address, reporting whether there was
+// one
+func (n *Node) Unban(address string) (bool, error) {
+	host, err := banHost(address)
+	if err != nil {
+		return false, err
+	}
+	return n.bans.Unban(host)
+}
+
+// Banned returns the bans in force
+func (n *Node) Banned() []Ban {
+	return n.bans.List()
+}
+
+// isBanned reports whether the host of address is banned
+func (n *Node) isBanned(address string) bool {
+	host, err := banHost(address)
+	return err == nil && n.bans.IsBanned(host)
+}
@@ -1,48 +1,166 @@
 package p2p
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"sync"
 	"time"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/clock"
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/internal/mempool"
+)
+
+// Protocol versions this node speaks
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// Services a node can offer, advertised in its version message
+const (
+	ServiceFullNode uint64 = 1 << iota // stores and serves the whole DAG
 )
 
+// UserAgent identifies the node software in version messages
+const UserAgent = "blockdag-node/0.1"
+
+// handshakeTimeout bounds how long a connection may take to complete the
+// version/verack exchange
+const handshakeTimeout = 10 * time.Second
+
+// pruneInterval is how often stale requests and orphans are dropped
+const pruneInterval = 30 * time.Second
+
 // Node represents a P2P node in the BlockDAG network
 type Node struct {
-	address string
-	peers   map[string]*Peer
-	mu      sync.RWMutex
-	server  net.Listener
+	address         string
+	params          *chaincfg.Params
+	identity        *Identity
+	dagStore        *dag.Store
+	consensusEngine *consensus.Engine
+	mempool         *mempool.Mempool
+	state           *ledger.State
+	book            *AddressBook
+	bans            *BanList
+	peers           map[string]*Peer // peers that completed the handshake, by node ID
+	pending         map[*Peer]bool   // connections still in the handshake
+	mu              sync.RWMutex
+	server          net.Listener
+	transport       Transport
+	clock           clock.Clock
+
+	requireEncryption bool // refuse inbound peers that skip the Noise handshake
+	limits            Limits
+	slots             *connSlots
+	bandwidth         *tokenBucket // node-wide budget shared by all peers
+
+	syncer *syncManager
+
+	relayMu   sync.Mutex
+	requested map[InvVect]time.Time    // items being fetched, by when they were asked for
+	orphans   map[string]*orphanVertex // vertices waiting for their parents, by ID
+	released  []*orphanVertex          // orphans whose parents arrived, in release order
 }
 
 // Peer represents a connected peer
 type Peer struct {
-	ID       string
-	Address  string
-	Conn     net.Conn
-	LastSeen time.Time
+	Address string
+	Conn    net.Conn
+	Inbound bool
+
+	keyID string // ID of the static key proven in the Noise handshake, "" if plaintext
+
+	mu       sync.Mutex
+	id       string      // node ID from the peer's version message
+	version  *MsgVersion // the peer's version message
+	verAck   bool        // the peer acknowledged our version
+	sentAddr bool        // the peer's getaddr was answered
+	score    int         // misbehavior score; the host is banned at BanThreshold
+	lastSeen time.Time
+
+	pingNonce uint64                // nonce of the outstanding ping, 0 if none
+	pingSent  time.Time             // when the last ping was sent
+	rtt       time.Duration         // round-trip time of the last answered ping
+	requested map[InvVect]time.Time // items asked for with getdata, by when
+
+	lastLocator    string // locator of the last getheaders, joined
+	lastGetHeaders time.Time
+
+	known *inventorySet // items the peer has or was sent
+	codec *Codec
+}
+
+// PeerInfo is a snapshot of a connected peer
+type PeerInfo struct {
+	ID              string
+	Address         string
+	Inbound         bool
+	LastSeen        time.Time
+	ProtocolVersion uint32
+	Services        uint64
+	UserAgent       string
+	Encrypted       bool
+	BanScore        int
+	RTT             time.Duration // zero until a ping is answered
+	BytesSent       uint64
+	BytesReceived   uint64
 }
 
 // NewNode creates a new P2P node
-func NewNode(address string) (*Node, error) {
-	return &Node{
-		address: address,
-		peers:   make(map[string]*Peer),
-	}, nil
+func NewNode(address string, params *chaincfg.Params, identity *Identity, dagStore *dag.Store, consensusEngine *consensus.Engine, mempool *mempool.Mempool, state *ledger.State, book *AddressBook, bans *BanList) (*Node, error) {
+	n := &Node{
+		address:         address,
+		params:          params,
+		identity:        identity,
+		dagStore:        dagStore,
+		consensusEngine: consensusEngine,
+		mempool:         mempool,
+		state:           state,
+		book:            book,
+		bans:            bans,
+		peers:           make(map[string]*Peer),
+		pending:         make(map[*Peer]bool),
+		requested:       make(map[InvVect]time.Time),
+		orphans:         make(map[string]*orphanVertex),
+		transport:       TCPTransport{},
+		clock:           clock.System,
+
+		requireEncryption: true,
+	}
+	n.syncer = newSyncManager(n)
+	n.SetLimits(DefaultLimits())
+
+	// Relay everything this node accepts, whichever way it arrived
+	dagStore.OnVertexAdded(n.onVertexAdded)
+	mempool.OnTransactionAdded(n.onTransactionAdded)
+
+	return n, nil
+}
+
+// ID returns the node's own ID
+func (n *Node) ID() string {
+	return n.identity.ID
 }
 
 // Start starts the P2P node
 func (n *Node) Start(ctx context.Context) error {
 	// Start listening for incoming connections
-	listener, err := net.Listen("tcp", n.address)
+	listener, err := n.transport.Listen(n.address)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %v", n.address, err)
 	}
 	n.server = listener
 
-	log.Printf("P2P node listening on %s", n.address)
+	log.Printf("P2P node %s listening on %s", n.identity.ID, n.address)
 
 	// Accept incoming connections
 	go func() {
@@ -68,6 +186,7 @@ func (n *Node) Start(ctx context.Context) error {
 
 	// Start peer discovery and maintenance
 	go n.peerMaintenance(ctx)
+	go n.syncer.run(ctx)
 
 	return nil
 }
@@ -79,7 +198,10 @@ func (n *Node) Stop() error {
 
 	// Close all peer connections
 	for _, peer := range n.peers {
-		peer.Conn.Close()
+		peer.codec.Close()
+	}
+	for peer := range n.pending {
+		peer.codec.Close()
 	}
 
 	// Close server
@@ -90,66 +212,63 @@ func (n *Node) Stop() error {
 	return nil
 }
 
-// AddPeer adds a new peer
+// AddPeer connects to a peer; it joins the peer set once the handshake completes
 func (n *Node) AddPeer(address string) error {
-	n.mu.Lock()
-	defer n.mu.Unlock()
-
 	// Check if peer already exists
-	if _, exists := n.peers[address]; exists {
+	if n.isConnected(address) {
 		return nil
 	}
+	if n.isBanned(address) {
+		return fmt.Errorf("peer %s is banned", address)
+	}
+	release, err := n.slots.reserve(address, false)
+	if err != nil {
+		return fmt.Errorf("not connecting to peer %s: %v", address, err)
+	}
 
 	// Connect to peer
-	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	conn, err := n.transport.Dial(address, dialTimeout)
 	if err != nil {
+		release()
 		return fmt.Errorf("failed to connect to peer %s: %v", address, err)
 	}
 
-	peer := &Peer{
-		ID:       generatePeerID(),
-		Address:  address,
-		Conn:     conn,
-		LastSeen: time.Now(),
+	secure, keyID, err := secureHandshake(conn, n.identity, n.params.NetMagic, true, n.clock.Now().Add(handshakeTimeout))
+	if err != nil {
+		conn.Close()
+		release()
+		return fmt.Errorf("encrypted handshake with peer %s failed: %v", address, err)
 	}
 
-	n.peers[address] = peer
-
-	// Start handling this peer
-	go n.handlePeer(peer)
+	peer := n.newPeer(address, secure, false, keyID)
+	go func() {
+		n.handlePeer(peer)
+		release()
+	}()
 
 	log.Printf("Connected to peer %s", address)
 	return nil
 }
 
-// GetPeers returns all connected peers
-func (n *Node) GetPeers() []*Peer {
+// GetPeers returns all peers that completed the handshake
+func (n *Node) GetPeers() []PeerInfo {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
-	peers := make([]*Peer, 0, len(n.peers))
+	peers := make([]PeerInfo, 0, len(n.peers))
 	for _, peer := range n.peers {
-		peers = append(peers, peer)
+		peers = append(peers, peer.info())
 	}
 	return peers
 }
 
 // BroadcastMessage broadcasts a message to all peers
-func (n *Node) BroadcastMessage(message []byte) error {
-	n.mu.RLock()
-	peers := make([]*Peer, 0, len(n.peers))
-	for _, peer := range n.peers {
-		peers = append(peers, peer)
-	}
-	n.mu.RUnlock()
-
-	// Send message to all peers
-	for _, peer := range peers {
-		go func(p *Peer) {
-			if err := n.sendMessage(p, message); err != nil {
-				log.Printf("Failed to send message to peer %s: %v", p.Address, err)
-			}
-		}(peer)
+func (n *Node) BroadcastMessage(message Message) error {
+	// Queue the message for every peer
+	for _, peer := range n.readyPeers() {
+		if err := n.sendMessage(peer, message); err != nil {
+			log.Printf("Failed to send message to peer %s: %v", peer.Address, err)
+		}
 	}
 
 	return nil
@@ -157,97 +276,436 @@ func (n *Node) BroadcastMessage(message []byte) error {
 
 // handleConnection handles a new incoming connection
 func (n *Node) handleConnection(conn net.Conn) {
-	defer conn.Close()
+	address := conn.RemoteAddr().String()
+	if n.isBanned(address) {
+		conn.Close()
+		return
+	}
+	release, err := n.slots.reserve(address, true)
+	if err != nil {
+		log.Printf("Refusing connection from %s: %v", address, err)
+		conn.Close()
+		return
+	}
+	defer release()
+
+	// Plaintext peers open with the network magic; anything else starts a
+	// Noise handshake
+	prefix := make([]byte, 4)
+	conn.SetReadDeadline(n.clock.Now().Add(handshakeTimeout))
+	if _, err := io.ReadFull(conn, prefix); err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	replay := &replayConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(prefix), conn)}
+
+	var peer *Peer
+	if binary.BigEndian.Uint32(prefix) == n.params.NetMagic {
+		if n.requireEncryption {
+			log.Printf("Refusing plaintext connection from %s", address)
+			conn.Close()
+			return
+		}
+		peer = n.newPeer(address, replay, true, "")
+	} else {
+		secure, keyID, err := secureHandshake(replay, n.identity, n.params.NetMagic, false, n.clock.Now().Add(handshakeTimeout))
+		if err != nil {
+			log.Printf("Encrypted handshake with peer %s failed: %v", address, err)
+			conn.Close()
+			return
+		}
+		peer = n.newPeer(address, secure, true, keyID)
+	}
+	n.handlePeer(peer)
+}
 
-	// Create peer
+// SetLimits sets the connection and traffic limits. It must be called
+// before Start.
+func (n *Node) SetLimits(limits Limits) {
+	n.limits = limits
+	n.slots = newConnSlots(limits)
+	n.bandwidth = newTokenBucket(limits.TotalByteRate, n.clock)
+}
+
+// SetTransport replaces the TCP transport, for instance with an in-memory
+// one. It must be called before Start.
+func (n *Node) SetTransport(transport Transport) {
+	n.transport = transport
+}
+
+// SetClock replaces the system clock, for instance with a simulation's
+// virtual one, which the ban list and rate limits then follow too. The
+// address book keeps the system clock. It must be called before Start.
+func (n *Node) SetClock(clock clock.Clock) {
+	n.clock = clock
+	n.bans.SetClock(clock)
+	n.bandwidth = newTokenBucket(n.limits.TotalByteRate, clock)
+}
+
+// SetRequireEncryption sets whether the node refuses inbound peers that do
+// not encrypt the connection, which it does by default. Outbound
+// connections are always encrypted.
+func (n *Node) SetRequireEncryption(require bool) {
+	n.requireEncryption = require
+}
+
+// newPeer wraps a connection in a peer with its own codec and tracks it
+// until the handshake completes. keyID is the peer's authenticated ID on
+// an encrypted connection.
+func (n *Node) newPeer(address string, conn net.Conn, inbound bool, keyID string) *Peer {
 	peer := &Peer{
-		ID:       generatePeerID(),
-		Address:  conn.RemoteAddr().String(),
-		Conn:     conn,
-		LastSeen: time.Now(),
+		Address:   address,
+		Conn:      conn,
+		Inbound:   inbound,
+		keyID:     keyID,
+		lastSeen:  n.clock.Now(),
+		requested: make(map[InvVect]time.Time),
+		known:     newInventorySet(),
+		codec:     NewCodec(conn, n.params.NetMagic),
 	}
+	peer.codec.limiter = newRateLimiter(n.limits, n.bandwidth, n.clock)
+	peer.codec.clock = n.clock
 
-	// Add to peers
 	n.mu.Lock()
-	n.peers[peer.Address] = peer
+	n.pending[peer] = true
 	n.mu.Unlock()
 
-	// Handle peer
-	n.handlePeer(peer)
+	return peer
+}
+
+// handlePeer runs the handshake and then serves the peer until the
+// connection closes
+func (n *Node) handlePeer(peer *Peer) {
+	peer.codec.Start(func(message Message) {
+		// Update last seen
+		peer.mu.Lock()
+		peer.lastSeen = n.clock.Now()
+		peer.mu.Unlock()
+
+		if err := n.processMessage(peer, message); err != nil {
+			n.disconnect(peer, fmt.Sprintf("%s: %v", message.Command(), err))
+		}
+	}, func(err *MessageError) {
+		n.misbehaving(peer, scoreMalformed, err.Error())
+	})
+
+	if err := n.sendMessage(peer, n.versionMessage()); err != nil {
+		n.disconnect(peer, err.Error())
+	}
+
+	go func() {
+		select {
+		case <-n.clock.After(handshakeTimeout):
+			if !peer.handshakeComplete() {
+				n.disconnect(peer, "handshake timed out")
+			}
+		case <-peer.codec.Done():
+		}
+	}()
+
+	<-peer.codec.Done()
+
+	if err := peer.codec.Err(); err != nil {
+		log.Printf("Disconnected from peer %s: %v", peer.Address, err)
+		if msgErr, ok := err.(*MessageError); ok {
+			n.misbehaving(peer, scoreMalformed, msgErr.Error())
+		}
+	}
 
 	// Remove from peers when done
 	n.mu.Lock()
-	delete(n.peers, peer.Address)
+	delete(n.pending, peer)
+	if id := peer.ID(); id != "" && n.peers[id] == peer {
+		delete(n.peers, id)
+	}
 	n.mu.Unlock()
+
+	n.syncer.peerDisconnected(peer)
 }
 
-// handlePeer handles communication with a peer
-func (n *Node) handlePeer(peer *Peer) {
-	buffer := make([]byte, 4096)
+// disconnect logs why a peer is dropped and closes its connection
+func (n *Node) disconnect(peer *Peer, reason string) {
+	log.Printf("Disconnecting peer %s: %s", peer.Address, reason)
+	peer.codec.Close()
+}
 
-	for {
-		// Read message
-		bytesRead, err := peer.Conn.Read(buffer)
-		if err != nil {
-			log.Printf("Error reading from peer %s: %v", peer.Address, err)
-			return
+// sendMessage queues a message for a peer
+func (n *Node) sendMessage(peer *Peer, message Message) error {
+	return peer.codec.Send(message)
+}
+
+// processMessage processes a received message. An error is a protocol
+// violation and disconnects the peer.
+func (n *Node) processMessage(peer *Peer, message Message) error {
+	switch msg := message.(type) {
+	case *MsgVersion:
+		return n.handleVersion(peer, msg)
+	case *MsgVerAck:
+		return n.handleVerAck(peer)
+	}
+
+	if !peer.handshakeComplete() {
+		return fmt.Errorf("received before the handshake completed")
+	}
+
+	switch msg := message.(type) {
+	case *MsgPing:
+		return n.sendMessage(peer, &MsgPong{Nonce: msg.Nonce})
+	case *MsgPong:
+		n.handlePong(peer, msg)
+	case *MsgInv:
+		return n.handleInv(peer, msg)
+	case *MsgGetData:
+		return n.handleGetData(peer, msg)
+	case *MsgVertex:
+		return n.handleVertex(peer, msg)
+	case *MsgTx:
+		return n.handleTx(peer, msg)
+	case *MsgGetAddr:
+		return n.handleGetAddr(peer)
+	case *MsgAddr:
+		return n.handleAddr(peer, msg)
+	case *MsgGetHeaders:
+		return n.handleGetHeaders(peer, msg)
+	case *MsgHeaders:
+		return n.syncer.handleHeaders(peer, msg)
+	case *MsgReject:
+		log.Printf("Peer %s rejected our %s: %s", peer.Address, msg.Rejected, msg.Reason)
+		if msg.Rejected == CmdGetData {
+			peer.answered(InvVect{Type: InvVertex, Hash: msg.Hash})
+			peer.answered(InvVect{Type: InvTx, Hash: msg.Hash})
+			n.syncer.handleNotFound(peer, msg.Hash)
 		}
+	default:
+		log.Printf("Received %s from peer %s", message.Command(), peer.Address)
+	}
+	return nil
+}
 
-		// Update last seen
-		peer.LastSeen = time.Now()
+// versionMessage describes this node to a new peer
+func (n *Node) versionMessage() *MsgVersion {
+	tips := n.dagStore.GetTips()
+	if len(tips) > MaxTipsPerMsg {
+		tips = tips[:MaxTipsPerMsg]
+	}
 
-		// Process message
-		message := buffer[:bytesRead]
-		if err := n.processMessage(peer, message); err != nil {
-			log.Printf("Error processing message from peer %s: %v", peer.Address, err)
+	return &MsgVersion{
+		ProtocolVersion: ProtocolVersion,
+		Network:         n.params.NetMagic,
+		Genesis:         n.params.GenesisHash(),
+		NodeID:          n.identity.ID,
+		Services:        ServiceFullNode,
+		Tips:            tips,
+		ListenAddress:   n.address,
+		UserAgent:       UserAgent,
+		Timestamp:       n.clock.Now().Unix(),
+	}
+}
+
+// handleVersion checks the peer is on the same network and is not this
+// node, then acknowledges it
+func (n *Node) handleVersion(peer *Peer, msg *MsgVersion) error {
+	peer.mu.Lock()
+	duplicate := peer.version != nil
+	peer.mu.Unlock()
+	if duplicate {
+		return fmt.Errorf("duplicate version message")
+	}
+
+	switch {
+	case msg.Network != n.params.NetMagic:
+		return fmt.Errorf("peer is on network %08x, not %08x", msg.Network, n.params.NetMagic)
+	case msg.Genesis != n.params.GenesisHash():
+		return fmt.Errorf("peer has genesis %s, not %s", msg.Genesis, n.params.GenesisHash())
+	case msg.ProtocolVersion < MinProtocolVersion:
+		return fmt.Errorf("protocol version %d is older than %d", msg.ProtocolVersion, MinProtocolVersion)
+	case msg.NodeID == "":
+		return fmt.Errorf("missing node ID")
+	case msg.NodeID == n.identity.ID:
+		// Never dial this address again. Whichever side of the connection
+		// notices first, the dialled address is known.
+		if !peer.Inbound {
+			n.book.SetLocal(peer.Address)
+		} else if address := advertisedAddress(peer.Address, msg.ListenAddress); address != "" {
+			n.book.SetLocal(address)
 		}
+		return fmt.Errorf("connected to self")
+	case peer.keyID != "" && msg.NodeID != peer.keyID:
+		return fmt.Errorf("node ID %s does not match the key %s the peer holds", msg.NodeID, peer.keyID)
+	}
+
+	peer.mu.Lock()
+	peer.version = msg
+	peer.id = msg.NodeID
+	peer.mu.Unlock()
+
+	if err := n.sendMessage(peer, &MsgVerAck{}); err != nil {
+		return err
 	}
+	return n.completeHandshake(peer)
 }
 
-// sendMessage sends a message to a peer
-func (n *Node) sendMessage(peer *Peer, message []byte) error {
-	_, err := peer.Conn.Write(message)
-	return err
+// handleVerAck records that the peer accepted our version
+func (n *Node) handleVerAck(peer *Peer) error {
+	peer.mu.Lock()
+	duplicate := peer.verAck
+	peer.verAck = true
+	peer.mu.Unlock()
+	if duplicate {
+		return fmt.Errorf("duplicate verack message")
+	}
+
+	return n.completeHandshake(peer)
 }
 
-// processMessage processes a received message
-func (n *Node) processMessage(peer *Peer, message []byte) error {
-	// Simple message processing - in production, this would be more sophisticated
-	log.Printf("Received message from peer %s: %s", peer.Address, string(message))
+// completeHandshake moves the peer into the peer set once both sides have
+// accepted each other's version
+func (n *Node) completeHandshake(peer *Peer) error {
+	if !peer.handshakeComplete() {
+		return nil
+	}
+
+	id := peer.ID()
+	n.mu.Lock()
+	existing, exists := n.peers[id]
+	// A plaintext peer only claims its ID, so a peer that proves it holds
+	// the key takes the ID over rather than being locked out
+	if exists && (existing.keyID != "" || peer.keyID == "") {
+		n.mu.Unlock()
+		return fmt.Errorf("already connected to node %s", id)
+	}
+	delete(n.pending, peer)
+	n.peers[id] = peer
+	n.mu.Unlock()
+
+	if exists {
+		n.disconnect(existing, fmt.Sprintf("node ID %s was proven by peer %s", id, peer.Address))
+	}
+
+	info := peer.info()
+	log.Printf("Handshake complete with peer %s at %s (%s, protocol %d)", id, peer.Address, info.UserAgent, info.ProtocolVersion)
+
+	n.syncer.peerReady(peer)
+	n.peerDiscovered(peer)
 	return nil
 }
 
-// peerMaintenance maintains peer connections
+// outboundCount returns the number of outbound connections, including
+// those still in the handshake
+func (n *Node) outboundCount() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	count := 0
+	for _, peer := range n.peers {
+		if !peer.Inbound {
+			count++
+		}
+	}
+	for peer := range n.pending {
+		if !peer.Inbound {
+			count++
+		}
+	}
+	return count
+}
+
+// readyPeers returns the peers that completed the handshake
+func (n *Node) readyPeers() []*Peer {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	peers := make([]*Peer, 0, len(n.peers))
+	for _, peer := range n.peers {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// isConnected reports whether a peer at address is connected or connecting
+func (n *Node) isConnected(address string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, peer := range n.peers {
+		if peer.Address == address {
+			return true
+		}
+	}
+	for peer := range n.pending {
+		if peer.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// peerMaintenance checks peers are alive and prunes stale requests
 func (n *Node) peerMaintenance(ctx context.Context) {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+	liveness := n.clock.After(livenessInterval)
+	prune := n.clock.After(pruneInterval)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			n.cleanupDeadPeers()
+		case <-liveness:
+			n.checkLiveness()
+			liveness = n.clock.After(livenessInterval)
+		case <-prune:
+			n.pruneRequests()
+			n.acceptReleased() // released by vertices the miner or RPC added
+			prune = n.clock.After(pruneInterval)
 		}
 	}
 }
 
-// cleanupDeadPeers removes peers that haven't been seen recently
-func (n *Node) cleanupDeadPeers() {
-	n.mu.Lock()
-	defer n.mu.Unlock()
+// ID returns the peer's node ID, or "" before its version arrives
+func (p *Peer) ID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.id
+}
 
-	cutoff := time.Now().Add(-5 * time.Minute)
-	for address, peer := range n.peers {
-		if peer.LastSeen.Before(cutoff) {
-			peer.Conn.Close()
-			delete(n.peers, address)
-			log.Printf("Removed dead peer %s", address)
-		}
+// tips returns the tips the peer advertised in its version message
+func (p *Peer) tips() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.version == nil {
+		return nil
 	}
+	return p.version.Tips
 }
 
-// generatePeerID generates a unique peer ID
-func generatePeerID() string {
-	return fmt.Sprintf("peer_%d", time.Now().UnixNano())
+// handshakeComplete reports whether both versions have been accepted
+func (p *Peer) handshakeComplete() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.version != nil && p.verAck
+}
+
+// info returns a snapshot of the peer
+func (p *Peer) info() PeerInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info := PeerInfo{
+		ID:            p.id,
+		Address:       p.Address,
+		Inbound:       p.Inbound,
+		Encrypted:     p.keyID != "",
+		BanScore:      p.score,
+		LastSeen:      p.lastSeen,
+		RTT:           p.rtt,
+		BytesSent:     p.codec.BytesSent(),
+		BytesReceived: p.codec.BytesReceived(),
+	}
+	if p.version != nil {
+		info.ProtocolVersion = p.version.ProtocolVersion
+		info.Services = p.version.Services
+		info.UserAgent = p.version.UserAgent
+	}
+	return info
 }
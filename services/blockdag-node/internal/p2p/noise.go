@@ -0,0 +1,389 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// noiseProtocol names the handshake pattern and primitives; it is hashed
+// into the handshake so both sides must agree on it
+const noiseProtocol = "Noise_XX_25519_ChaChaPoly_SHA256"
+
+// maxNoiseMessage bounds one handshake or transport message, tag included
+const maxNoiseMessage = 65535
+
+// noiseCipher is a Noise cipher state: a key and a counter nonce
+type noiseCipher struct {
+	aead  cipher.AEAD
+	nonce uint64
+}
+
+// newNoiseCipher creates a cipher state for a 32-byte key
+func newNoiseCipher(key []byte) (*noiseCipher, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &noiseCipher{aead: aead}, nil
+}
+
+// encrypt seals plaintext with the next nonce
+func (c *noiseCipher) encrypt(ad, plaintext []byte) []byte {
+	nonce := c.nextNonce()
+	return c.aead.Seal(nil, nonce, plaintext, ad)
+}
+
+// decrypt opens ciphertext with the next nonce
+func (c *noiseCipher) decrypt(ad, ciphertext []byte) ([]byte, error) {
+	nonce := c.nextNonce()
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, fmt.Errorf("message failed authentication")
+	}
+	return plaintext, nil
+}
+
+// nextNonce encodes the counter as Noise does for ChaChaPoly: four zero
+// bytes then the counter little-endian
+func (c *noiseCipher) nextNonce() []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], c.nonce)
+	c.nonce++
+	return nonce
+}
+
+// noiseState is the Noise symmetric state: the chaining key, the
+// handshake hash and the cipher once a key has been mixed in
+type noiseState struct {
+	ck     []byte
+	h      []byte
+	cipher *noiseCipher
+}
+
+// newNoiseState initializes the symmetric state and mixes in the prologue
+func newNoiseState(prologue []byte) *noiseState {
+	h := make([]byte, sha256.Size)
+	copy(h, noiseProtocol)
+	s := &noiseState{ck: append([]byte{}, h...), h: h}
+	s.mixHash(prologue)
+	return s
+}
+
+// mixHash folds data into the handshake hash
+func (s *noiseState) mixHash(data []byte) {
+	hash := sha256.New()
+	hash.Write(s.h)
+	hash.Write(data)
+	s.h = hash.Sum(nil)
+}
+
+// mixKey derives a new chaining key and cipher key from a DH result
+func (s *noiseState) mixKey(ikm []byte) error {
+	ck, key := noiseHKDF(s.ck, ikm)
+	s.ck = ck
+	cipher, err := newNoiseCipher(key)
+	if err != nil {
+		return err
+	}
+	s.cipher = cipher
+	return nil
+}
+
+// encryptAndHash encrypts once a key is set and folds the result into the
+// handshake hash
+func (s *noiseState) encryptAndHash(plaintext []byte) []byte {
+	ciphertext := plaintext
+	if s.cipher != nil {
+		ciphertext = s.cipher.encrypt(s.h, plaintext)
+	}
+	s.mixHash(ciphertext)
+	return ciphertext
+}
+
+// decryptAndHash reverses encryptAndHash
+func (s *noiseState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext := ciphertext
+	if s.cipher != nil {
+		var err error
+		if plaintext, err = s.cipher.decrypt(s.h, ciphertext); err != nil {
+			return nil, err
+		}
+	}
+	s.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// split derives the transport ciphers: initiator to responder first
+func (s *noiseState) split() (*noiseCipher, *noiseCipher, error) {
+	key1, key2 := noiseHKDF(s.ck, nil)
+	first, err := newNoiseCipher(key1)
+	if err != nil {
+		return nil, nil, err
+	}
+	second, err := newNoiseCipher(key2)
+	if err != nil {
+		return nil, nil, err
+	}
+	return first, second, nil
+}
+
+// noiseHKDF is the two-output HKDF of the Noise specification
+func noiseHKDF(ck, ikm []byte) ([]byte, []byte) {
+	mac := hmac.New(sha256.New, ck)
+	mac.Write(ikm)
+	temp := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, temp)
+	mac.Write([]byte{0x01})
+	out1 := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, temp)
+	mac.Write(out1)
+	mac.Write([]byte{0x02})
+	out2 := mac.Sum(nil)
+
+	return out1, out2
+}
+
+// secureHandshake runs the Noise XX handshake over conn with the node's
+// static key, returning an encrypted connection and the ID of the key the
+// peer proved it holds. The network magic is the prologue, so nodes on
+// different networks fail the handshake. It gives up at deadline.
+func secureHandshake(conn net.Conn, identity *Identity, magic uint32, initiator bool, deadline time.Time) (*secureConn, string, error) {
+	conn.SetDeadline(deadline)
+	defer conn.SetDeadline(time.Time{})
+
+	prologue := binary.BigEndian.AppendUint32(nil, magic)
+	state := newNoiseState(prologue)
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	static := identity.PrivateKey
+	var remoteEphemeral, remoteStatic *ecdh.PublicKey
+
+	// dh mixes the shared secret of a local and a remote key into the state
+	dh := func(local *ecdh.PrivateKey, remote *ecdh.PublicKey) error {
+		secret, err := local.ECDH(remote)
+		if err != nil {
+			return err
+		}
+		return state.mixKey(secret)
+	}
+
+	// readKey reads a public key, encrypted once a key is mixed in
+	readKey := func(message *bytes.Reader) (*ecdh.PublicKey, error) {
+		size := 32
+		if state.cipher != nil {
+			size += chacha20poly1305.Overhead
+		}
+		field := make([]byte, size)
+		if _, err := io.ReadFull(message, field); err != nil {
+			return nil, fmt.Errorf("handshake message too short")
+		}
+		raw, err := state.decryptAndHash(field)
+		if err != nil {
+			return nil, err
+		}
+		return ecdh.X25519().NewPublicKey(raw)
+	}
+
+	// readPayload checks the (empty) payload that ends each message
+	readPayload := func(message *bytes.Reader) error {
+		rest, _ := io.ReadAll(message)
+		_, err := state.decryptAndHash(rest)
+		return err
+	}
+
+	if initiator {
+		// -> e
+		message := append([]byte{}, ephemeral.PublicKey().Bytes()...)
+		state.mixHash(message)
+		message = append(message, state.encryptAndHash(nil)...)
+		if err := writeNoiseMessage(conn, message); err != nil {
+			return nil, "", err
+		}
+
+		// <- e, ee, s, es
+		reply, err := readNoiseMessage(conn)
+		if err != nil {
+			return nil, "", err
+		}
+		r := bytes.NewReader(reply)
+		if remoteEphemeral, err = readKey(r); err != nil {
+			return nil, "", err
+		}
+		if err := dh(ephemeral, remoteEphemeral); err != nil {
+			return nil, "", err
+		}
+		if remoteStatic, err = readKey(r); err != nil {
+			return nil, "", err
+		}
+		if err := dh(ephemeral, remoteStatic); err != nil {
+			return nil, "", err
+		}
+		if err := readPayload(r); err != nil {
+			return nil, "", err
+		}
+
+		// -> s, se
+		message = state.encryptAndHash(static.PublicKey().Bytes())
+		if err := dh(static, remoteEphemeral); err != nil {
+			return nil, "", err
+		}
+		message = append(message, state.encryptAndHash(nil)...)
+		if err := writeNoiseMessage(conn, message); err != nil {
+			return nil, "", err
+		}
+	} else {
+		// -> e
+		first, err := readNoiseMessage(conn)
+		if err != nil {
+			return nil, "", err
+		}
+		r := bytes.NewReader(first)
+		if remoteEphemeral, err = readKey(r); err != nil {
+			return nil, "", err
+		}
+		if err := readPayload(r); err != nil {
+			return nil, "", err
+		}
+
+		// <- e, ee, s, es
+		message := append([]byte{}, ephemeral.PublicKey().Bytes()...)
+		state.mixHash(message)
+		if err := dh(ephemeral, remoteEphemeral); err != nil {
+			return nil, "", err
+		}
+		message = append(message, state.encryptAndHash(static.PublicKey().Bytes())...)
+		if err := dh(static, remoteEphemeral); err != nil {
+			return nil, "", err
+		}
+		message = append(message, state.encryptAndHash(nil)...)
+		if err := writeNoiseMessage(conn, message); err != nil {
+			return nil, "", err
+		}
+
+		// -> s, se
+		last, err := readNoiseMessage(conn)
+		if err != nil {
+			return nil, "", err
+		}
+		r = bytes.NewReader(last)
+		if remoteStatic, err = readKey(r); err != nil {
+			return nil, "", err
+		}
+		if err := dh(ephemeral, remoteStatic); err != nil {
+			return nil, "", err
+		}
+		if err := readPayload(r); err != nil {
+			return nil, "", err
+		}
+	}
+
+	send, receive, err := state.split()
+	if err != nil {
+		return nil, "", err
+	}
+	if !initiator {
+		send, receive = receive, send
+	}
+	return &secureConn{Conn: conn, send: send, receive: receive}, NodeID(remoteStatic), nil
+}
+
+// writeNoiseMessage writes a length-prefixed Noise message
+func writeNoiseMessage(w io.Writer, message []byte) error {
+	if len(message) > maxNoiseMessage {
+		return fmt.Errorf("noise message of %d bytes is too long", len(message))
+	}
+	frame := binary.BigEndian.AppendUint16(nil, uint16(len(message)))
+	_, err := w.Write(append(frame, message...))
+	return err
+}
+
+// readNoiseMessage reads a length-prefixed Noise message
+func readNoiseMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	message := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// secureConn encrypts a connection with the ciphers agreed in the Noise
+// handshake. Each write is sent as one or more Noise transport messages.
+type secureConn struct {
+	net.Conn
+
+	writeMu sync.Mutex
+	send    *noiseCipher
+
+	receive *noiseCipher
+	pending []byte // decrypted bytes not read yet
+}
+
+// Read returns decrypted bytes, reading the next message when none are left
+func (c *secureConn) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		message, err := readNoiseMessage(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		if c.pending, err = c.receive.decrypt(nil, message); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write encrypts p into as many messages as it needs
+func (c *secureConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxNoiseMessage-chacha20poly1305.Overhead {
+			chunk = chunk[:maxNoiseMessage-chacha20poly1305.Overhead]
+		}
+		if err := writeNoiseMessage(c.Conn, c.send.encrypt(nil, chunk)); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// replayConn hands back bytes already read from a connection before
+// reading on, so a sniffed prefix is not lost
+type replayConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+// Read reads the replayed bytes first
+func (c *replayConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
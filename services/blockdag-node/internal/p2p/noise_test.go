@@ -0,0 +1,116 @@
+package p2p
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// handshakeResult is what one side of a test handshake returned
+type handshakeResult struct {
+	conn  *secureConn
+	keyID string
+	err   error
+}
+
+// handshakePair runs the handshake between two identities over a pipe,
+// each side with its own network magic
+func handshakePair(t *testing.T, initiator, responder *Identity, initiatorMagic, responderMagic uint32) (handshakeResult, handshakeResult) {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	results := make(chan handshakeResult, 1)
+	go func() {
+		conn, keyID, err := secureHandshake(b, responder, responderMagic, false, deadline)
+		if err != nil {
+			b.Close() // unblock the initiator
+		}
+		results <- handshakeResult{conn, keyID, err}
+	}()
+
+	conn, keyID, err := secureHandshake(a, initiator, initiatorMagic, true, deadline)
+	if err != nil {
+		a.Close()
+	}
+	return handshakeResult{conn, keyID, err}, <-results
+}
+
+func newTestIdentity(t *testing.T) *Identity {
+	t.Helper()
+	identity, err := GenerateIdentity()
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+	return identity
+}
+
+func TestNoiseHandshakeRoundTrip(t *testing.T) {
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+	initiator, responder := handshakePair(t, alice, bob, 0xd9b4bef9, 0xd9b4bef9)
+	if initiator.err != nil || responder.err != nil {
+		t.Fatalf("handshake failed: initiator %v, responder %v", initiator.err, responder.err)
+	}
+
+	// Each side learns the ID of the key the other proved it holds
+	if initiator.keyID != bob.ID {
+		t.Errorf("initiator saw key %s, want %s", initiator.keyID, bob.ID)
+	}
+	if responder.keyID != alice.ID {
+		t.Errorf("responder saw key %s, want %s", responder.keyID, alice.ID)
+	}
+
+	tests := []struct {
+		name     string
+		from, to *secureConn
+		message  []byte
+	}{
+		{"initiator to responder", initiator.conn, responder.conn, []byte("version")},
+		{"responder to initiator", responder.conn, initiator.conn, []byte("verack")},
+		{"longer than one noise message", initiator.conn, responder.conn, bytes.Repeat([]byte{0xab}, 3*maxNoiseMessage)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			go tt.from.Write(tt.message)
+
+			received := make([]byte, len(tt.message))
+			if _, err := io.ReadFull(tt.to, received); err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !bytes.Equal(received, tt.message) {
+				t.Errorf("received %d bytes that differ from the %d sent", len(received), len(tt.message))
+			}
+		})
+	}
+}
+
+func TestNoiseHandshakeEncrypts(t *testing.T) {
+	initiator, responder := handshakePair(t, newTestIdentity(t), newTestIdentity(t), 1, 1)
+	if initiator.err != nil || responder.err != nil {
+		t.Fatalf("handshake failed: initiator %v, responder %v", initiator.err, responder.err)
+	}
+
+	// Read the frame off the wire, below the responder's cipher
+	plaintext := []byte("a message only the peer can read")
+	go initiator.conn.Write(plaintext)
+	frame, err := readNoiseMessage(responder.conn.Conn)
+	if err != nil {
+		t.Fatalf("reading the raw frame: %v", err)
+	}
+	if bytes.Contains(frame, plaintext) {
+		t.Error("the frame carries the plaintext")
+	}
+}
+
+func TestNoiseHandshakeRejectsOtherNetwork(t *testing.T) {
+	initiator, responder := handshakePair(t, newTestIdentity(t), newTestIdentity(t), 1, 2)
+	if initiator.err == nil && responder.err == nil {
+		t.Fatal("handshake across networks succeeded")
+	}
+}
@@ -0,0 +1,373 @@
+package p2p
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/internal/mempool"
+)
+
+// maxKnownInventory bounds the items remembered per peer
+const maxKnownInventory = 10000
+
+// maxOrphans bounds the vertices held while their parents are fetched
+const maxOrphans = 100
+
+// requestTimeout is how long an item requested from one peer is left
+// before another peer may be asked for it
+const requestTimeout = 30 * time.Second
+
+// inventorySet remembers the most recent items a peer is known to have,
+// so they are not announced back to it
+type inventorySet struct {
+	mu    sync.Mutex
+	items map[InvVect]bool
+	order []InvVect // oldest first, for eviction
+}
+
+// newInventorySet creates an empty inventory set
+func newInventorySet() *inventorySet {
+	return &inventorySet{items: make(map[InvVect]bool)}
+}
+
+// add records an item, evicting the oldest once the set is full
+func (s *inventorySet) add(item InvVect) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.items[item] {
+		return
+	}
+	if len(s.order) >= maxKnownInventory {
+		delete(s.items, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.items[item] = true
+	s.order = append(s.order, item)
+}
+
+// has reports whether an item is recorded
+func (s *inventorySet) has(item InvVect) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.items[item]
+}
+
+// orphanVertex is a vertex waiting for missing parents
+type orphanVertex struct {
+	vertex *dag.Vertex
+	peer   *Peer
+	added  time.Time
+}
+
+// onVertexAdded announces every accepted vertex, mined or relayed, and
+// releases the orphans that were waiting for it. They are accepted once
+// the AddVertex that released them returns, so the store's other handlers
+// see the parent before its children.
+func (n *Node) onVertexAdded(vertex *dag.Vertex) {
+	n.announce(InvVect{Type: InvVertex, Hash: vertex.ID})
+	n.releaseReadyOrphans()
+}
+
+// onTransactionAdded announces every transaction accepted into the mempool
+func (n *Node) onTransactionAdded(tx *mempool.Transaction) {
+	n.announce(InvVect{Type: InvTx, Hash: tx.ID})
+}
+
+// announce sends an inventory item to every peer not known to have it
+func (n *Node) announce(item InvVect) {
+	for _, peer := range n.readyPeers() {
+		if peer.known.has(item) {
+			continue
+		}
+		peer.known.add(item)
+		if err := n.sendMessage(peer, &MsgInv{Items: []InvVect{item}}); err != nil {
+			log.Printf("Failed to announce %s %s to peer %s: %v", item.Type, item.Hash, peer.Address, err)
+		}
+	}
+}
+
+// handleInv requests the announced items this node does not have
+func (n *Node) handleInv(peer *Peer, msg *MsgInv) error {
+	syncing := n.syncer.isSyncing()
+	wanted := make([]InvVect, 0, len(msg.Items))
+	for _, item := range msg.Items {
+		peer.known.add(item)
+
+		// New vertices are picked up by the sync once it catches up
+		if item.Type == InvVertex && syncing {
+			continue
+		}
+		if n.haveItem(item) || !n.markRequested(item) {
+			continue
+		}
+		wanted = append(wanted, item)
+	}
+
+	if len(wanted) == 0 {
+		return nil
+	}
+	return n.requestData(peer, wanted)
+}
+
+// handleGetData sends the requested items, rejecting those this node
+// does not have. A getdata can ask for more items than the send queue
+// holds, so replies wait for room; reading from the peer pauses meanwhile.
+func (n *Node) handleGetData(peer *Peer, msg *MsgGetData) error {
+	for _, item := range msg.Items {
+		var reply Message
+		switch item.Type {
+		case InvVertex:
+			if vertex, err := n.dagStore.GetVertex(item.Hash); err == nil {
+				reply = &MsgVertex{Vertex: vertex}
+			}
+		case InvTx:
+			if tx, exists := n.mempool.GetTransaction(item.Hash); exists {
+				reply = &MsgTx{Data: tx.Data}
+			}
+		}
+		if reply == nil {
+			reply = &MsgReject{Rejected: CmdGetData, Reason: "not found", Hash: item.Hash}
+		} else {
+			peer.known.add(item)
+		}
+
+		if err := peer.codec.SendWait(reply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleVertex validates a vertex from a peer before adding it to the DAG
+func (n *Node) handleVertex(peer *Peer, msg *MsgVertex) error {
+	vertex := msg.Vertex
+	item := InvVect{Type: InvVertex, Hash: vertex.ID}
+	if !peer.answered(item) {
+		n.misbehaving(peer, scoreUnrequested, fmt.Sprintf("sent unrequested vertex %s", vertex.ID))
+	}
+	if handled, err := n.syncer.handleBody(peer, vertex); handled {
+		if err != nil {
+			n.misbehaving(peer, scoreInvalidVertex, err.Error())
+		}
+		return nil
+	}
+
+	peer.known.add(item)
+	n.clearRequested(item)
+
+	if n.dagStore.HasVertex(vertex.ID) {
+		return nil
+	}
+
+	// Check the work before holding on to a vertex whose parents are missing
+	if err := n.consensusEngine.IsValidHeader(vertex.Header()); err != nil {
+		rejectErr := n.reject(peer, CmdVertex, vertex.ID, err.Error())
+		n.invalidHeader(peer, vertex.Header(), err)
+		return rejectErr
+	}
+
+	missing := make([]InvVect, 0)
+	for _, parentID := range vertex.Parents {
+		parent := InvVect{Type: InvVertex, Hash: parentID}
+		if !n.dagStore.HasVertex(parentID) && n.markRequested(parent) {
+			missing = append(missing, parent)
+		}
+	}
+	if n.addOrphan(peer, vertex) {
+		if len(missing) == 0 {
+			return nil
+		}
+		return n.requestData(peer, missing)
+	}
+
+	n.acceptVertex(peer, vertex)
+	return nil
+}
+
+// acceptVertex adds a vertex and then the orphans it released
+func (n *Node) acceptVertex(peer *Peer, vertex *dag.Vertex) {
+	n.addVertex(peer, vertex)
+	n.acceptReleased()
+}
+
+// acceptReleased adds the released orphans, and those they release in turn
+func (n *Node) acceptReleased() {
+	for {
+		n.relayMu.Lock()
+		if len(n.released) == 0 {
+			n.relayMu.Unlock()
+			return
+		}
+		orphan := n.released[0]
+		n.released = n.released[1:]
+		n.relayMu.Unlock()
+
+		n.addVertex(orphan.peer, orphan.vertex)
+	}
+}
+
+// addVertex runs full validation and adds the vertex to the DAG. The
+// store's handlers then relay it to the other peers.
+func (n *Node) addVertex(peer *Peer, vertex *dag.Vertex) {
+	if err := n.consensusEngine.IsValidVertex(vertex); err != nil {
+		n.reject(peer, CmdVertex, vertex.ID, err.Error())
+		n.misbehaving(peer, scoreInvalidVertex, fmt.Sprintf("invalid vertex %s: %v", vertex.ID, err))
+		return
+	}
+
+	if err := n.dagStore.AddVertex(vertex); err != nil {
+		if !n.dagStore.HasVertex(vertex.ID) {
+			log.Printf("Failed to add vertex %s from peer %s: %v", vertex.ID, peer.Address, err)
+		}
+		return
+	}
+
+	log.Printf("Accepted vertex %s from peer %s", vertex.ID, peer.Address)
+}
+
+// handleTx validates a transaction from a peer before adding it to the mempool
+func (n *Node) handleTx(peer *Peer, msg *MsgTx) error {
+	ltx, err := ledger.ParseTransaction(msg.Data)
+	if err != nil {
+		n.misbehaving(peer, scoreMalformed, fmt.Sprintf("malformed transaction: %v", err))
+		return n.reject(peer, CmdTx, "", err.Error())
+	}
+	tx, err := mempool.NewTransaction(ltx)
+	if err != nil {
+		n.misbehaving(peer, scoreMalformed, fmt.Sprintf("malformed transaction: %v", err))
+		return n.reject(peer, CmdTx, "", err.Error())
+	}
+
+	item := InvVect{Type: InvTx, Hash: tx.ID}
+	if !peer.answered(item) {
+		n.misbehaving(peer, scoreUnrequested, fmt.Sprintf("sent unrequested transaction %s", tx.ID))
+	}
+	peer.known.add(item)
+	n.clearRequested(item)
+
+	if _, exists := n.mempool.GetTransaction(tx.ID); exists {
+		return nil
+	}
+	if err := n.state.CheckTransaction(ltx); err != nil {
+		return n.reject(peer, CmdTx, tx.ID, err.Error())
+	}
+
+	return n.mempool.AddTransaction(tx)
+}
+
+// reject tells a peer why one of its items was refused
+func (n *Node) reject(peer *Peer, command, hash, reason string) error {
+	log.Printf("Rejected %s %s from peer %s: %s", command, hash, peer.Address, reason)
+	return n.sendMessage(peer, &MsgReject{Rejected: command, Reason: reason, Hash: hash})
+}
+
+// haveItem reports whether an item is already in the DAG or mempool
+func (n *Node) haveItem(item InvVect) bool {
+	switch item.Type {
+	case InvVertex:
+		if n.dagStore.HasVertex(item.Hash) {
+			return true
+		}
+		n.relayMu.Lock()
+		_, orphan := n.orphans[item.Hash]
+		n.relayMu.Unlock()
+		return orphan
+	case InvTx:
+		_, exists := n.mempool.GetTransaction(item.Hash)
+		return exists
+	}
+	return false
+}
+
+// markRequested records that an item is being fetched, reporting false if
+// another peer was already asked for it recently
+func (n *Node) markRequested(item InvVect) bool {
+	n.relayMu.Lock()
+	defer n.relayMu.Unlock()
+
+	now := n.clock.Now()
+	if requested, exists := n.requested[item]; exists && now.Sub(requested) < requestTimeout {
+		return false
+	}
+	n.requested[item] = now
+	return true
+}
+
+// clearRequested forgets a request once the item arrives
+func (n *Node) clearRequested(item InvVect) {
+	n.relayMu.Lock()
+	defer n.relayMu.Unlock()
+	delete(n.requested, item)
+}
+
+// addOrphan holds a vertex until its parents arrive, reporting false if
+// none are missing
+func (n *Node) addOrphan(peer *Peer, vertex *dag.Vertex) bool {
+	n.relayMu.Lock()
+	defer n.relayMu.Unlock()
+
+	if n.parentsPresent(vertex) {
+		return false
+	}
+
+	if len(n.orphans) >= maxOrphans {
+		n.evictOldestOrphan()
+	}
+	n.orphans[vertex.ID] = &orphanVertex{vertex: vertex, peer: peer, added: n.clock.Now()}
+	return true
+}
+
+// releaseReadyOrphans moves the orphans whose parents are all present to
+// the released queue
+func (n *Node) releaseReadyOrphans() {
+	n.relayMu.Lock()
+	defer n.relayMu.Unlock()
+
+	for id, orphan := range n.orphans {
+		if n.parentsPresent(orphan.vertex) {
+			n.released = append(n.released, orphan)
+			delete(n.orphans, id)
+		}
+	}
+}
+
+// parentsPresent reports whether all of a vertex's parents are in the DAG
+func (n *Node) parentsPresent(vertex *dag.Vertex) bool {
+	for _, parentID := range vertex.Parents {
+		if !n.dagStore.HasVertex(parentID) {
+			return false
+		}
+	}
+	return true
+}
+
+// evictOldestOrphan drops the orphan held the longest
+func (n *Node) evictOldestOrphan() {
+	var oldest *orphanVertex
+	for _, orphan := range n.orphans {
+		if oldest == nil || orphan.added.Before(oldest.added) {
+			oldest = orphan
+		}
+	}
+	if oldest != nil {
+		delete(n.orphans, oldest.vertex.ID)
+	}
+}
+
+// pruneRequests forgets requests that were never answered
+func (n *Node) pruneRequests() {
+	n.relayMu.Lock()
+	defer n.relayMu.Unlock()
+
+	now := n.clock.Now()
+	for item, requested := range n.requested {
+		if now.Sub(requested) >= requestTimeout {
+			delete(n.requested, item)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package p2p
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/internal/mempool"
+	"hackodisha/blockdag-node/storage"
+)
+
+// newTestNode returns a node over a DevNet DAG holding only genesis
+func newTestNode(t *testing.T) *Node {
+	t.Helper()
+	params := &chaincfg.DevNetParams
+	store := dag.NewStore(storage.NewMemoryDB())
+	if err := store.AddVertex(params.Genesis()); err != nil {
+		t.Fatalf("adding genesis: %v", err)
+	}
+	identity, err := GenerateIdentity()
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+	n, err := NewNode("127.0.0.1:0", params, identity, store, consensus.NewEngine(store, params), mempool.NewMempool(100), ledger.NewState(), nil, nil)
+	if err != nil {
+		t.Fatalf("NewNode: %v", err)
+	}
+	return n
+}
+
+// testVertex returns a valid empty vertex on the given parents
+func testVertex(t *testing.T, id string, seconds int, parents ...string) *dag.Vertex {
+	t.Helper()
+	params := &chaincfg.DevNetParams
+	vertex := &dag.Vertex{
+		ID:        id,
+		Data:      ledger.EncodePayload(nil),
+		Parents:   parents,
+		Timestamp: params.GenesisTime.Add(time.Duration(seconds) * time.Second),
+		Weight:    params.VertexWeight(),
+	}
+	vertex.PayloadRoot, _ = ledger.PayloadRoot(vertex.Data)
+	vertex.Hash = vertex.CalculateHash()
+	return vertex
+}
+
+func TestOrphansWaitForTheirParentsHandlers(t *testing.T) {
+	n := newTestNode(t)
+	peer := &Peer{Address: "peer", known: newInventorySet()}
+	genesis := chaincfg.DevNetParams.Genesis().ID
+
+	// A handler registered after the node's must still see every parent
+	// before its children
+	seen := map[string]bool{genesis: true}
+	order := make([]string, 0)
+	n.dagStore.OnVertexAdded(func(vertex *dag.Vertex) {
+		for _, parentID := range vertex.Parents {
+			if !seen[parentID] {
+				t.Errorf("handler saw %s before its parent %s", vertex.ID, parentID)
+			}
+		}
+		seen[vertex.ID] = true
+		order = append(order, vertex.ID)
+	})
+
+	// A chain v1..v5 arrives backwards, so v2..v5 wait as orphans
+	vertices := make([]*dag.Vertex, 5)
+	parent := genesis
+	for i := range vertices {
+		vertices[i] = testVertex(t, fmt.Sprintf("v%d", i+1), i+1, parent)
+		parent = vertices[i].ID
+	}
+	for i := len(vertices) - 1; i > 0; i-- {
+		if !n.addOrphan(peer, vertices[i]) {
+			t.Fatalf("%s was not held as an orphan", vertices[i].ID)
+		}
+	}
+
+	n.acceptVertex(peer, vertices[0])
+	if want := "[v1 v2 v3 v4 v5]"; fmt.Sprint(order) != want {
+		t.Errorf("added %v, want %s", order, want)
+	}
+	if len(n.orphans) != 0 || len(n.released) != 0 {
+		t.Errorf("%d orphans and %d released left", len(n.orphans), len(n.released))
+	}
+}
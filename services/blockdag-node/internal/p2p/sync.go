@@ -0,0 +1,727 @@
+package p2p
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+)
+
+// Sync states reported by SyncStatus
+const (
+	SyncSyncing = "syncing"
+	SyncSynced  = "synced"
+)
+
+// maxBodiesInFlight bounds the vertex bodies requested from one peer at a time
+const maxBodiesInFlight = 16
+
+// headersTimeout is how long the sync peer may take to answer getheaders
+const headersTimeout = 30 * time.Second
+
+// syncTickInterval is how often stalled requests are checked for
+const syncTickInterval = time.Second
+
+// SyncStatus reports the progress of DAG synchronization
+type SyncStatus struct {
+	State             string
+	SyncPeer          string  // node ID of the peer headers come from
+	HeadersReceived   int     // headers downloaded in this sync
+	VerticesProcessed int     // vertices validated and added in this sync
+	VerticesPending   int     // headers still waiting for their vertex
+	Percent           float64 // processed share of the headers known so far
+}
+
+// bodyRequest is a vertex body requested from a peer
+type bodyRequest struct {
+	peer *Peer
+	sent time.Time
+}
+
+// syncManager catches the DAG up with a sync peer: it downloads the headers
+// the node is missing, then fetches their bodies from all peers in parallel
+// and adds them in topological order
+type syncManager struct {
+	node      *Node
+	mu        sync.Mutex
+	processMu sync.Mutex // serializes adding downloaded vertices
+
+	state       string
+	peer        *Peer
+	headers     map[string]*dag.Header // downloaded headers not yet added, by ID
+	queue       []string               // IDs of headers waiting for their body, topological order
+	bodies      map[string]*dag.Vertex // bodies waiting for their turn
+	inFlight    map[string]*bodyRequest
+	notFound    map[string]map[*Peer]bool // peers that did not have a body
+	headersSent time.Time                 // when getheaders was sent; zero if none is outstanding
+
+	headersReceived int
+	processed       int
+}
+
+// newSyncManager creates a sync manager for a node, which starts out synced
+func newSyncManager(node *Node) *syncManager {
+	s := &syncManager{node: node}
+	s.reset(SyncSynced)
+	return s
+}
+
+// run checks for stalled requests until ctx is cancelled
+func (s *syncManager) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.node.clock.After(syncTickInterval):
+			s.checkTimeouts()
+		}
+	}
+}
+
+// status returns a snapshot of the sync progress
+func (s *syncManager) status() SyncStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := SyncStatus{
+		State:             s.state,
+		HeadersReceived:   s.headersReceived,
+		VerticesProcessed: s.processed,
+		VerticesPending:   len(s.queue),
+		Percent:           100,
+	}
+	if s.peer != nil {
+		status.SyncPeer = s.peer.ID()
+	}
+	if s.state == SyncSyncing {
+		status.Percent = 0
+		if total := s.processed + len(s.queue); total > 0 {
+			status.Percent = float64(s.processed) * 100 / float64(total)
+		}
+	}
+	return status
+}
+
+// isSyncing reports whether a sync is in progress
+func (s *syncManager) isSyncing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state == SyncSyncing
+}
+
+// peerReady starts syncing from a peer that just completed the handshake
+// if it advertised tips this node does not have
+func (s *syncManager) peerReady(peer *Peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == SyncSyncing {
+		s.requestBodies()
+		return
+	}
+
+	for _, tip := range peer.tips() {
+		if !s.node.dagStore.HasVertex(tip) {
+			s.start(peer)
+			return
+		}
+	}
+}
+
+// peerDisconnected reassigns a peer's requests, picking a new sync peer if
+// it was the sync peer
+func (s *syncManager) peerDisconnected(peer *Peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, request := range s.inFlight {
+		if request.peer == peer {
+			delete(s.inFlight, id)
+		}
+	}
+	for _, peers := range s.notFound {
+		delete(peers, peer)
+	}
+
+	if s.state != SyncSyncing {
+		return
+	}
+	if peer != s.peer {
+		s.requestBodies()
+		return
+	}
+
+	log.Printf("Lost sync peer %s", peer.Address)
+	s.reset(SyncSynced)
+	if next := s.node.readyPeers(); len(next) > 0 {
+		s.start(next[0])
+	}
+}
+
+// start syncs from peer; the caller holds s.mu
+func (s *syncManager) start(peer *Peer) {
+	s.reset(SyncSyncing)
+	s.peer = peer
+	log.Printf("Syncing DAG from peer %s at %s", peer.ID(), peer.Address)
+	s.sendGetHeaders()
+}
+
+// reset drops all sync progress and enters state; the caller holds s.mu
+func (s *syncManager) reset(state string) {
+	s.state = state
+	s.peer = nil
+	s.headers = make(map[string]*dag.Header)
+	s.queue = nil
+	s.bodies = make(map[string]*dag.Vertex)
+	s.inFlight = make(map[string]*bodyRequest)
+	s.notFound = make(map[string]map[*Peer]bool)
+	s.headersSent = time.Time{}
+	s.headersReceived = 0
+	s.processed = 0
+}
+
+// sendGetHeaders asks the sync peer for the headers after the locator;
+// the caller holds s.mu
+func (s *syncManager) sendGetHeaders() {
+	s.headersSent = s.node.clock.Now()
+	if err := s.node.sendMessage(s.peer, &MsgGetHeaders{Locator: s.locator()}); err != nil {
+		log.Printf("Failed to request headers from peer %s: %v", s.peer.Address, err)
+	}
+}
+
+// locator lists the tips of the DAG extended with the downloaded headers,
+// then a sample of finalized vertices thinning out towards genesis. The
+// peer skips everything in their past. The caller holds s.mu.
+func (s *syncManager) locator() []string {
+	tips := make(map[string]bool)
+	for _, tip := range s.node.dagStore.GetTips() {
+		tips[tip] = true
+	}
+	for _, id := range s.queue {
+		tips[id] = true
+	}
+	for _, id := range s.queue {
+		for _, parentID := range s.headers[id].Parents {
+			delete(tips, parentID)
+		}
+	}
+
+	locator := make([]string, 0, MaxLocatorSize)
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if !seen[id] && len(locator) < MaxLocatorSize {
+			seen[id] = true
+			locator = append(locator, id)
+		}
+	}
+
+	// Newest downloaded headers first, leaving room for finalized points
+	for i := len(s.queue) - 1; i >= 0 && len(locator) < MaxLocatorSize/2; i-- {
+		if tips[s.queue[i]] {
+			add(s.queue[i])
+		}
+	}
+	for tip := range tips {
+		if len(locator) >= MaxLocatorSize/2 {
+			break
+		}
+		add(tip)
+	}
+
+	if finalized, err := s.node.consensusEngine.GetFinalizedVertices(); err == nil {
+		step := 1
+		for i := len(finalized) - 1; i >= 0; i -= step {
+			add(finalized[i].ID)
+			if len(locator) >= 10 {
+				step *= 2
+			}
+		}
+	}
+	add(s.node.params.Genesis().ID)
+
+	return locator
+}
+
+// handleHeaders queues the headers the sync peer sent and requests their
+// bodies
+func (s *syncManager) handleHeaders(peer *Peer, msg *MsgHeaders) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != SyncSyncing || peer != s.peer {
+		return nil // a late answer from a previous sync peer
+	}
+	s.headersSent = time.Time{}
+
+	added := 0
+	for _, header := range msg.Headers {
+		peer.known.add(InvVect{Type: InvVertex, Hash: header.ID})
+		if s.headers[header.ID] != nil || s.node.dagStore.HasVertex(header.ID) {
+			continue
+		}
+
+		if err := s.node.consensusEngine.IsValidHeader(header); err != nil {
+			s.node.invalidHeader(peer, header, err)
+			return err
+		}
+		for _, parentID := range header.Parents {
+			if s.headers[parentID] == nil && !s.node.dagStore.HasVertex(parentID) {
+				return fmt.Errorf("header %s comes before its parent %s", header.ID, parentID)
+			}
+		}
+
+		s.headers[header.ID] = header
+		s.queue = append(s.queue, header.ID)
+		added++
+	}
+	s.headersReceived += added
+
+	if added == 0 && len(s.queue) == 0 {
+		s.finish()
+		return nil
+	}
+
+	// Keep headers coming while bodies download
+	if len(msg.Headers) == MaxHeadersPerMsg {
+		s.sendGetHeaders()
+	}
+	s.requestBodies()
+	return nil
+}
+
+// finish marks the DAG as synced; the caller holds s.mu
+func (s *syncManager) finish() {
+	log.Printf("DAG synced from peer %s: %d vertices added", s.peer.Address, s.processed)
+	s.reset(SyncSynced)
+}
+
+// requestBodies spreads requests for the queued bodies over the ready
+// peers, preferring the least loaded; the caller holds s.mu
+func (s *syncManager) requestBodies() {
+	if s.state != SyncSyncing {
+		return
+	}
+
+	peers := s.node.readyPeers()
+	load := make(map[*Peer]int, len(peers))
+	for _, request := range s.inFlight {
+		load[request.peer]++
+	}
+
+	requests := make(map[*Peer][]InvVect)
+	for _, id := range s.queue {
+		if s.bodies[id] != nil || s.inFlight[id] != nil {
+			continue
+		}
+
+		// The sync peer sent the header, so it is asked when no one else can be
+		best := s.peer
+		for _, peer := range peers {
+			if peer == s.peer || s.notFound[id][peer] {
+				continue
+			}
+			if load[peer] < load[best] {
+				best = peer
+			}
+		}
+		if load[best] >= maxBodiesInFlight {
+			break
+		}
+
+		requests[best] = append(requests[best], InvVect{Type: InvVertex, Hash: id})
+		load[best]++
+		s.inFlight[id] = &bodyRequest{peer: best, sent: s.node.clock.Now()}
+	}
+
+	for peer, items := range requests {
+		if err := s.node.requestData(peer, items); err != nil {
+			log.Printf("Failed to request vertices from peer %s: %v", peer.Address, err)
+		}
+	}
+}
+
+// handleBody takes a vertex the sync is waiting for, reporting false if it
+// is not one
+func (s *syncManager) handleBody(peer *Peer, vertex *dag.Vertex) (bool, error) {
+	s.mu.Lock()
+	header := s.headers[vertex.ID]
+	if header == nil {
+		s.mu.Unlock()
+		return false, nil
+	}
+	if request := s.inFlight[vertex.ID]; request != nil && request.peer == peer {
+		delete(s.inFlight, vertex.ID)
+	}
+	if vertex.Hash != header.Hash || vertex.CalculateHash() != header.Hash {
+		s.mu.Unlock()
+		return true, fmt.Errorf("vertex %s does not match its header", vertex.ID)
+	}
+	if payloadRoot, err := ledger.PayloadRoot(vertex.Data); err != nil || payloadRoot != header.PayloadRoot {
+		s.mu.Unlock()
+		return true, fmt.Errorf("payload of vertex %s does not match its header", vertex.ID)
+	}
+	s.bodies[vertex.ID] = vertex
+	s.requestBodies()
+	s.mu.Unlock()
+
+	s.processQueue()
+	return true, nil
+}
+
+// handleNotFound reassigns a body a peer did not have
+func (s *syncManager) handleNotFound(peer *Peer, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request := s.inFlight[id]
+	if request == nil || request.peer != peer {
+		return
+	}
+	delete(s.inFlight, id)
+
+	if peer == s.peer {
+		s.node.disconnect(peer, fmt.Sprintf("sync peer does not have vertex %s it sent the header of", id))
+		return
+	}
+	if s.notFound[id] == nil {
+		s.notFound[id] = make(map[*Peer]bool)
+	}
+	s.notFound[id][peer] = true
+	s.requestBodies()
+}
+
+// processQueue validates and adds the downloaded vertices in topological
+// order, for as long as the next one has arrived
+func (s *syncManager) processQueue() {
+	s.processMu.Lock()
+	defer s.processMu.Unlock()
+
+	for {
+		s.mu.Lock()
+		if s.state != SyncSyncing || len(s.queue) == 0 || s.bodies[s.queue[0]] == nil {
+			// Once everything is in, ask whether the peer has more
+			if s.state == SyncSyncing && len(s.queue) == 0 && s.headersSent.IsZero() {
+				s.sendGetHeaders()
+			}
+			s.mu.Unlock()
+			return
+		}
+		id := s.queue[0]
+		vertex := s.bodies[id]
+		s.queue = s.queue[1:]
+		delete(s.bodies, id)
+		delete(s.notFound, id)
+		peer := s.peer
+		s.mu.Unlock()
+
+		// The header stays known until the vertex is in the store, so later
+		// headers can still find their parents
+		err := s.node.consensusEngine.IsValidVertex(vertex)
+		if err == nil {
+			if err = s.node.dagStore.AddVertex(vertex); err != nil && s.node.dagStore.HasVertex(id) {
+				err = nil
+			}
+			s.node.acceptReleased()
+		}
+
+		// The body matched its header, so the header itself broke the rules
+		if err != nil {
+			s.node.misbehaving(peer, scoreInvalidVertex, fmt.Sprintf("invalid vertex %s during sync: %v", id, err))
+			return
+		}
+
+		s.mu.Lock()
+		delete(s.headers, id)
+		if s.peer == peer {
+			s.processed++
+		}
+		s.mu.Unlock()
+	}
+}
+
+// checkTimeouts drops a sync peer that stopped answering and reassigns
+// stalled body requests
+func (s *syncManager) checkTimeouts() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != SyncSyncing {
+		return
+	}
+	now := s.node.clock.Now()
+	if !s.headersSent.IsZero() && now.Sub(s.headersSent) > headersTimeout {
+		s.node.disconnect(s.peer, "getheaders timed out")
+		return
+	}
+
+	stalled := false
+	for id, request := range s.inFlight {
+		if now.Sub(request.sent) < requestTimeout {
+			continue
+		}
+		if request.peer == s.peer {
+			s.node.disconnect(s.peer, fmt.Sprintf("vertex %s download stalled", id))
+			return
+		}
+		delete(s.inFlight, id)
+		if s.notFound[id] == nil {
+			s.notFound[id] = make(map[*Peer]bool)
+		}
+		s.notFound[id][request.peer] = true
+		stalled = true
+	}
+	if stalled {
+		s.requestBodies()
+	}
+}
+
+// handleGetHeaders answers with the headers of the vertices outside the
+// past of the locator entries this node knows, in topological order. Work
+// is bounded: the requester's past is first traced back getHeadersWindow
+// blue scores below its highest entry, and further down only when a
+// missing vertex's parent lies below that, and each phase reads at most
+// maxGetHeadersVisits vertices.
+func (n *Node) handleGetHeaders(peer *Peer, msg *MsgGetHeaders) error {
+	if peer.repeatedGetHeaders(msg.Locator, n.clock.Now()) {
+		n.misbehaving(peer, scoreRepeated, "repeated getheaders")
+		return nil
+	}
+
+	entries := make([]string, 0, len(msg.Locator))
+	var top uint64
+	for _, id := range msg.Locator {
+		if !n.dagStore.HasVertex(id) {
+			continue
+		}
+		data, err := n.consensusEngine.GetGhostdagData(id)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, id)
+		if data.BlueScore > top {
+			top = data.BlueScore
+		}
+	}
+	walk := newHeaderWalk(n, top)
+	walk.mark(entries)
+
+	// Walk forward from the edge of the requester's past, lightest first,
+	// and back from this node's tips to reach branches that split off below
+	// the window
+	for id := range walk.known {
+		for _, child := range n.dagStore.GetChildren(id) {
+			walk.push(child)
+		}
+	}
+	for _, tip := range n.dagStore.GetTips() {
+		walk.push(tip)
+	}
+	headers := walk.collect()
+
+	return n.sendMessage(peer, &MsgHeaders{Headers: headers})
+}
+
+// Bounds on the work of answering one getheaders
+const (
+	getHeadersWindow    = MaxHeadersPerMsg     // blue scores traced below the highest locator entry at a time
+	maxGetHeadersVisits = 4 * MaxHeadersPerMsg // vertices read per phase
+)
+
+// getHeadersRepeatInterval is how soon a peer may not ask again with the
+// same locator; an honest syncing peer's locator moves with every answer
+const getHeadersRepeatInterval = 10 * time.Second
+
+// headerWalk finds the vertices a getheaders requester is missing
+type headerWalk struct {
+	node   *Node
+	floor  uint64 // lowest blue score the requester's past is traced to
+	visits int    // vertices read looking for missing ones
+
+	known    map[string]bool // in the requester's past
+	below    []string        // reached while tracing that past, but under the floor
+	sent     map[string]bool // headers already in the answer
+	queued   map[string]bool
+	deferred map[string]bool // waited once for a missing parent
+	queue    headerQueue
+}
+
+// newHeaderWalk starts a walk for a requester whose highest locator entry
+// has blue score top
+func newHeaderWalk(node *Node, top uint64) *headerWalk {
+	floor := uint64(0)
+	if top > getHeadersWindow {
+		floor = top - getHeadersWindow
+	}
+	return &headerWalk{
+		node:     node,
+		floor:    floor,
+		known:    make(map[string]bool),
+		sent:     make(map[string]bool),
+		queued:   make(map[string]bool),
+		deferred: make(map[string]bool),
+	}
+}
+
+// vertex reads a vertex, counting the visit
+func (w *headerWalk) vertex(id string) (*dag.Vertex, error) {
+	w.visits++
+	return w.node.dagStore.GetVertex(id)
+}
+
+// inWindow reports whether a vertex is at or above the floor
+func (w *headerWalk) inWindow(id string) bool {
+	data, err := w.node.consensusEngine.GetGhostdagData(id)
+	return err == nil && data.BlueScore >= w.floor
+}
+
+// mark traces the requester's past from ids down to the floor, keeping
+// the vertices under it to carry on from
+func (w *headerWalk) mark(ids []string) {
+	stack := append([]string(nil), ids...)
+	for len(stack) > 0 && len(w.known) < maxGetHeadersVisits {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if w.known[id] {
+			continue
+		}
+		if !w.inWindow(id) {
+			w.below = append(w.below, id)
+			continue
+		}
+		w.known[id] = true
+
+		vertex, err := w.node.dagStore.GetVertex(id)
+		if err != nil {
+			continue
+		}
+		stack = append(stack, vertex.Parents...)
+	}
+}
+
+// lowerFloor traces the requester's past at least another window down,
+// and to blueScore
+func (w *headerWalk) lowerFloor(blueScore uint64) {
+	w.floor -= min(w.floor, getHeadersWindow)
+	w.floor = min(w.floor, blueScore)
+
+	below := w.below
+	w.below = nil
+	w.mark(below)
+}
+
+// push queues a vertex that may be missing
+func (w *headerWalk) push(id string) {
+	if w.known[id] || w.sent[id] || w.queued[id] {
+		return
+	}
+	data, err := w.node.consensusEngine.GetGhostdagData(id)
+	if err != nil {
+		return
+	}
+	w.queued[id] = true
+	heap.Push(&w.queue, headerCandidate{id: id, blueWork: data.BlueWork})
+}
+
+// collect takes queued vertices in blue work order, which puts parents
+// first, until the answer is full or the budget is spent
+func (w *headerWalk) collect() []*dag.Header {
+	headers := make([]*dag.Header, 0)
+	for w.queue.Len() > 0 && len(headers) < MaxHeadersPerMsg && w.visits < maxGetHeadersVisits {
+		id := heap.Pop(&w.queue).(headerCandidate).id
+		w.queued[id] = false
+		if w.known[id] {
+			continue // found in the requester's past after it was queued
+		}
+
+		vertex, err := w.vertex(id)
+		if err != nil {
+			continue
+		}
+
+		// A parent the requester lacks that was not reached yet goes first.
+		// Under the floor, the requester's past is traced further to tell.
+		missing := false
+		for _, parentID := range vertex.Parents {
+			if w.known[parentID] || w.sent[parentID] {
+				continue
+			}
+			if data, err := w.node.consensusEngine.GetGhostdagData(parentID); err == nil && data.BlueScore < w.floor {
+				w.lowerFloor(data.BlueScore)
+				if w.known[parentID] {
+					continue
+				}
+			}
+			w.push(parentID)
+			missing = true
+		}
+		if missing {
+			if !w.deferred[id] {
+				w.deferred[id] = true
+				w.push(id)
+			}
+			continue
+		}
+
+		headers = append(headers, vertex.Header())
+		w.sent[id] = true
+		for _, child := range w.node.dagStore.GetChildren(id) {
+			w.push(child)
+		}
+	}
+	return headers
+}
+
+// headerCandidate is a queued vertex
+type headerCandidate struct {
+	id       string
+	blueWork *big.Int
+}
+
+// headerQueue is a min-heap of candidates by blue work, then ID
+type headerQueue []headerCandidate
+
+func (q headerQueue) Len() int { return len(q) }
+func (q headerQueue) Less(i, j int) bool {
+	if cmp := q[i].blueWork.Cmp(q[j].blueWork); cmp != 0 {
+		return cmp < 0
+	}
+	return q[i].id < q[j].id
+}
+func (q headerQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *headerQueue) Push(x interface{}) { *q = append(*q, x.(headerCandidate)) }
+func (q *headerQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// repeatedGetHeaders records a getheaders locator received at now,
+// reporting whether the peer sent the same one moments before
+func (p *Peer) repeatedGetHeaders(locator []string, now time.Time) bool {
+	key := strings.Join(locator, ",")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	repeated := key == p.lastLocator && now.Sub(p.lastGetHeaders) < getHeadersRepeatInterval
+	p.lastLocator, p.lastGetHeaders = key, now
+	return repeated
+}
+
+// SyncStatus returns the progress of DAG synchronization
+func (n *Node) SyncStatus() SyncStatus {
+	return n.syncer.status()
+}
+
+// IsSynced reports whether the node has caught up with its peers
+func (n *Node) IsSynced() bool {
+	return !n.syncer.isSyncing()
+}
@@ -0,0 +1,28 @@
+package p2p
+
+import (
+	"net"
+	"time"
+)
+
+// dialTimeout bounds how long connecting to a peer may take
+const dialTimeout = 5 * time.Second
+
+// Transport opens the connections a node talks to its peers over
+type Transport interface {
+	Listen(address string) (net.Listener, error)
+	Dial(address string, timeout time.Duration) (net.Conn, error)
+}
+
+// TCPTransport connects peers over TCP; nodes use it unless told otherwise
+type TCPTransport struct{}
+
+// Listen accepts TCP connections on address
+func (TCPTransport) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", address)
+}
+
+// Dial opens a TCP connection to address
+func (TCPTransport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", address, timeout)
+}
@@ -0,0 +1,155 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// A frame is a 24-byte header followed by the payload:
+//
+//	magic    uint32, big endian: the network the sender is on
+//	command  12 bytes: ASCII, padded with zeros
+//	length   uint32, big endian: payload bytes
+//	checksum 4 bytes: start of SHA-256(SHA-256(payload))
+const (
+	frameHeaderSize = 24
+	commandSize     = 12
+)
+
+// MaxMessagePayload bounds the payload of any frame, including commands
+// this node does not know
+const MaxMessagePayload = 4 << 20
+
+// MessageError is a protocol violation in a message from a peer, as
+// opposed to a failure of the connection itself
+type MessageError struct {
+	Command     string
+	Description string
+	Skippable   bool // the frame was read whole, so the stream is still in step
+}
+
+func (e *MessageError) Error() string {
+	if e.Command == "" {
+		return e.Description
+	}
+	return fmt.Sprintf("%s: %s", e.Command, e.Description)
+}
+
+// WriteMessage frames and writes a message, returning the bytes written
+func WriteMessage(w io.Writer, magic uint32, msg Message) (int, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	if len(payload) > msg.MaxPayloadSize() {
+		return 0, &MessageError{msg.Command(), fmt.Sprintf("payload of %d bytes exceeds the limit of %d", len(payload), msg.MaxPayloadSize()), false}
+	}
+
+	command := msg.Command()
+	if len(command) > commandSize {
+		return 0, fmt.Errorf("command %q is too long", command)
+	}
+
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], magic)
+	copy(frame[4:16], command)
+	binary.BigEndian.PutUint32(frame[16:20], uint32(len(payload)))
+	sum := checksum(payload)
+	copy(frame[20:24], sum[:])
+	frame = append(frame, payload...)
+
+	return w.Write(frame)
+}
+
+// ReadMessage reads one frame and decodes its message, returning the
+// bytes read. Frames with an unknown command are consumed and returned as
+// a nil message so newer peers can talk to older nodes.
+func ReadMessage(r io.Reader, magic uint32) (Message, int, error) {
+	var header [frameHeaderSize]byte
+	if n, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, n, err
+	}
+	read := frameHeaderSize
+
+	if got := binary.BigEndian.Uint32(header[0:4]); got != magic {
+		return nil, read, &MessageError{"", fmt.Sprintf("network magic %08x does not match %08x", got, magic), false}
+	}
+
+	command, err := parseCommand(header[4:16])
+	if err != nil {
+		return nil, read, err
+	}
+
+	length := binary.BigEndian.Uint32(header[16:20])
+	msg := newMessage(command)
+
+	limit := MaxMessagePayload
+	if msg != nil {
+		limit = msg.MaxPayloadSize()
+	}
+	if int64(length) > int64(limit) {
+		return nil, read, &MessageError{command, fmt.Sprintf("payload of %d bytes exceeds the limit of %d", length, limit), false}
+	}
+
+	payload := make([]byte, length)
+	n, err := io.ReadFull(r, payload)
+	read += n
+	if err != nil {
+		return nil, read, err
+	}
+
+	sum := checksum(payload)
+	if !bytes.Equal(sum[:], header[20:24]) {
+		return nil, read, &MessageError{command, "checksum mismatch", true}
+	}
+
+	if msg == nil {
+		return nil, read, nil
+	}
+
+	if err := json.Unmarshal(payload, msg); err != nil {
+		return nil, read, &MessageError{command, fmt.Sprintf("malformed payload: %v", err), true}
+	}
+	if v, ok := msg.(validator); ok {
+		if err := v.validate(); err != nil {
+			return nil, read, &MessageError{command, err.Error(), true}
+		}
+	}
+
+	return msg, read, nil
+}
+
+// parseCommand reads a zero-padded ASCII command
+func parseCommand(field []byte) (string, error) {
+	end := bytes.IndexByte(field, 0)
+	if end < 0 {
+		end = len(field)
+	}
+	for _, b := range field[end:] {
+		if b != 0 {
+			return "", &MessageError{"", "command is not zero padded", false}
+		}
+	}
+
+	command := field[:end]
+	for _, b := range command {
+		if b < 0x20 || b > 0x7e {
+			return "", &MessageError{"", "command is not printable ASCII", false}
+		}
+	}
+	return string(command), nil
+}
+
+// checksum returns the first four bytes of the double SHA-256 of payload
+func checksum(payload []byte) [4]byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+
+	var sum [4]byte
+	copy(sum[:], second[:4])
+	return sum
+}
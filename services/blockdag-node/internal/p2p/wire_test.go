@@ -0,0 +1,201 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/dag"
+)
+
+const testMagic = 0xd9b4bef9
+
+// rawFrame builds a frame by hand so tests can break any field of it
+func rawFrame(magic uint32, command string, payload []byte) []byte {
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], magic)
+	copy(frame[4:16], command)
+	binary.BigEndian.PutUint32(frame[16:20], uint32(len(payload)))
+	sum := checksum(payload)
+	copy(frame[20:24], sum[:])
+	return append(frame, payload...)
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []Message{
+		&MsgVersion{ProtocolVersion: 1, Network: testMagic, Genesis: "genesis", NodeID: "node", Tips: []string{"a", "b"}, UserAgent: "test", Timestamp: 1700000000},
+		&MsgVerAck{},
+		&MsgPing{Nonce: 42},
+		&MsgPong{Nonce: 42},
+		&MsgInv{Items: []InvVect{{InvVertex, "v1"}, {InvTx, "t1"}}},
+		&MsgGetData{Items: []InvVect{{InvVertex, "v1"}}},
+		&MsgVertex{Vertex: &dag.Vertex{ID: "v1", Parents: []string{"genesis"}, Timestamp: time.Unix(1700000000, 0).UTC(), Nonce: 7}},
+		&MsgTx{Data: []byte("transaction")},
+		&MsgAddr{Addresses: []NetAddress{{Address: "10.0.0.1:4001", Services: 1, Timestamp: 1700000000}}},
+		&MsgGetAddr{},
+		&MsgReject{Rejected: CmdTx, Reason: "double spend", Hash: "t1"},
+		&MsgGetHeaders{Locator: []string{"tip", "genesis"}},
+		&MsgHeaders{Headers: []*dag.Header{{ID: "v1", Parents: []string{"genesis"}}}},
+	}
+	for _, msg := range tests {
+		t.Run(msg.Command(), func(t *testing.T) {
+			var buf bytes.Buffer
+			written, err := WriteMessage(&buf, testMagic, msg)
+			if err != nil {
+				t.Fatalf("WriteMessage: %v", err)
+			}
+			if written != buf.Len() {
+				t.Errorf("WriteMessage reported %d bytes, wrote %d", written, buf.Len())
+			}
+
+			decoded, read, err := ReadMessage(&buf, testMagic)
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			if read != written {
+				t.Errorf("read %d bytes, wrote %d", read, written)
+			}
+			if !reflect.DeepEqual(decoded, msg) {
+				t.Errorf("decoded %+v, want %+v", decoded, msg)
+			}
+		})
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	ping := []byte(`{"nonce":1}`)
+	badChecksum := rawFrame(testMagic, CmdPing, ping)
+	badChecksum[20] ^= 0xff
+	oversize := rawFrame(testMagic, CmdPing, nil)
+	binary.BigEndian.PutUint32(oversize[16:20], maxPingSize+1)
+	unknownOversize := rawFrame(testMagic, "future", nil)
+	binary.BigEndian.PutUint32(unknownOversize[16:20], MaxMessagePayload+1)
+	badPadding := rawFrame(testMagic, CmdPing, ping)
+	badPadding[15] = 'x'
+
+	tests := []struct {
+		name      string
+		frame     []byte
+		skippable bool
+		contains  string
+	}{
+		{"wrong magic", rawFrame(0x0b110907, CmdPing, ping), false, "network magic"},
+		{"checksum mismatch", badChecksum, true, "checksum mismatch"},
+		{"payload over the command limit", oversize, false, "exceeds the limit"},
+		{"unknown command over the frame limit", unknownOversize, false, "exceeds the limit"},
+		{"command not zero padded", badPadding, false, "zero padded"},
+		{"command not printable", rawFrame(testMagic, "pi\x01g", ping), false, "printable"},
+		{"malformed payload", rawFrame(testMagic, CmdPing, []byte(`{"nonce":`)), true, "malformed payload"},
+		{"payload breaks a message limit", rawFrame(testMagic, CmdInv, []byte(`{"items":[{"type":"block","hash":"x"}]}`)), true, "unknown inventory type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, _, err := ReadMessage(bytes.NewReader(tt.frame), testMagic)
+			if msg != nil {
+				t.Errorf("decoded %+v from a bad frame", msg)
+			}
+			var msgErr *MessageError
+			if !errors.As(err, &msgErr) {
+				t.Fatalf("got error %v, want a *MessageError", err)
+			}
+			if msgErr.Skippable != tt.skippable {
+				t.Errorf("skippable = %v, want %v", msgErr.Skippable, tt.skippable)
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("error %q does not mention %q", err, tt.contains)
+			}
+		})
+	}
+}
+
+func TestReadMessageSkipsUnknownCommand(t *testing.T) {
+	unknown := rawFrame(testMagic, "future", []byte(`{"anything":true}`))
+	var buf bytes.Buffer
+	buf.Write(unknown)
+	if _, err := WriteMessage(&buf, testMagic, &MsgPing{Nonce: 9}); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	msg, read, err := ReadMessage(&buf, testMagic)
+	if msg != nil || err != nil {
+		t.Fatalf("unknown command returned %v, %v; want nil, nil", msg, err)
+	}
+	if read != len(unknown) {
+		t.Errorf("read %d bytes, want the whole %d byte frame", read, len(unknown))
+	}
+
+	// The stream is still in step
+	msg, _, err = ReadMessage(&buf, testMagic)
+	if err != nil {
+		t.Fatalf("ReadMessage after the unknown frame: %v", err)
+	}
+	if ping, ok := msg.(*MsgPing); !ok || ping.Nonce != 9 {
+		t.Errorf("got %+v, want the ping after the unknown frame", msg)
+	}
+}
+
+func TestReadMessageTruncated(t *testing.T) {
+	frame := rawFrame(testMagic, CmdPing, []byte(`{"nonce":1}`))
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, io.EOF},
+		{"partial header", frame[:10], io.ErrUnexpectedEOF},
+		{"partial payload", frame[:len(frame)-2], io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ReadMessage(bytes.NewReader(tt.data), testMagic)
+			if err != tt.want {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteMessageOversize(t *testing.T) {
+	var buf bytes.Buffer
+	msg := &MsgReject{Rejected: CmdTx, Reason: strings.Repeat("x", maxRejectSize)}
+	_, err := WriteMessage(&buf, testMagic, msg)
+
+	var msgErr *MessageError
+	if !errors.As(err, &msgErr) {
+		t.Fatalf("got error %v, want a *MessageError", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes of an oversize message", buf.Len())
+	}
+}
+
+func TestWriteMessageFullVertex(t *testing.T) {
+	// A vertex with the largest payload consensus accepts and many parents
+	parents := make([]string, 50)
+	for i := range parents {
+		parents[i] = strings.Repeat(fmt.Sprintf("%x", i%16), 64)
+	}
+	vertex := &dag.Vertex{
+		ID:          strings.Repeat("a", 64),
+		Hash:        strings.Repeat("b", 64),
+		Data:        bytes.Repeat([]byte{0xff}, chaincfg.MaxPayloadSize),
+		PayloadRoot: strings.Repeat("c", 64),
+		Parents:     parents,
+		Coinbase:    "0x" + strings.Repeat("d", 40),
+		Timestamp:   time.Now(),
+		Nonce:       math.MaxUint64,
+		Weight:      math.MaxUint64,
+	}
+
+	if _, err := WriteMessage(io.Discard, testMagic, &MsgVertex{Vertex: vertex}); err != nil {
+		t.Errorf("a vertex with a full payload does not fit a message: %v", err)
+	}
+}
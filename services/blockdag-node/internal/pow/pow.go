@@ -0,0 +1,51 @@
+package pow
+
+import (
+	"math/big"
+	"strconv"
+
+	"hackodisha/blockdag-node/internal/dag"
+)
+
+// Algorithm is a proof-of-work function over vertex headers
+type Algorithm interface {
+	// Name identifies the algorithm in RPC results
+	Name() string
+
+	// Hash computes the proof-of-work hash of a header
+	Hash(header *dag.Header) []byte
+
+	// CheckTarget reports whether a hash, read as a big-endian number, is
+	// at or below target
+	CheckTarget(hash []byte, target *big.Int) bool
+
+	// Work returns the expected number of hashes needed to meet target
+	Work(target *big.Int) *big.Int
+}
+
+// TargetFromBits returns the target a hash meets when it has at least
+// bits leading zero bits
+func TargetFromBits(bits uint) *big.Int {
+	target := new(big.Int).Lsh(big.NewInt(1), 256-bits)
+	return target.Sub(target, big.NewInt(1))
+}
+
+// checkTarget compares a hash against a target
+func checkTarget(hash []byte, target *big.Int) bool {
+	return new(big.Int).SetBytes(hash).Cmp(target) <= 0
+}
+
+// work is 2^256 / (target + 1), the expected hashes to meet target
+func work(target *big.Int) *big.Int {
+	if target.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
+
+// input is the byte string the algorithms hash: the header pre-image
+// followed by the decimal nonce
+func input(header *dag.Header) []byte {
+	return strconv.AppendUint([]byte(header.PreImage()), header.Nonce, 10)
+}
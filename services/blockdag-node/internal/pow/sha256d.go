@@ -0,0 +1,30 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"math/big"
+
+	"hackodisha/blockdag-node/internal/dag"
+)
+
+// SHA256DName is the name of the double SHA-256 algorithm
+const SHA256DName = "sha256d"
+
+// SHA256D hashes the header input twice with SHA-256
+type SHA256D struct{}
+
+// Name implements Algorithm
+func (SHA256D) Name() string { return SHA256DName }
+
+// Hash implements Algorithm
+func (SHA256D) Hash(header *dag.Header) []byte {
+	first := sha256.Sum256(input(header))
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// CheckTarget implements Algorithm
+func (SHA256D) CheckTarget(hash []byte, target *big.Int) bool { return checkTarget(hash, target) }
+
+// Work implements Algorithm
+func (SHA256D) Work(target *big.Int) *big.Int { return work(target) }
@@ -0,0 +1,138 @@
+package proof
+
+import (
+	"fmt"
+
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+)
+
+// TxProof proves that a transaction is included in a vertex and that the
+// vertex is in the past of an anchor vertex
+type TxProof struct {
+	TxID      string              `json:"txid"`
+	Branch    []ledger.MerkleStep `json:"branch"`
+	Vertex    *dag.Header         `json:"vertex"`
+	Chain     []*dag.Header       `json:"chain"`     // anchor first, each followed by its selected parent, down to a child of the vertex
+	Finalized bool                `json:"finalized"` // the anchor is a finalized vertex
+}
+
+// Anchor returns the header the proof is rooted at
+func (p *TxProof) Anchor() *dag.Header {
+	if len(p.Chain) == 0 {
+		return p.Vertex
+	}
+	return p.Chain[0]
+}
+
+// Build creates a proof that txID is included in the given vertex. The
+// chain is anchored at the latest finalized vertex when the vertex is in
+// its past, and at the heaviest tip otherwise.
+func Build(dagStore *dag.Store, engine *consensus.Engine, vertexID, txID string) (*TxProof, error) {
+	vertex, err := dagStore.GetVertex(vertexID)
+	if err != nil {
+		return nil, fmt.Errorf("vertex %s not found", vertexID)
+	}
+
+	entries, err := ledger.DecodePayload(vertex.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	for i, entry := range entries {
+		if ledger.EntryID(entry) == txID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("transaction %s is not in vertex %s", txID, vertexID)
+	}
+
+	branch, err := ledger.MerkleBranch(vertex.Data, index)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &TxProof{
+		TxID:   txID,
+		Branch: branch,
+		Vertex: vertex.Header(),
+	}
+
+	// Prefer a finalized anchor
+	finalized, err := engine.GetLatestFinalized()
+	if err != nil {
+		return nil, err
+	}
+	if finalized != nil {
+		if chain, err := engine.PathToAncestor(finalized.ID, vertexID); err == nil {
+			proof.Chain = chain
+			proof.Finalized = true
+			return proof, nil
+		}
+	}
+
+	// Fall back to the tip of the heaviest path
+	path, err := engine.GetHeaviestPath()
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("DAG has no tips")
+	}
+	chain, err := engine.PathToAncestor(path[len(path)-1].ID, vertexID)
+	if err != nil {
+		return nil, err
+	}
+	proof.Chain = chain
+
+	return proof, nil
+}
+
+// Verify checks the proof against a trusted header. The trusted header must
+// be the proof's anchor; every header's hash is recomputed and each header
+// in the chain must reference the next one as a parent.
+func Verify(p *TxProof, trusted *dag.Header) error {
+	if p == nil || p.Vertex == nil {
+		return fmt.Errorf("proof is missing the vertex header")
+	}
+	if trusted == nil {
+		return fmt.Errorf("missing trusted header")
+	}
+	if trusted.CalculateHash() != trusted.Hash {
+		return fmt.Errorf("trusted header %s has an invalid hash", trusted.ID)
+	}
+
+	// The transaction must hash up to the vertex's payload root
+	if err := ledger.VerifyMerkleBranch(p.TxID, p.Branch, p.Vertex.PayloadRoot); err != nil {
+		return err
+	}
+	if p.Vertex.CalculateHash() != p.Vertex.Hash {
+		return fmt.Errorf("vertex header %s has an invalid hash", p.Vertex.ID)
+	}
+
+	// The chain must link the anchor down to the vertex
+	anchor := p.Anchor()
+	if anchor.ID != trusted.ID || anchor.Hash != trusted.Hash {
+		return fmt.Errorf("proof is anchored at %s, not the trusted header %s", anchor.ID, trusted.ID)
+	}
+
+	for i, header := range p.Chain {
+		if header.CalculateHash() != header.Hash {
+			return fmt.Errorf("chain header %s has an invalid hash", header.ID)
+		}
+
+		next := p.Vertex
+		if i+1 < len(p.Chain) {
+			next = p.Chain[i+1]
+		}
+		if !header.HasParent(next.ID) {
+			return fmt.Errorf("chain header %s does not reference %s", header.ID, next.ID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package proof
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/storage"
+)
+
+// testDAG is a chain c1..c13 on top of genesis, a side vertex s that c3
+// merges, and a tip u that nothing merges
+type testDAG struct {
+	store    *dag.Store
+	engine   *consensus.Engine
+	vertices map[string]*dag.Vertex
+	txs      map[string]string // a transaction ID in each vertex
+}
+
+func newTestDAG(t *testing.T) *testDAG {
+	t.Helper()
+	params := &chaincfg.DevNetParams
+	genesis := params.Genesis()
+	store := dag.NewStore(storage.NewMemoryDB())
+	if err := store.AddVertex(genesis); err != nil {
+		t.Fatalf("adding genesis: %v", err)
+	}
+
+	d := &testDAG{
+		store:    store,
+		engine:   consensus.NewEngine(store, params),
+		vertices: map[string]*dag.Vertex{genesis.ID: genesis},
+		txs:      make(map[string]string),
+	}
+	add := func(id string, parents ...string) {
+		entries := [][]byte{[]byte(id + " first"), []byte(id + " second"), []byte(id + " third")}
+		data := ledger.EncodePayload(entries)
+		root, err := ledger.PayloadRoot(data)
+		if err != nil {
+			t.Fatalf("PayloadRoot: %v", err)
+		}
+		vertex := &dag.Vertex{
+			ID:          id,
+			Data:        data,
+			PayloadRoot: root,
+			Parents:     parents,
+			Timestamp:   params.GenesisTime.Add(time.Duration(len(d.vertices)) * time.Second),
+			Weight:      params.VertexWeight(),
+		}
+		vertex.Hash = vertex.CalculateHash()
+		if err := store.AddVertex(vertex); err != nil {
+			t.Fatalf("adding %s: %v", id, err)
+		}
+		d.vertices[id] = vertex
+		d.txs[id] = ledger.EntryID(entries[1])
+	}
+
+	add("c1", genesis.ID)
+	add("s", genesis.ID)
+	add("c2", "c1")
+	add("c3", "c2", "s")
+	add("u", "c1")
+	for i := 4; i <= 13; i++ {
+		add(fmt.Sprintf("c%d", i), fmt.Sprintf("c%d", i-1))
+	}
+	return d
+}
+
+// header returns the stored header of a vertex
+func (d *testDAG) header(id string) *dag.Header {
+	return d.vertices[id].Header()
+}
+
+func TestBuildAndVerify(t *testing.T) {
+	d := newTestDAG(t)
+	finalized, err := d.engine.GetLatestFinalized()
+	if err != nil || finalized == nil {
+		t.Fatalf("GetLatestFinalized: %v, %v", finalized, err)
+	}
+	if finalized.ID != "c3" {
+		t.Fatalf("latest finalized is %s, want c3", finalized.ID)
+	}
+
+	tests := []struct {
+		name      string
+		vertex    string
+		anchor    string
+		chain     []string
+		finalized bool
+	}{
+		{"chain vertex under the finalized anchor", "c1", "c3", []string{"c3", "c2"}, true},
+		{"merged vertex under the finalized anchor", "s", "c3", []string{"c3"}, true},
+		{"finalized anchor itself", "c3", "c3", nil, true},
+		{"vertex above the finalized anchor", "c11", "c13", []string{"c13", "c12"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := Build(d.store, d.engine, tt.vertex, d.txs[tt.vertex])
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			if proof.Finalized != tt.finalized {
+				t.Errorf("finalized = %v, want %v", proof.Finalized, tt.finalized)
+			}
+			ids := make([]string, len(proof.Chain))
+			for i, header := range proof.Chain {
+				ids[i] = header.ID
+			}
+			if len(ids) != len(tt.chain) {
+				t.Fatalf("chain %v, want %v", ids, tt.chain)
+			}
+			for i := range ids {
+				if ids[i] != tt.chain[i] {
+					t.Fatalf("chain %v, want %v", ids, tt.chain)
+				}
+			}
+
+			if err := Verify(proof, d.header(tt.anchor)); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+			if err := Verify(proof, d.header("c2")); err == nil {
+				t.Error("Verify accepted a header the proof is not anchored at")
+			}
+		})
+	}
+}
+
+func TestBuildRejectsUnmergedVertex(t *testing.T) {
+	d := newTestDAG(t)
+	if _, err := Build(d.store, d.engine, "u", d.txs["u"]); err == nil {
+		t.Error("Build proved a vertex no chain vertex merges")
+	}
+	if _, err := Build(d.store, d.engine, "c1", d.txs["c2"]); err == nil {
+		t.Error("Build proved a transaction the vertex does not hold")
+	}
+}
+
+func TestPathToAncestorFollowsSelectedParents(t *testing.T) {
+	d := newTestDAG(t)
+	path, err := d.engine.PathToAncestor("c13", "c1")
+	if err != nil {
+		t.Fatalf("PathToAncestor: %v", err)
+	}
+	for i, header := range path[:len(path)-1] {
+		data, err := d.engine.GetGhostdagData(header.ID)
+		if err != nil {
+			t.Fatalf("GetGhostdagData: %v", err)
+		}
+		if data.SelectedParent != path[i+1].ID {
+			t.Errorf("%s is followed by %s, not its selected parent %s", header.ID, path[i+1].ID, data.SelectedParent)
+		}
+	}
+
+	// No chain vertex has u as a parent
+	if _, err := d.engine.PathToAncestor("c13", "u"); err == nil {
+		t.Error("PathToAncestor reached a vertex off the selected chain")
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	d := newTestDAG(t)
+	trusted := d.header("c3")
+
+	tests := []struct {
+		name   string
+		tamper func(p *TxProof)
+	}{
+		{"other transaction", func(p *TxProof) { p.TxID = d.txs["c2"] }},
+		{"tampered branch", func(p *TxProof) { p.Branch[0].Left = !p.Branch[0].Left }},
+		{"truncated branch", func(p *TxProof) { p.Branch = p.Branch[:len(p.Branch)-1] }},
+		{"vertex payload root", func(p *TxProof) { p.Vertex.PayloadRoot = d.vertices["c2"].PayloadRoot }},
+		{"vertex hash", func(p *TxProof) { p.Vertex.Nonce++ }},
+		{"chain header hash", func(p *TxProof) { p.Chain[1].Nonce++ }},
+		{"missing chain link", func(p *TxProof) { p.Chain = p.Chain[:1] }},
+		{"chain reordered", func(p *TxProof) { p.Chain[0], p.Chain[1] = p.Chain[1], p.Chain[0] }},
+		{"missing vertex", func(p *TxProof) { p.Vertex = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := Build(d.store, d.engine, "c1", d.txs["c1"])
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			tt.tamper(proof)
+			if err := Verify(proof, trusted); err == nil {
+				t.Error("Verify accepted a tampered proof")
+			}
+		})
+	}
+
+	proof, err := Build(d.store, d.engine, "c1", d.txs["c1"])
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	forged := *trusted
+	forged.Nonce++
+	if err := Verify(proof, &forged); err == nil {
+		t.Error("Verify accepted a trusted header with an invalid hash")
+	}
+	if err := Verify(proof, nil); err == nil {
+		t.Error("Verify accepted a missing trusted header")
+	}
+}
@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// Request limits, for HTTP bodies and WebSocket messages alike
+const (
+	maxRequestSize = 1 << 20
+	maxBatchSize   = 100
+)
+
+// rpcError is an error reported with its own JSON-RPC code; other errors
+// from methods are reported as internal errors
+type rpcError struct {
+	code    int
+	message string
+	data    interface{}
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s: %v", e.message, e.data)
+}
+
+// invalidParams reports parameters a method cannot use
+func invalidParams(format string, args ...interface{}) error {
+	return &rpcError{code: codeInvalidParams, message: "Invalid params", data: fmt.Sprintf(format, args...)}
+}
+
+// callFunc runs a method with its parameters as sent
+type callFunc func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)
+
+// handleMessage processes a request or a batch of them, returning the
+// encoded response, or nil when there is nothing to answer because only
+// notifications were sent
+func handleMessage(ctx context.Context, message []byte, call callFunc) []byte {
+	trimmed := bytes.TrimLeft(message, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		if !json.Valid(message) {
+			return encodeResponse(jsonRPCError(nil, codeParseError, "Parse error", nil))
+		}
+		if response := handleRequest(ctx, message, call); response != nil {
+			return encodeResponse(response)
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(message, &batch); err != nil {
+		return encodeResponse(jsonRPCError(nil, codeParseError, "Parse error", nil))
+	}
+	if len(batch) == 0 {
+		return encodeResponse(jsonRPCError(nil, codeInvalidRequest, "Invalid Request", "empty batch"))
+	}
+	if len(batch) > maxBatchSize {
+		return encodeResponse(jsonRPCError(nil, codeInvalidRequest, "Invalid Request",
+			fmt.Sprintf("batch of %d requests exceeds the limit of %d", len(batch), maxBatchSize)))
+	}
+
+	responses := make([]map[string]interface{}, 0, len(batch))
+	for _, request := range batch {
+		if response := handleRequest(ctx, request, call); response != nil {
+			responses = append(responses, response)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return encodeResponse(responses)
+}
+
+// handleRequest runs a single request, returning nil for a notification
+func handleRequest(ctx context.Context, raw json.RawMessage, call callFunc) map[string]interface{} {
+	var request struct {
+		JSONRPC string          `json:"jsonrpc"`
+		Method  string          `json:"method"`
+		Params  json.RawMessage `json:"params"`
+		ID      json.RawMessage `json:"id"` // nil when absent: a notification
+	}
+	if err := json.Unmarshal(raw, &request); err != nil {
+		return jsonRPCError(nil, codeInvalidRequest, "Invalid Request", "a request must be an object")
+	}
+
+	// The id is echoed as sent, so it only needs its type checked
+	var id interface{}
+	if request.ID != nil {
+		switch request.ID[0] {
+		case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			id = request.ID
+		default:
+			return jsonRPCError(nil, codeInvalidRequest, "Invalid Request", "id must be a string, number or null")
+		}
+	}
+	if request.JSONRPC != "2.0" {
+		return jsonRPCError(id, codeInvalidRequest, "Invalid Request", `jsonrpc must be "2.0"`)
+	}
+	if request.Method == "" {
+		return jsonRPCError(id, codeInvalidRequest, "Invalid Request", "missing method")
+	}
+
+	result, err := call(ctx, request.Method, request.Params)
+	if request.ID == nil {
+		return nil
+	}
+	if err != nil {
+		if rpcErr, ok := err.(*rpcError); ok {
+			return jsonRPCError(id, rpcErr.code, rpcErr.message, rpcErr.data)
+		}
+		return jsonRPCError(id, codeInternalError, "Internal error", err.Error())
+	}
+	return jsonRPCSuccess(id, result)
+}
+
+// encodeResponse encodes a response or batch of responses
+func encodeResponse(response interface{}) []byte {
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		encoded, _ = json.Marshal(jsonRPCError(nil, codeInternalError, "Internal error", err.Error()))
+	}
+	return encoded
+}
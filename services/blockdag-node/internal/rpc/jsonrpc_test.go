@@ -0,0 +1,219 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testResponse is a decoded JSON-RPC response
+type testResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	ID json.RawMessage `json:"id"`
+}
+
+type echoParams struct {
+	Value int `json:"value" rpc:"required"`
+}
+
+// newTestServer returns a server with only an echo method and a failing
+// one, and a count of the calls made
+func newTestServer() (*Server, *atomic.Int64) {
+	calls := new(atomic.Int64)
+	methods := newRegistry()
+	register(methods, "echo", "Returns value.", func(ctx context.Context, params *echoParams) (int, error) {
+		calls.Add(1)
+		return params.Value, nil
+	})
+	register(methods, "fail", "Always fails.", func(ctx context.Context, params *noParams) (int, error) {
+		calls.Add(1)
+		return 0, fmt.Errorf("failed")
+	})
+	return &Server{methods: methods}, calls
+}
+
+func TestHandleMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		id      string // echoed id; empty for none
+		result  string
+		code    int
+		calls   int64
+	}{
+		{"number id", `{"jsonrpc":"2.0","method":"echo","params":{"value":7},"id":1}`, `1`, `7`, 0, 1},
+		{"string id", `{"jsonrpc":"2.0","method":"echo","params":[7],"id":"a"}`, `"a"`, `7`, 0, 1},
+		{"null id", `{"jsonrpc":"2.0","method":"echo","params":[7],"id":null}`, `null`, `7`, 0, 1},
+		{"parse error", `{"jsonrpc":"2.0",`, `null`, ``, codeParseError, 0},
+		{"not an object", `"echo"`, `null`, ``, codeInvalidRequest, 0},
+		{"wrong jsonrpc version", `{"jsonrpc":"1.0","method":"echo","id":1}`, `1`, ``, codeInvalidRequest, 0},
+		{"missing jsonrpc", `{"method":"echo","id":1}`, `1`, ``, codeInvalidRequest, 0},
+		{"jsonrpc not a string", `{"jsonrpc":2,"method":"echo","id":1}`, `null`, ``, codeInvalidRequest, 0},
+		{"object id", `{"jsonrpc":"2.0","method":"echo","id":{}}`, `null`, ``, codeInvalidRequest, 0},
+		{"array id", `{"jsonrpc":"2.0","method":"echo","id":[1]}`, `null`, ``, codeInvalidRequest, 0},
+		{"boolean id", `{"jsonrpc":"2.0","method":"echo","id":true}`, `null`, ``, codeInvalidRequest, 0},
+		{"missing method", `{"jsonrpc":"2.0","id":1}`, `1`, ``, codeInvalidRequest, 0},
+		{"unknown method", `{"jsonrpc":"2.0","method":"nope","id":1}`, `1`, ``, codeMethodNotFound, 0},
+		{"invalid params", `{"jsonrpc":"2.0","method":"echo","params":{},"id":1}`, `1`, ``, codeInvalidParams, 0},
+		{"method error", `{"jsonrpc":"2.0","method":"fail","id":1}`, `1`, ``, codeInternalError, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, calls := newTestServer()
+			encoded := handleMessage(context.Background(), []byte(tt.message), s.call)
+
+			var response testResponse
+			if err := json.Unmarshal(encoded, &response); err != nil {
+				t.Fatalf("decoding %s: %v", encoded, err)
+			}
+			if response.JSONRPC != "2.0" {
+				t.Errorf("jsonrpc = %q", response.JSONRPC)
+			}
+			if string(response.ID) != tt.id {
+				t.Errorf("id = %s, want %s", response.ID, tt.id)
+			}
+			if tt.code == 0 {
+				if response.Error != nil || string(response.Result) != tt.result {
+					t.Errorf("got %s, want result %s", encoded, tt.result)
+				}
+			} else if response.Error == nil || response.Error.Code != tt.code {
+				t.Errorf("got %s, want error %d", encoded, tt.code)
+			}
+			if calls.Load() != tt.calls {
+				t.Errorf("method ran %d times, want %d", calls.Load(), tt.calls)
+			}
+		})
+	}
+}
+
+func TestHandleMessageNotification(t *testing.T) {
+	s, calls := newTestServer()
+	for _, message := range []string{
+		`{"jsonrpc":"2.0","method":"echo","params":[1]}`,
+		`{"jsonrpc":"2.0","method":"fail"}`,
+		`{"jsonrpc":"2.0","method":"nope"}`,
+	} {
+		if response := handleMessage(context.Background(), []byte(message), s.call); response != nil {
+			t.Errorf("notification %s answered with %s", message, response)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("methods ran %d times, want 2", calls.Load())
+	}
+}
+
+// batchOf joins n echo requests into a batch, with ids 0 to n-1
+func batchOf(n int) string {
+	requests := make([]string, n)
+	for i := range requests {
+		requests[i] = fmt.Sprintf(`{"jsonrpc":"2.0","method":"echo","params":[%d],"id":%d}`, i, i)
+	}
+	return "[" + strings.Join(requests, ",") + "]"
+}
+
+func TestHandleMessageBatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   string
+		responses int // -1 for a single error response
+		code      int
+		calls     int64
+	}{
+		{"mixed requests", `[
+			{"jsonrpc":"2.0","method":"echo","params":[1],"id":1},
+			{"jsonrpc":"2.0","method":"echo","params":[2]},
+			{"jsonrpc":"2.0","method":"nope","id":3},
+			5
+		]`, 3, 0, 2},
+		{"at the limit", batchOf(maxBatchSize), maxBatchSize, 0, maxBatchSize},
+		{"over the limit", batchOf(maxBatchSize + 1), -1, codeInvalidRequest, 0},
+		{"empty", `[]`, -1, codeInvalidRequest, 0},
+		{"malformed", `[{"jsonrpc":"2.0"`, -1, codeParseError, 0},
+		{"only notifications", `[{"jsonrpc":"2.0","method":"echo","params":[1]},{"jsonrpc":"2.0","method":"fail"}]`, 0, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, calls := newTestServer()
+			encoded := handleMessage(context.Background(), []byte(tt.message), s.call)
+			if calls.Load() != tt.calls {
+				t.Errorf("methods ran %d times, want %d", calls.Load(), tt.calls)
+			}
+
+			switch {
+			case tt.responses == 0:
+				if encoded != nil {
+					t.Errorf("answered %s", encoded)
+				}
+			case tt.responses < 0:
+				var response testResponse
+				if err := json.Unmarshal(encoded, &response); err != nil {
+					t.Fatalf("decoding %s: %v", encoded, err)
+				}
+				if response.Error == nil || response.Error.Code != tt.code {
+					t.Errorf("got %s, want error %d", encoded, tt.code)
+				}
+			default:
+				var responses []testResponse
+				if err := json.Unmarshal(encoded, &responses); err != nil {
+					t.Fatalf("decoding %s: %v", encoded, err)
+				}
+				if len(responses) != tt.responses {
+					t.Errorf("got %d responses, want %d", len(responses), tt.responses)
+				}
+				for _, response := range responses {
+					if response.Error == nil && string(response.Result) != string(response.ID) {
+						t.Errorf("response %s carries result %s", response.ID, response.Result)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHandleJSONRPC(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"request", "POST", `{"jsonrpc":"2.0","method":"echo","params":[1],"id":1}`, http.StatusOK},
+		{"notification", "POST", `{"jsonrpc":"2.0","method":"echo","params":[1]}`, http.StatusNoContent},
+		{"batch of notifications", "POST", `[{"jsonrpc":"2.0","method":"echo","params":[1]}]`, http.StatusNoContent},
+		{"body over the limit", "POST", `{"jsonrpc":"2.0","method":"echo","params":["` + strings.Repeat("x", maxRequestSize) + `"],"id":1}`, http.StatusRequestEntityTooLarge},
+		{"not a POST", "GET", ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer()
+			recorder := httptest.NewRecorder()
+			s.handleJSONRPC(recorder, httptest.NewRequest(tt.method, "/rpc", strings.NewReader(tt.body)))
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status %d, want %d", recorder.Code, tt.status)
+			}
+			if recorder.Code == http.StatusNoContent && recorder.Body.Len() != 0 {
+				t.Errorf("204 response has a body: %s", recorder.Body)
+			}
+			if recorder.Code == http.StatusOK || recorder.Code == http.StatusRequestEntityTooLarge {
+				if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+					t.Errorf("Content-Type = %q", contentType)
+				}
+				var response testResponse
+				if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+					t.Errorf("decoding %s: %v", recorder.Body, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/internal/mempool"
+	"hackodisha/blockdag-node/internal/miner"
+	"hackodisha/blockdag-node/internal/proof"
+)
+
+// Method parameters
+
+type addressParams struct {
+	Address string `json:"address" rpc:"required" desc:"account or peer address"`
+}
+
+type banParams struct {
+	Address  string  `json:"address" rpc:"required" desc:"peer address whose host is banned"`
+	Duration float64 `json:"duration" desc:"seconds; 0 bans for a day"`
+	Reason   string  `json:"reason"`
+}
+
+func (p *banParams) validate() error {
+	if p.Duration < 0 {
+		return fmt.Errorf("duration must not be negative")
+	}
+	return nil
+}
+
+type vertexParams struct {
+	ID string `json:"id" rpc:"required"`
+}
+
+type transactionParams struct {
+	Data string `json:"data" rpc:"required" desc:"JSON encoded structured transaction, or opaque data"`
+	Fee  uint64 `json:"fee" desc:"fee for opaque data; a default applies if 0"`
+}
+
+type addressTransactionsParams struct {
+	Address string `json:"address" rpc:"required"`
+	Cursor  string `json:"cursor" desc:"next_cursor of the previous page"`
+	Limit   int    `json:"limit" desc:"page size; 0 for the default"`
+}
+
+func (p *addressTransactionsParams) validate() error {
+	if p.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+type estimateFeeParams struct {
+	TargetConfirmations int `json:"targetConfirmations" default:"1"`
+}
+
+func (p *estimateFeeParams) validate() error {
+	if p.TargetConfirmations < 1 || p.TargetConfirmations > mempool.MaxTargetConfirmations {
+		return fmt.Errorf("targetConfirmations must be between 1 and %d", mempool.MaxTargetConfirmations)
+	}
+	return nil
+}
+
+type txProofParams struct {
+	TxID     string `json:"txid" rpc:"required"`
+	VertexID string `json:"vertexId" desc:"vertex holding the transaction; looked up in the address index if empty"`
+}
+
+type blockTemplateParams struct {
+	PayAddress string `json:"payAddress" desc:"address credited with the reward; the mining address if empty"`
+	LongPollID string `json:"longPollId" desc:"longpoll_id of work already held"`
+}
+
+type submitBlockParams struct {
+	Header *dag.Header `json:"header" rpc:"required" desc:"header from the block template"`
+	Nonce  *uint64     `json:"nonce" desc:"replaces the header nonce"`
+}
+
+type mineParams struct {
+	N int `json:"n" default:"1"`
+}
+
+func (p *mineParams) validate() error {
+	if p.N < 1 || p.N > miner.MaxForcedVertices {
+		return fmt.Errorf("n must be between 1 and %d", miner.MaxForcedVertices)
+	}
+	return nil
+}
+
+type startMiningParams struct {
+	Threads int    `json:"threads" desc:"at most 4 per CPU; 0 keeps the current thread count"`
+	Address string `json:"address" desc:"also sets the mining address"`
+}
+
+func (p *startMiningParams) validate() error {
+	if p.Threads < 0 || p.Threads > miner.MaxThreads() {
+		return fmt.Errorf("threads must be between 0 and %d", miner.MaxThreads())
+	}
+	if p.Address != "" {
+		return ledger.ValidateAddress(p.Address)
+	}
+	return nil
+}
+
+type subscribeParams struct {
+	Topic string `json:"topic" rpc:"required" desc:"newVertex, newTransaction, tipsChanged, chainChanged, finalized or miningStatus"`
+}
+
+type unsubscribeParams struct {
+	Subscription string `json:"subscription" rpc:"required"`
+}
+
+// registerMethods builds the registry of the server's RPC methods
+func (s *Server) registerMethods() *registry {
+	r := newRegistry()
+
+	register(r, "rpc.discover", "Describe the API as an OpenRPC document",
+		func(ctx context.Context, _ *noParams) (*openRPCDocument, error) {
+			return r.openRPC(), nil
+		})
+
+	register(r, "blockdag_getStatus", "Get the current status of the BlockDAG node",
+		func(ctx context.Context, _ *noParams) (*statusResult, error) {
+			return s.getStatus()
+		})
+	register(r, "blockdag_getPeers", "Get list of peers that completed the version handshake",
+		func(ctx context.Context, _ *noParams) ([]peerResult, error) {
+			return s.getPeers()
+		})
+	register(r, "blockdag_getSyncStatus", "Get DAG synchronization progress; mining is held back while the state is syncing",
+		func(ctx context.Context, _ *noParams) (*syncStatusResult, error) {
+			return s.getSyncStatus()
+		})
+	register(r, "blockdag_listBanned", "List banned peer hosts. Peers are banned automatically once their misbehavior score reaches 100.",
+		func(ctx context.Context, _ *noParams) ([]bannedHost, error) {
+			return s.listBanned()
+		})
+	register(r, "blockdag_ban", "Ban the host of a peer address for duration seconds (default one day) and disconnect its peers",
+		func(ctx context.Context, p *banParams) (*banResult, error) {
+			return s.ban(p.Address, p.Duration, p.Reason)
+		})
+	register(r, "blockdag_unban", "Lift the ban on the host of a peer address",
+		func(ctx context.Context, p *addressParams) (*unbanResult, error) {
+			return s.unban(p.Address)
+		})
+
+	register(r, "blockdag_getMempool", "Get current mempool status and transactions",
+		func(ctx context.Context, _ *noParams) (*mempoolResult, error) {
+			return s.getMempool()
+		})
+	register(r, "blockdag_getVertices", "Get all vertices in the DAG",
+		func(ctx context.Context, _ *noParams) ([]vertexSummary, error) {
+			return s.getVertices()
+		})
+	register(r, "blockdag_getVertex", "Get a specific vertex by ID, with its payload in base64",
+		func(ctx context.Context, p *vertexParams) (*vertexResult, error) {
+			return s.getVertex(p.ID)
+		})
+	register(r, "blockdag_getHeaviestPath", "Get the heaviest path through the DAG",
+		func(ctx context.Context, _ *noParams) ([]pathVertex, error) {
+			return s.getHeaviestPath()
+		})
+
+	register(r, "blockdag_submitTransaction", "Submit a new transaction to the mempool. data is either an encoded structured transaction or opaque data; fee applies to opaque data only",
+		func(ctx context.Context, p *transactionParams) (*submitTransactionResult, error) {
+			return s.submitTransaction(p.Data, p.Fee)
+		})
+	register(r, "blockdag_getAddressTransactions", "Get transactions involving an address, newest first (requires -addrindex)",
+		func(ctx context.Context, p *addressTransactionsParams) (*addressTransactionsResult, error) {
+			return s.getAddressTransactions(p.Address, p.Cursor, p.Limit)
+		})
+	register(r, "blockdag_getBalance", "Get the account state of an address; history totals are included when the address index is enabled",
+		func(ctx context.Context, p *addressParams) (*balanceResult, error) {
+			return s.getBalance(p.Address)
+		})
+	register(r, "blockdag_simulateTransaction", "Validate and apply a transaction against the current state without submitting it",
+		func(ctx context.Context, p *transactionParams) (*ledger.Simulation, error) {
+			return s.simulateTransaction(p.Data, p.Fee)
+		})
+	register(r, "blockdag_estimateFee", "Suggest fee rates (fee per byte) for inclusion within targetConfirmations vertices",
+		func(ctx context.Context, p *estimateFeeParams) (*mempool.FeeEstimate, error) {
+			return s.estimateFee(p.TargetConfirmations)
+		})
+	register(r, "blockdag_getTxProof", "Get a Merkle inclusion proof for a transaction, anchored at a finalized vertex when possible. vertexId is required when the address index is disabled",
+		func(ctx context.Context, p *txProofParams) (*proof.TxProof, error) {
+			return s.getTxProof(p.TxID, p.VertexID)
+		})
+
+	register(r, "blockdag_getBlockTemplate", "Get work for an external miner. Append a decimal nonce to header_preimage and hash it with algorithm (sha256d: SHA-256 applied twice; scrypt: N=1024, r=1, p=1, the input as password and salt, 32 bytes) until the hash is at or below target. With longPollId, the call is held until that work goes stale (at most 60s).",
+		func(ctx context.Context, p *blockTemplateParams) (*miner.Work, error) {
+			return s.getBlockTemplate(ctx, p.PayAddress, p.LongPollID)
+		})
+	register(r, "blockdag_submitBlock", "Submit a header solved from blockdag_getBlockTemplate work; the header timestamp may be rolled forward",
+		func(ctx context.Context, p *submitBlockParams) (*submitBlockResult, error) {
+			if p.Nonce != nil {
+				p.Header.Nonce = *p.Nonce
+			}
+			return s.submitBlock(p.Header)
+		})
+	register(r, "blockdag_mine", "Force-produce n vertices (default 1, at most 1000) from the current tips and mempool, including empty ones. Instant on a -devnet node; otherwise each vertex needs proof of work.",
+		func(ctx context.Context, p *mineParams) (*mineResult, error) {
+			return s.mine(ctx, p.N)
+		})
+	register(r, "blockdag_getMiningStats", "Get current mining statistics. hashrate is the sum of per-worker moving averages; blue/red/pending count the node's own vertices by GHOSTDAG color along the heaviest chain. The same figures are served in Prometheus format at /metrics.",
+		func(ctx context.Context, _ *noParams) (*miningStatsResult, error) {
+			return s.getMiningStats()
+		})
+	register(r, "blockdag_startMining", "Start the mining process; threads 0 keeps the current thread count, and address also sets the mining address",
+		func(ctx context.Context, p *startMiningParams) (*startMiningResult, error) {
+			return s.startMining(p.Threads, p.Address)
+		})
+	register(r, "blockdag_stopMining", "Stop the mining process; success is false if the miner was not running",
+		func(ctx context.Context, _ *noParams) (*stopMiningResult, error) {
+			return s.stopMining()
+		})
+	register(r, "blockdag_setMiningAddress", "Set the address credited with the rewards of vertices the node mines",
+		func(ctx context.Context, p *addressParams) (*miningAddressResult, error) {
+			return s.setMiningAddress(p.Address)
+		})
+
+	register(r, "blockdag_subscribe", "Subscribe to an event over the WebSocket endpoint /ws. Events arrive as blockdag_subscription notifications with params {subscription, result}; a client whose notification queue fills up is disconnected with close code 1008",
+		func(ctx context.Context, p *subscribeParams) (string, error) {
+			session := sessionFrom(ctx)
+			if session == nil {
+				return "", errNeedsWebSocket
+			}
+			return s.hub.subscribe(session, p.Topic)
+		})
+	register(r, "blockdag_unsubscribe", "Cancel a subscription made on the same WebSocket connection",
+		func(ctx context.Context, p *unsubscribeParams) (bool, error) {
+			session := sessionFrom(ctx)
+			if session == nil {
+				return false, errNeedsWebSocket
+			}
+			return s.hub.unsubscribe(session, p.Subscription), nil
+		})
+
+	return r
+}
+
+// errNeedsWebSocket answers subscription calls made over HTTP
+var errNeedsWebSocket = &rpcError{code: codeMethodNotFound, message: "Method not found", data: "subscriptions need a WebSocket connection on /ws"}
+
+// OpenRPC returns the OpenRPC document describing the node's RPC methods,
+// as served by rpc.discover
+func OpenRPC() ([]byte, error) {
+	// Describing the methods does not call them, so no services are needed
+	return json.MarshalIndent((&Server{}).registerMethods().openRPC(), "", "  ")
+}
@@ -0,0 +1,27 @@
+package rpc
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// openRPCContract is the committed OpenRPC document, relative to this package
+const openRPCContract = "../../../../contracts/rpc/blockdag.openrpc.json"
+
+func TestOpenRPCMatchesContract(t *testing.T) {
+	document, err := OpenRPC()
+	if err != nil {
+		t.Fatalf("OpenRPC: %v", err)
+	}
+	committed, err := os.ReadFile(openRPCContract)
+	if err != nil {
+		t.Fatalf("reading the contract: %v", err)
+	}
+
+	// blockdag-node openrpc ends the document with a newline
+	if !bytes.Equal(append(document, '\n'), committed) {
+		t.Errorf("blockdag.openrpc.json is out of date; regenerate it from services/blockdag-node with " +
+			"`go run ./cmd/blockdag-node openrpc > ../../contracts/rpc/blockdag.openrpc.json`")
+	}
+}
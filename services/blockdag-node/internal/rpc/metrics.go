@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// handleMetrics serves node metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.getMiningStats()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	mining := 0
+	if stats.Mining {
+		mining = 1
+	}
+	writeMetric(w, "blockdag_miner_running", "gauge", "Whether the miner is running", mining)
+	writeMetric(w, "blockdag_miner_threads", "gauge", "Nonce search goroutines", stats.Threads)
+	writeMetric(w, "blockdag_miner_hashrate", "gauge", "Hashes per second over all workers", stats.Hashrate)
+
+	fmt.Fprintln(w, "# HELP blockdag_miner_worker_hashrate Moving average hashes per second of one worker")
+	fmt.Fprintln(w, "# TYPE blockdag_miner_worker_hashrate gauge")
+	for worker, rate := range stats.WorkerHashrates {
+		fmt.Fprintf(w, "blockdag_miner_worker_hashrate{worker=\"%d\"} %v\n", worker, rate)
+	}
+
+	writeMetric(w, "blockdag_miner_hashes_total", "counter", "Hashes computed", stats.TotalHashes)
+	writeMetric(w, "blockdag_miner_vertices_found_total", "counter", "Vertices mined by the node", stats.VerticesFound)
+	writeMetric(w, "blockdag_miner_vertices_submitted_total", "counter", "Vertices submitted by external miners", stats.VerticesSubmitted)
+	writeMetric(w, "blockdag_miner_stale_templates_total", "counter", "Templates abandoned before they were solved", stats.StaleTemplates)
+	writeMetric(w, "blockdag_miner_solve_seconds_avg", "gauge", "Average time to solve a template", stats.AvgSolveSeconds)
+
+	fmt.Fprintln(w, "# HELP blockdag_miner_own_vertices Vertices produced by the node by GHOSTDAG color")
+	fmt.Fprintln(w, "# TYPE blockdag_miner_own_vertices gauge")
+	fmt.Fprintf(w, "blockdag_miner_own_vertices{color=\"blue\"} %v\n", stats.BlueVertices)
+	fmt.Fprintf(w, "blockdag_miner_own_vertices{color=\"red\"} %v\n", stats.RedVertices)
+	fmt.Fprintf(w, "blockdag_miner_own_vertices{color=\"pending\"} %v\n", stats.PendingVertices)
+
+	writeMetric(w, "blockdag_mempool_transactions", "gauge", "Transactions in the mempool", stats.MempoolSize)
+	writeMetric(w, "blockdag_dag_tips", "gauge", "Current DAG tips", stats.CurrentTips)
+	writeMetric(w, "blockdag_peers", "gauge", "Connected peers", len(s.p2pNode.GetPeers()))
+}
+
+// writeMetric writes a single unlabelled sample with its help and type lines
+func writeMetric(w io.Writer, name, metricType, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+	fmt.Fprintf(w, "%s %v\n", name, value)
+}
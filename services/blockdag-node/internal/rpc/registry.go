@@ -0,0 +1,431 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"hackodisha/blockdag-node/internal/p2p"
+)
+
+// openRPCVersion is the OpenRPC specification rpc.discover follows
+const openRPCVersion = "1.2.6"
+
+// Methods declare their parameters as a struct whose fields, in order, are
+// the positional parameters. Field tags describe them:
+//
+//	json:"name"        the parameter name
+//	rpc:"required"     the call fails without it
+//	default:"1"        JSON value used when it is absent
+//	desc:"..."         description for rpc.discover
+//
+// A params struct with a validate() error method has it called after
+// decoding; its error is reported as invalid params.
+
+// validator checks decoded parameters
+type validator interface {
+	validate() error
+}
+
+// noParams is the params struct of methods without parameters
+type noParams struct{}
+
+// registry holds the RPC methods by name
+type registry struct {
+	methods map[string]*method
+}
+
+// method is a registered RPC method
+type method struct {
+	name        string
+	description string
+	params      reflect.Type // struct holding the parameters
+	fields      []paramField
+	result      reflect.Type
+	invoke      func(ctx context.Context, params interface{}) (interface{}, error)
+}
+
+// paramField is one parameter of a method
+type paramField struct {
+	name        string
+	index       int // of the struct field
+	required    bool
+	fallback    json.RawMessage // nil without a default
+	description string
+}
+
+// newRegistry creates an empty registry
+func newRegistry() *registry {
+	return &registry{methods: make(map[string]*method)}
+}
+
+// register adds a method whose parameters decode into a P and whose
+// result is an R. Malformed params structs are programming errors, so
+// they panic at startup.
+func register[P, R any](r *registry, name, description string, handler func(ctx context.Context, params *P) (R, error)) {
+	paramsType := reflect.TypeOf((*P)(nil)).Elem()
+	if paramsType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("rpc: params of %s must be a struct", name))
+	}
+	if _, exists := r.methods[name]; exists {
+		panic(fmt.Sprintf("rpc: method %s registered twice", name))
+	}
+
+	r.methods[name] = &method{
+		name:        name,
+		description: description,
+		params:      paramsType,
+		fields:      paramFields(name, paramsType),
+		result:      reflect.TypeOf((*R)(nil)).Elem(),
+		invoke: func(ctx context.Context, params interface{}) (interface{}, error) {
+			return handler(ctx, params.(*P))
+		},
+	}
+}
+
+// paramFields reads the parameters from a params struct's tags
+func paramFields(methodName string, t reflect.Type) []paramField {
+	fields := make([]paramField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if !field.IsExported() || name == "" || name == "-" {
+			panic(fmt.Sprintf("rpc: parameter field %s of %s needs a json name", field.Name, methodName))
+		}
+
+		param := paramField{
+			name:        name,
+			index:       i,
+			required:    field.Tag.Get("rpc") == "required",
+			description: field.Tag.Get("desc"),
+		}
+		if fallback, ok := field.Tag.Lookup("default"); ok {
+			if err := json.Unmarshal([]byte(fallback), reflect.New(field.Type).Interface()); err != nil {
+				panic(fmt.Sprintf("rpc: invalid default for %s of %s: %v", name, methodName, err))
+			}
+			param.fallback = json.RawMessage(fallback)
+		}
+		fields = append(fields, param)
+	}
+	return fields
+}
+
+// lookup returns a method by name
+func (r *registry) lookup(name string) (*method, bool) {
+	m, exists := r.methods[name]
+	return m, exists
+}
+
+// sorted returns the methods in name order
+func (r *registry) sorted() []*method {
+	methods := make([]*method, 0, len(r.methods))
+	for _, m := range r.methods {
+		methods = append(methods, m)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].name < methods[j].name
+	})
+	return methods
+}
+
+// call decodes the parameters of a request and runs the method
+func (m *method) call(ctx context.Context, rawParams json.RawMessage) (interface{}, error) {
+	params, err := m.decode(rawParams)
+	if err != nil {
+		return nil, err
+	}
+	return m.invoke(ctx, params)
+}
+
+// decode fills a new params struct from parameters given by name or by
+// position, applying defaults and validation
+func (m *method) decode(raw json.RawMessage) (interface{}, error) {
+	values, err := m.namedParams(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	params := reflect.New(m.params)
+	for _, field := range m.fields {
+		value, given := values[field.name]
+		if !given {
+			if field.required {
+				return nil, invalidParams("missing parameter %s", field.name)
+			}
+			if field.fallback == nil {
+				continue
+			}
+			value = field.fallback
+		}
+
+		target := params.Elem().Field(field.index)
+		if err := json.Unmarshal(value, target.Addr().Interface()); err != nil {
+			if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+				if typeErr.Field != "" {
+					return nil, invalidParams("field %s of parameter %s must be %s", typeErr.Field, field.name, jsonType(typeErr.Type))
+				}
+				return nil, invalidParams("parameter %s must be %s", field.name, jsonType(target.Type()))
+			}
+			return nil, invalidParams("parameter %s: %v", field.name, err)
+		}
+	}
+
+	if v, ok := params.Interface().(validator); ok {
+		if err := v.validate(); err != nil {
+			return nil, invalidParams("%v", err)
+		}
+	}
+	return params.Interface(), nil
+}
+
+// namedParams maps parameters given by name or by position to their
+// names. Null counts as absent.
+func (m *method) namedParams(raw json.RawMessage) (map[string]json.RawMessage, error) {
+	values := make(map[string]json.RawMessage)
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || isNull(raw) {
+		return values, nil
+	}
+
+	switch raw[0] {
+	case '{':
+		var named map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &named); err != nil {
+			return nil, invalidParams("%v", err)
+		}
+		for name, value := range named {
+			if !m.hasParam(name) {
+				return nil, invalidParams("unknown parameter %q", name)
+			}
+			if !isNull(value) {
+				values[name] = value
+			}
+		}
+	case '[':
+		var positional []json.RawMessage
+		if err := json.Unmarshal(raw, &positional); err != nil {
+			return nil, invalidParams("%v", err)
+		}
+		if len(positional) > len(m.fields) {
+			return nil, invalidParams("%s takes at most %d parameters, got %d", m.name, len(m.fields), len(positional))
+		}
+		for i, value := range positional {
+			if !isNull(value) {
+				values[m.fields[i].name] = value
+			}
+		}
+	default:
+		return nil, invalidParams("params must be an array or an object")
+	}
+	return values, nil
+}
+
+// hasParam reports whether the method takes a parameter
+func (m *method) hasParam(name string) bool {
+	for _, field := range m.fields {
+		if field.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isNull reports whether a JSON value is null
+func isNull(value json.RawMessage) bool {
+	return string(bytes.TrimSpace(value)) == "null"
+}
+
+// jsonType names the JSON type a Go type decodes from
+func jsonType(t reflect.Type) string {
+	switch schema := schemaFor(t, nil); schema["type"] {
+	case "boolean":
+		return "a boolean"
+	case "integer":
+		if _, unsigned := schema["minimum"]; unsigned {
+			return "a non-negative integer"
+		}
+		return "an integer"
+	case "number":
+		return "a number"
+	case "string":
+		return "a string"
+	case "array":
+		return "an array"
+	case "object":
+		return "an object"
+	}
+	return "valid JSON"
+}
+
+// OpenRPC document, as served by rpc.discover
+type openRPCDocument struct {
+	OpenRPC string          `json:"openrpc"`
+	Info    openRPCInfo     `json:"info"`
+	Methods []openRPCMethod `json:"methods"`
+}
+
+type openRPCInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type openRPCMethod struct {
+	Name           string         `json:"name"`
+	Description    string         `json:"description,omitempty"`
+	ParamStructure string         `json:"paramStructure"`
+	Params         []openRPCParam `json:"params"`
+	Result         openRPCParam   `json:"result"`
+}
+
+type openRPCParam struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Required    bool                   `json:"required,omitempty"`
+	Schema      map[string]interface{} `json:"schema"`
+}
+
+// openRPC describes every registered method
+func (r *registry) openRPC() *openRPCDocument {
+	doc := &openRPCDocument{
+		OpenRPC: openRPCVersion,
+		Info: openRPCInfo{
+			Title:       "BlockDAG node JSON-RPC",
+			Description: "JSON-RPC 2.0 over HTTP POST to /rpc and over the WebSocket endpoint /ws, where blockdag_subscribe is available",
+			Version:     p2p.UserAgent[strings.Index(p2p.UserAgent, "/")+1:],
+		},
+		Methods: make([]openRPCMethod, 0, len(r.methods)),
+	}
+
+	for _, m := range r.sorted() {
+		params := make([]openRPCParam, len(m.fields))
+		for i, field := range m.fields {
+			schema := schemaFor(m.params.Field(field.index).Type, nil)
+			if field.fallback != nil {
+				var fallback interface{}
+				json.Unmarshal(field.fallback, &fallback)
+				schema["default"] = fallback
+			}
+			params[i] = openRPCParam{
+				Name:        field.name,
+				Description: field.description,
+				Required:    field.required,
+				Schema:      schema,
+			}
+		}
+
+		result := openRPCParam{Name: "result", Schema: schemaFor(m.result, nil)}
+		if m.result == reflect.TypeOf(doc) {
+			result = openRPCParam{
+				Name:   "OpenRPC Schema",
+				Schema: map[string]interface{}{"$ref": "https://raw.githubusercontent.com/open-rpc/meta-schema/master/schema.json"},
+			}
+		}
+
+		doc.Methods = append(doc.Methods, openRPCMethod{
+			Name:           m.name,
+			Description:    m.description,
+			ParamStructure: "either",
+			Params:         params,
+			Result:         result,
+		})
+	}
+	return doc
+}
+
+// Types with their own JSON form
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaFor derives the JSON Schema of a Go type from how encoding/json
+// handles it. seen guards against recursive types.
+func schemaFor(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Ptr:
+		return schemaFor(t.Elem(), seen)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		nested := map[reflect.Type]bool{t: true}
+		for seenType := range seen {
+			nested[seenType] = true
+		}
+
+		properties := make(map[string]interface{})
+		required := make([]string, 0)
+		addProperties(t, nested, properties, &required)
+
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]interface{}{}
+}
+
+// addProperties adds the JSON fields of a struct to a schema, flattening
+// embedded structs as encoding/json does. Fields without omitempty are
+// always present, so they are required.
+func addProperties(t reflect.Type, seen map[reflect.Type]bool, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		if field.Anonymous && tag[0] == "" && field.Type.Kind() == reflect.Struct {
+			addProperties(field.Type, seen, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaFor(field.Type, seen)
+
+		omitEmpty := false
+		for _, option := range tag[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+		if !omitEmpty {
+			*required = append(*required, name)
+		}
+	}
+}
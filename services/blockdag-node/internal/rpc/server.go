@@ -3,18 +3,31 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"hackodisha/blockdag-node/internal/consensus"
 	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/index"
+	"hackodisha/blockdag-node/internal/ledger"
 	"hackodisha/blockdag-node/internal/mempool"
 	"hackodisha/blockdag-node/internal/miner"
 	"hackodisha/blockdag-node/internal/p2p"
+	"hackodisha/blockdag-node/internal/proof"
 )
 
+// DefaultDataFee is charged for opaque data submitted without a fee
+const DefaultDataFee = 1000
+
+// longPollTimeout bounds how long a block template long poll is held
+const longPollTimeout = 60 * time.Second
+
 // Server provides JSON-RPC and WebSocket endpoints
 type Server struct {
 	dagStore        *dag.Store
@@ -22,18 +35,41 @@ type Server struct {
 	mempool         *mempool.Mempool
 	miner           *miner.Miner
 	p2pNode         *p2p.Node
+	addrIndex       *index.AddrIndex // nil when the address index is disabled
+	feeEstimator    *mempool.FeeEstimator
+	state           *ledger.State
+	methods         *registry
+	hub             *hub // WebSocket subscriptions
 	server          *http.Server
+
+	// allowedOrigins are the browser origins, besides the server's own,
+	// that may call the RPC; "*" allows any
+	allowedOrigins []string
 }
 
 // NewServer creates a new RPC server
-func NewServer(dagStore *dag.Store, consensusEngine *consensus.Engine, mempool *mempool.Mempool, miner *miner.Miner, p2pNode *p2p.Node) *Server {
-	return &Server{
+func NewServer(dagStore *dag.Store, consensusEngine *consensus.Engine, mempool *mempool.Mempool, miner *miner.Miner, p2pNode *p2p.Node, addrIndex *index.AddrIndex, feeEstimator *mempool.FeeEstimator, state *ledger.State) *Server {
+	s := &Server{
 		dagStore:        dagStore,
 		consensusEngine: consensusEngine,
 		mempool:         mempool,
 		miner:           miner,
 		p2pNode:         p2pNode,
+		addrIndex:       addrIndex,
+		feeEstimator:    feeEstimator,
+		state:           state,
 	}
+	s.methods = s.registerMethods()
+	s.hub = newHub(s)
+	return s
+}
+
+// SetAllowedOrigins sets the browser origins, such as
+// "https://explorer.example", that may call the RPC besides the server's
+// own; "*" allows any. Requests without an Origin header do not come from
+// a browser page and are always served.
+func (s *Server) SetAllowedOrigins(origins []string) {
+	s.allowedOrigins = origins
 }
 
 // Start starts the RPC server
@@ -51,6 +87,9 @@ func (s *Server) Start(address string) error {
 	mux.HandleFunc("/api/v1/vertices", s.handleVertices)
 	mux.HandleFunc("/api/v1/vertex/", s.handleVertex)
 
+	// Prometheus metrics
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
 	// WebSocket endpoint
 	mux.HandleFunc("/ws", s.handleWebSocket)
 
@@ -59,82 +98,82 @@ func (s *Server) Start(address string) error {
 		Handler: mux,
 	}
 
+	go s.hub.run()
+
 	log.Printf("RPC server starting on %s", address)
 	return s.server.ListenAndServe()
 }
 
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.hub.stop()
 	if s.server != nil {
 		return s.server.Shutdown(ctx)
 	}
 	return nil
 }
 
+// originAllowed reports whether a request may be served: a page on
+// another site must not drive the node's admin methods through the
+// visitor's browser
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if parsed, err := url.Parse(origin); err == nil && strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range s.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
 // handleJSONRPC handles JSON-RPC requests
 func (s *Server) handleJSONRPC(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	var request struct {
-		JSONRPC string      `json:"jsonrpc"`
-		Method  string      `json:"method"`
-		Params  interface{} `json:"params"`
-		ID      interface{} `json:"id"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		s.sendJSONRPCError(w, request.ID, -32700, "Parse error", nil)
+	if !s.originAllowed(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
 		return
 	}
 
-	// Handle different methods
-	var result interface{}
-	var err error
-
-	switch request.Method {
-	case "blockdag_getStatus":
-		result, err = s.getStatus()
-	case "blockdag_getPeers":
-		result, err = s.getPeers()
-	case "blockdag_getMempool":
-		result, err = s.getMempool()
-	case "blockdag_getVertices":
-		result, err = s.getVertices()
-	case "blockdag_getVertex":
-		if params, ok := request.Params.(map[string]interface{}); ok {
-			if id, ok := params["id"].(string); ok {
-				result, err = s.getVertex(id)
-			} else {
-				err = fmt.Errorf("missing or invalid vertex ID")
-			}
-		} else {
-			err = fmt.Errorf("invalid parameters")
-		}
-	case "blockdag_getHeaviestPath":
-		result, err = s.getHeaviestPath()
-	case "blockdag_submitTransaction":
-		if params, ok := request.Params.(map[string]interface{}); ok {
-			if data, ok := params["data"].(string); ok {
-				result, err = s.submitTransaction(data)
-			} else {
-				err = fmt.Errorf("missing or invalid transaction data")
-			}
-		} else {
-			err = fmt.Errorf("invalid parameters")
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if !errors.As(err, &tooLarge) {
+			http.Error(w, "Failed to read request", http.StatusBadRequest)
+			return
 		}
-	default:
-		err = fmt.Errorf("unknown method: %s", request.Method)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write(encodeResponse(jsonRPCError(nil, codeInvalidRequest, "Invalid Request",
+			fmt.Sprintf("request body exceeds %d bytes", maxRequestSize))))
+		return
 	}
 
-	if err != nil {
-		s.sendJSONRPCError(w, request.ID, -32603, "Internal error", err.Error())
+	response := handleMessage(r.Context(), body, s.call)
+	if response == nil {
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	s.sendJSONRPCSuccess(w, request.ID, result)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// call runs an RPC method, for HTTP and WebSocket clients alike
+func (s *Server) call(ctx context.Context, name string, params json.RawMessage) (interface{}, error) {
+	m, exists := s.methods.lookup(name)
+	if !exists {
+		return nil, &rpcError{code: codeMethodNotFound, message: "Method not found", data: name}
+	}
+	return m.call(ctx, params)
 }
 
 // handleStatus handles status requests
@@ -204,35 +243,17 @@ func (s *Server) handleVertex(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(vertex)
 }
 
-// handleWebSocket handles WebSocket connections
-func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	// For now, return a simple JSON response to avoid 501 errors
-	// This allows Studio service to connect without crashing
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	response := map[string]interface{}{
-		"status":    "WebSocket endpoint available but not fully implemented",
-		"message":   "This is a placeholder response to prevent connection errors",
-		"timestamp": time.Now().Unix(),
-	}
-
-	json.NewEncoder(w).Encode(response)
-}
-
-// JSON-RPC helper methods
-func (s *Server) sendJSONRPCSuccess(w http.ResponseWriter, id interface{}, result interface{}) {
-	response := map[string]interface{}{
+// jsonRPCSuccess builds a response carrying a result
+func jsonRPCSuccess(id interface{}, result interface{}) map[string]interface{} {
+	return map[string]interface{}{
 		"jsonrpc": "2.0",
 		"result":  result,
 		"id":      id,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
 }
 
-func (s *Server) sendJSONRPCError(w http.ResponseWriter, id interface{}, code int, message string, data interface{}) {
+// jsonRPCError builds an error response; data is left out if nil
+func jsonRPCError(id interface{}, code int, message string, data interface{}) map[string]interface{} {
 	response := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"error": map[string]interface{}{
@@ -245,124 +266,318 @@ func (s *Server) sendJSONRPCError(w http.ResponseWriter, id interface{}, code in
 	if data != nil {
 		response["error"].(map[string]interface{})["data"] = data
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	return response
 }
 
 // RPC method implementations
-func (s *Server) getStatus() (map[string]interface{}, error) {
+
+// statusResult is the result of blockdag_getStatus
+type statusResult struct {
+	Status      string `json:"status"`
+	Timestamp   int64  `json:"timestamp"`
+	Mining      bool   `json:"mining"`
+	PeersCount  int    `json:"peers_count"`
+	SyncState   string `json:"sync_state"`
+	MempoolSize int    `json:"mempool_size"`
+	CurrentTips int    `json:"current_tips"`
+}
+
+func (s *Server) getStatus() (*statusResult, error) {
 	miningStats := s.miner.GetMiningStats()
 	peers := s.p2pNode.GetPeers()
 
-	return map[string]interface{}{
-		"status":       "running",
-		"timestamp":    time.Now().Unix(),
-		"mining":       miningStats["mining"],
-		"peers_count":  len(peers),
-		"mempool_size": miningStats["mempool_size"],
-		"current_tips": miningStats["current_tips"],
+	return &statusResult{
+		Status:      "running",
+		Timestamp:   time.Now().Unix(),
+		Mining:      miningStats.Mining,
+		PeersCount:  len(peers),
+		SyncState:   s.p2pNode.SyncStatus().State,
+		MempoolSize: miningStats.MempoolSize,
+		CurrentTips: miningStats.CurrentTips,
 	}, nil
 }
 
-func (s *Server) getPeers() ([]map[string]interface{}, error) {
+// peerResult describes a connected peer
+type peerResult struct {
+	ID              string  `json:"id"`
+	Address         string  `json:"address"`
+	Inbound         bool    `json:"inbound"`
+	LastSeen        int64   `json:"last_seen"`
+	ProtocolVersion uint32  `json:"protocol_version"`
+	Services        uint64  `json:"services"`
+	UserAgent       string  `json:"user_agent"`
+	Encrypted       bool    `json:"encrypted"`
+	BanScore        int     `json:"ban_score"`
+	RTTSeconds      float64 `json:"rtt_seconds"`
+	BytesSent       uint64  `json:"bytes_sent"`
+	BytesReceived   uint64  `json:"bytes_received"`
+}
+
+func (s *Server) getPeers() ([]peerResult, error) {
 	peers := s.p2pNode.GetPeers()
-	result := make([]map[string]interface{}, len(peers))
+	result := make([]peerResult, len(peers))
 
 	for i, peer := range peers {
-		result[i] = map[string]interface{}{
-			"id":        peer.ID,
-			"address":   peer.Address,
-			"last_seen": peer.LastSeen.Unix(),
+		result[i] = peerResult{
+			ID:              peer.ID,
+			Address:         peer.Address,
+			Inbound:         peer.Inbound,
+			LastSeen:        peer.LastSeen.Unix(),
+			ProtocolVersion: peer.ProtocolVersion,
+			Services:        peer.Services,
+			UserAgent:       peer.UserAgent,
+			Encrypted:       peer.Encrypted,
+			BanScore:        peer.BanScore,
+			RTTSeconds:      peer.RTT.Seconds(),
+			BytesSent:       peer.BytesSent,
+			BytesReceived:   peer.BytesReceived,
 		}
 	}
 
 	return result, nil
 }
 
-func (s *Server) getMempool() (map[string]interface{}, error) {
+// bannedHost describes a ban
+type bannedHost struct {
+	Host    string `json:"host"`
+	Reason  string `json:"reason"`
+	Created int64  `json:"created"`
+	Expires int64  `json:"expires"`
+}
+
+func (s *Server) listBanned() ([]bannedHost, error) {
+	bans := s.p2pNode.Banned()
+	result := make([]bannedHost, len(bans))
+
+	for i, ban := range bans {
+		result[i] = bannedHost{
+			Host:    ban.Host,
+			Reason:  ban.Reason,
+			Created: ban.Created.Unix(),
+			Expires: ban.Expires.Unix(),
+		}
+	}
+
+	return result, nil
+}
+
+// banResult is the result of blockdag_ban
+type banResult struct {
+	Address string `json:"address"`
+	Expires int64  `json:"expires"`
+}
+
+// ban bans a peer's host for duration seconds, a day if zero
+func (s *Server) ban(address string, duration float64, reason string) (*banResult, error) {
+	banDuration := p2p.DefaultBanDuration
+	if duration > 0 {
+		banDuration = time.Duration(duration * float64(time.Second))
+	}
+	if reason == "" {
+		reason = "banned by operator"
+	}
+
+	if err := s.p2pNode.Ban(address, banDuration, reason); err != nil {
+		return nil, err
+	}
+
+	return &banResult{
+		Address: address,
+		Expires: time.Now().Add(banDuration).Unix(),
+	}, nil
+}
+
+// unbanResult is the result of blockdag_unban
+type unbanResult struct {
+	Address string `json:"address"`
+	Removed bool   `json:"removed"`
+}
+
+func (s *Server) unban(address string) (*unbanResult, error) {
+	removed, err := s.p2pNode.Unban(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unbanResult{
+		Address: address,
+		Removed: removed,
+	}, nil
+}
+
+// syncStatusResult is the result of blockdag_getSyncStatus
+type syncStatusResult struct {
+	State             string  `json:"state"`
+	Synced            bool    `json:"synced"`
+	SyncPeer          string  `json:"sync_peer"`
+	Percent           float64 `json:"percent"`
+	HeadersReceived   int     `json:"headers_received"`
+	VerticesProcessed int     `json:"vertices_processed"`
+	VerticesPending   int     `json:"vertices_pending"`
+}
+
+func (s *Server) getSyncStatus() (*syncStatusResult, error) {
+	status := s.p2pNode.SyncStatus()
+
+	return &syncStatusResult{
+		State:             status.State,
+		Synced:            status.State == p2p.SyncSynced,
+		SyncPeer:          status.SyncPeer,
+		Percent:           status.Percent,
+		HeadersReceived:   status.HeadersReceived,
+		VerticesProcessed: status.VerticesProcessed,
+		VerticesPending:   status.VerticesPending,
+	}, nil
+}
+
+// mempoolTransaction summarizes a transaction waiting in the mempool
+type mempoolTransaction struct {
+	ID        string `json:"id"`
+	Size      int    `json:"size"`
+	Fee       uint64 `json:"fee"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// newMempoolTransaction summarizes tx
+func newMempoolTransaction(tx *mempool.Transaction) mempoolTransaction {
+	return mempoolTransaction{
+		ID:        tx.ID,
+		Size:      tx.Size,
+		Fee:       tx.Fee,
+		Timestamp: tx.Timestamp.Unix(),
+	}
+}
+
+// mempoolResult is the result of blockdag_getMempool
+type mempoolResult struct {
+	Count        int                  `json:"count"`
+	Transactions []mempoolTransaction `json:"transactions"`
+}
+
+func (s *Server) getMempool() (*mempoolResult, error) {
 	transactions := s.mempool.GetTransactions()
-	txList := make([]map[string]interface{}, len(transactions))
+	txList := make([]mempoolTransaction, len(transactions))
 
 	for i, tx := range transactions {
-		txList[i] = map[string]interface{}{
-			"id":        tx.ID,
-			"size":      tx.Size,
-			"fee":       tx.Fee,
-			"timestamp": tx.Timestamp.Unix(),
-		}
+		txList[i] = newMempoolTransaction(tx)
 	}
 
-	return map[string]interface{}{
-		"count":        len(transactions),
-		"transactions": txList,
+	return &mempoolResult{
+		Count:        len(transactions),
+		Transactions: txList,
 	}, nil
 }
 
-func (s *Server) getVertices() ([]map[string]interface{}, error) {
+// vertexSummary describes a vertex in a list of vertices
+type vertexSummary struct {
+	ID        string   `json:"id"`
+	Hash      string   `json:"hash"`
+	Parents   []string `json:"parents"`
+	Timestamp int64    `json:"timestamp"`
+	Weight    uint64   `json:"weight"`
+}
+
+func (s *Server) getVertices() ([]vertexSummary, error) {
 	vertices, err := s.dagStore.GetTopologicalOrder()
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]map[string]interface{}, len(vertices))
+	result := make([]vertexSummary, len(vertices))
 	for i, vertex := range vertices {
-		result[i] = map[string]interface{}{
-			"id":        vertex.ID,
-			"hash":      vertex.Hash,
-			"parents":   vertex.Parents,
-			"timestamp": vertex.Timestamp.Unix(),
-			"weight":    vertex.Weight,
+		result[i] = vertexSummary{
+			ID:        vertex.ID,
+			Hash:      vertex.Hash,
+			Parents:   vertex.Parents,
+			Timestamp: vertex.Timestamp.Unix(),
+			Weight:    vertex.Weight,
 		}
 	}
 
 	return result, nil
 }
 
-func (s *Server) getVertex(id string) (map[string]interface{}, error) {
+// vertexResult is the result of blockdag_getVertex. Data is the raw
+// payload, which JSON carries as base64.
+type vertexResult struct {
+	ID          string   `json:"id"`
+	Hash        string   `json:"hash"`
+	Data        []byte   `json:"data"`
+	PayloadRoot string   `json:"payload_root"`
+	Coinbase    string   `json:"coinbase"`
+	Parents     []string `json:"parents"`
+	Timestamp   int64    `json:"timestamp"`
+	Nonce       uint64   `json:"nonce"`
+	Weight      uint64   `json:"weight"`
+}
+
+func (s *Server) getVertex(id string) (*vertexResult, error) {
 	vertex, err := s.dagStore.GetVertex(id)
 	if err != nil {
 		return nil, err
 	}
 
-	return map[string]interface{}{
-		"id":        vertex.ID,
-		"hash":      vertex.Hash,
-		"data":      string(vertex.Data),
-		"parents":   vertex.Parents,
-		"timestamp": vertex.Timestamp.Unix(),
-		"nonce":     vertex.Nonce,
-		"weight":    vertex.Weight,
+	return &vertexResult{
+		ID:          vertex.ID,
+		Hash:        vertex.Hash,
+		Data:        vertex.Data,
+		PayloadRoot: vertex.PayloadRoot,
+		Coinbase:    vertex.Coinbase,
+		Parents:     vertex.Parents,
+		Timestamp:   vertex.Timestamp.Unix(),
+		Nonce:       vertex.Nonce,
+		Weight:      vertex.Weight,
 	}, nil
 }
 
-func (s *Server) getHeaviestPath() ([]map[string]interface{}, error) {
+// pathVertex is a vertex on the heaviest path
+type pathVertex struct {
+	ID        string `json:"id"`
+	Hash      string `json:"hash"`
+	Timestamp int64  `json:"timestamp"`
+	Weight    uint64 `json:"weight"`
+}
+
+func (s *Server) getHeaviestPath() ([]pathVertex, error) {
 	path, err := s.consensusEngine.GetHeaviestPath()
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]map[string]interface{}, len(path))
+	result := make([]pathVertex, len(path))
 	for i, vertex := range path {
-		result[i] = map[string]interface{}{
-			"id":        vertex.ID,
-			"hash":      vertex.Hash,
-			"timestamp": vertex.Timestamp.Unix(),
-			"weight":    vertex.Weight,
+		result[i] = pathVertex{
+			ID:        vertex.ID,
+			Hash:      vertex.Hash,
+			Timestamp: vertex.Timestamp.Unix(),
+			Weight:    vertex.Weight,
 		}
 	}
 
 	return result, nil
 }
 
-func (s *Server) submitTransaction(data string) (map[string]interface{}, error) {
+// submitTransactionResult is the result of blockdag_submitTransaction
+type submitTransactionResult struct {
+	TxID    string `json:"txid"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func (s *Server) submitTransaction(data string, fee uint64) (*submitTransactionResult, error) {
+	ltx, err := s.buildTransaction(data, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.state.CheckTransaction(ltx); err != nil {
+		return nil, fmt.Errorf("transaction rejected: %v", err)
+	}
+
 	// Create transaction
-	tx := &mempool.Transaction{
-		ID:        fmt.Sprintf("tx_%d", time.Now().UnixNano()),
-		Data:      []byte(data),
-		Timestamp: time.Now(),
-		Fee:       1000, // Default fee
-		Size:      len(data),
+	tx, err := mempool.NewTransaction(ltx)
+	if err != nil {
+		return nil, err
 	}
 
 	// Add to mempool
@@ -370,9 +585,280 @@ func (s *Server) submitTransaction(data string) (map[string]interface{}, error)
 		return nil, err
 	}
 
-	return map[string]interface{}{
-		"txid":    tx.ID,
-		"status":  "accepted",
-		"message": "Transaction added to mempool",
+	return &submitTransactionResult{
+		TxID:    tx.ID,
+		Status:  "accepted",
+		Message: "Transaction added to mempool",
 	}, nil
 }
+
+// addressTransactionsResult is the result of
+// blockdag_getAddressTransactions
+type addressTransactionsResult struct {
+	Address      string         `json:"address"`
+	Transactions []*index.Entry `json:"transactions"`
+	NextCursor   string         `json:"next_cursor"`
+}
+
+func (s *Server) getAddressTransactions(address, cursor string, limit int) (*addressTransactionsResult, error) {
+	if s.addrIndex == nil {
+		return nil, fmt.Errorf("address index is disabled; start the node with -addrindex")
+	}
+
+	entries, nextCursor, err := s.addrIndex.GetAddressTransactions(address, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &addressTransactionsResult{
+		Address:      address,
+		Transactions: entries,
+		NextCursor:   nextCursor,
+	}, nil
+}
+
+// balanceResult is the result of blockdag_getBalance. The history totals
+// cover the transactions the state applied, so they agree with the
+// balance; they are left out when the address index is disabled.
+type balanceResult struct {
+	Address  string  `json:"address"`
+	Balance  uint64  `json:"balance"`
+	Nonce    uint64  `json:"nonce"`
+	Staked   uint64  `json:"staked"`
+	Received *uint64 `json:"received,omitempty"`
+	Sent     *uint64 `json:"sent,omitempty"`
+	Fees     *uint64 `json:"fees,omitempty"`
+	TxCount  *uint64 `json:"tx_count,omitempty"`
+}
+
+func (s *Server) getBalance(address string) (*balanceResult, error) {
+	account := s.state.GetAccount(address)
+	result := &balanceResult{
+		Address: address,
+		Balance: account.Balance,
+		Nonce:   account.Nonce,
+		Staked:  account.Staked,
+	}
+
+	// Add history totals when the address index is enabled
+	if s.addrIndex != nil {
+		activity, err := s.addrIndex.GetActivity(address)
+		if err != nil {
+			return nil, err
+		}
+		result.Received = &activity.Received
+		result.Sent = &activity.Sent
+		result.Fees = &activity.Fees
+		result.TxCount = &activity.TxCount
+	}
+
+	return result, nil
+}
+
+func (s *Server) getTxProof(txID, vertexID string) (*proof.TxProof, error) {
+	if vertexID == "" {
+		if s.addrIndex == nil {
+			return nil, fmt.Errorf("vertexId is required when the address index is disabled")
+		}
+
+		var err error
+		vertexID, err = s.addrIndex.GetTxVertex(txID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return proof.Build(s.dagStore, s.consensusEngine, vertexID, txID)
+}
+
+// mineResult is the result of blockdag_mine; error explains why fewer
+// vertices than requested were mined
+type mineResult struct {
+	Count    int      `json:"count"`
+	Vertices []string `json:"vertices"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (s *Server) mine(ctx context.Context, count int) (*mineResult, error) {
+	vertices, err := s.miner.Mine(ctx, count)
+	if err != nil && len(vertices) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, len(vertices))
+	for i, vertex := range vertices {
+		ids[i] = vertex.ID
+	}
+
+	result := &mineResult{
+		Count:    len(ids),
+		Vertices: ids,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+// miningStatsResult adds the node's own vertices by GHOSTDAG color to the
+// miner's statistics
+type miningStatsResult struct {
+	miner.Stats
+	BlueVertices    int `json:"blue_vertices"`
+	RedVertices     int `json:"red_vertices"`
+	PendingVertices int `json:"pending_vertices"`
+}
+
+func (s *Server) getMiningStats() (*miningStatsResult, error) {
+	blue, red, pending, err := s.miner.OwnVertexColors()
+	if err != nil {
+		return nil, err
+	}
+
+	return &miningStatsResult{
+		Stats:           s.miner.GetMiningStats(),
+		BlueVertices:    blue,
+		RedVertices:     red,
+		PendingVertices: pending,
+	}, nil
+}
+
+// startMiningResult is the result of blockdag_startMining
+type startMiningResult struct {
+	Success       bool   `json:"success"`
+	Message       string `json:"message"`
+	Threads       int    `json:"threads"`
+	MiningAddress string `json:"mining_address"`
+}
+
+func (s *Server) startMining(threads int, address string) (*startMiningResult, error) {
+	// Check everything that can fail before the address is changed
+	if threads < 0 || threads > miner.MaxThreads() {
+		return nil, fmt.Errorf("threads must be between 0 and %d", miner.MaxThreads())
+	}
+	if address != "" {
+		if err := ledger.ValidateAddress(address); err != nil {
+			return nil, err
+		}
+	}
+	if s.miner.IsMining() {
+		return nil, fmt.Errorf("miner is already running")
+	}
+
+	if address != "" {
+		if err := s.miner.SetMiningAddress(address); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.miner.Start(threads); err != nil {
+		return nil, err
+	}
+
+	stats := s.miner.GetMiningStats()
+	return &startMiningResult{
+		Success:       true,
+		Message:       "Mining started",
+		Threads:       stats.Threads,
+		MiningAddress: stats.MiningAddress,
+	}, nil
+}
+
+// stopMiningResult is the result of blockdag_stopMining
+type stopMiningResult struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+func (s *Server) stopMining() (*stopMiningResult, error) {
+	if !s.miner.Stop() {
+		return &stopMiningResult{
+			Success: false,
+			Message: "Miner is not running",
+		}, nil
+	}
+
+	return &stopMiningResult{
+		Success: true,
+		Message: "Mining stopped",
+	}, nil
+}
+
+// miningAddressResult is the result of blockdag_setMiningAddress
+type miningAddressResult struct {
+	Success       bool   `json:"success"`
+	MiningAddress string `json:"mining_address"`
+}
+
+func (s *Server) setMiningAddress(address string) (*miningAddressResult, error) {
+	if err := s.miner.SetMiningAddress(address); err != nil {
+		return nil, err
+	}
+
+	return &miningAddressResult{
+		Success:       true,
+		MiningAddress: address,
+	}, nil
+}
+
+func (s *Server) getBlockTemplate(ctx context.Context, payTo, longPollID string) (*miner.Work, error) {
+	// Long poll: hold the request until the caller's work goes stale
+	if longPollID != "" {
+		waitCtx, cancel := context.WithTimeout(ctx, longPollTimeout)
+		s.miner.WaitForStaleWork(waitCtx, longPollID)
+		cancel()
+	}
+
+	return s.miner.GetWork(payTo)
+}
+
+// submitBlockResult is the result of blockdag_submitBlock
+type submitBlockResult struct {
+	ID     string `json:"id"`
+	Hash   string `json:"hash"`
+	Status string `json:"status"`
+}
+
+func (s *Server) submitBlock(header *dag.Header) (*submitBlockResult, error) {
+	vertex, err := s.miner.SubmitWork(header)
+	if err != nil {
+		return nil, fmt.Errorf("block rejected: %v", err)
+	}
+
+	return &submitBlockResult{
+		ID:     vertex.ID,
+		Hash:   vertex.Hash,
+		Status: "accepted",
+	}, nil
+}
+
+func (s *Server) estimateFee(targetConfirmations int) (*mempool.FeeEstimate, error) {
+	return s.feeEstimator.EstimateFee(targetConfirmations), nil
+}
+
+func (s *Server) simulateTransaction(data string, fee uint64) (*ledger.Simulation, error) {
+	ltx, err := s.buildTransaction(data, fee)
+	if err != nil {
+		return &ledger.Simulation{
+			Reason:         err.Error(),
+			BalanceChanges: []ledger.BalanceChange{},
+			NonceChanges:   []ledger.NonceChange{},
+		}, nil
+	}
+
+	return s.state.Simulate(ltx), nil
+}
+
+// buildTransaction turns submitted data into a transaction. Structured
+// transactions are submitted as their JSON encoding; anything else is
+// carried as opaque data paying fee.
+func (s *Server) buildTransaction(data string, fee uint64) (*ledger.Transaction, error) {
+	if ledger.IsStructured([]byte(data)) {
+		return ledger.ParseTransaction([]byte(data))
+	}
+
+	if fee == 0 {
+		fee = DefaultDataFee
+	}
+	return ledger.NewDataTransaction([]byte(data), fee), nil
+}
@@ -0,0 +1,543 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/mempool"
+)
+
+// Subscription topics
+const (
+	topicNewVertex      = "newVertex"
+	topicNewTransaction = "newTransaction"
+	topicTipsChanged    = "tipsChanged"
+	topicChainChanged   = "chainChanged"
+	topicFinalized      = "finalized"
+	topicMiningStatus   = "miningStatus"
+)
+
+// topics lists the topics clients can subscribe to
+var topics = map[string]bool{
+	topicNewVertex:      true,
+	topicNewTransaction: true,
+	topicTipsChanged:    true,
+	topicChainChanged:   true,
+	topicFinalized:      true,
+	topicMiningStatus:   true,
+}
+
+// subscriberQueueSize bounds the messages waiting to be written to a
+// WebSocket client. A client that lets notifications pile up beyond it is
+// disconnected rather than slowing down the node.
+const subscriberQueueSize = 256
+
+// miningStatusInterval is how often miningStatus subscribers hear from a
+// running miner
+const miningStatusInterval = 10 * time.Second
+
+// subscription is one topic a WebSocket session listens to
+type subscription struct {
+	id      string
+	topic   string
+	session *wsSession
+}
+
+// hub delivers node events to WebSocket subscribers. Vertex and
+// transaction events go out as they happen; tips, the selected chain and
+// finality are compared against what subscribers last heard, so a burst
+// of vertices during sync yields a single update.
+type hub struct {
+	server *Server
+
+	mu            sync.Mutex
+	subscriptions map[string]*subscription
+	sessions      map[*wsSession]bool
+
+	chainDirty chan struct{} // signals that the DAG changed
+	quit       chan struct{}
+	stopOnce   sync.Once
+
+	// What chain subscribers last heard; nil while nobody listens
+	chainMu   sync.Mutex
+	tips      []string
+	chain     []string       // selected chain of the heaviest tip, genesis first
+	onChain   map[string]int // position of each chain vertex
+	finalized string
+}
+
+// newHub creates a hub fed by the server's DAG, mempool and miner
+func newHub(server *Server) *hub {
+	h := &hub{
+		server:        server,
+		subscriptions: make(map[string]*subscription),
+		sessions:      make(map[*wsSession]bool),
+		chainDirty:    make(chan struct{}, 1),
+		quit:          make(chan struct{}),
+	}
+
+	server.dagStore.OnVertexAdded(h.vertexAdded)
+	server.mempool.OnTransactionAdded(h.transactionAdded)
+	server.miner.OnStatusChanged(h.miningStatusChanged)
+	return h
+}
+
+// run publishes chain updates and periodic mining status until stopped
+func (h *hub) run() {
+	ticker := time.NewTicker(miningStatusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.chainDirty:
+			h.updateChain()
+		case <-ticker.C:
+			if h.server.miner.IsMining() {
+				h.publishMiningStatus()
+			}
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// stop ends the hub and disconnects every WebSocket client, which the
+// HTTP server's shutdown does not reach once connections are hijacked
+func (h *hub) stop() {
+	h.stopOnce.Do(func() {
+		close(h.quit)
+	})
+
+	h.mu.Lock()
+	sessions := make([]*wsSession, 0, len(h.sessions))
+	for session := range h.sessions {
+		sessions = append(sessions, session)
+	}
+	h.mu.Unlock()
+
+	for _, session := range sessions {
+		session.shutdown(wsCloseGoingAway, "server shutting down")
+	}
+}
+
+// subscribe adds a subscription for a session and returns its ID
+func (h *hub) subscribe(session *wsSession, topic string) (string, error) {
+	if !topics[topic] {
+		return "", invalidParams("unknown topic %q", topic)
+	}
+
+	var raw [8]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", err
+	}
+	id := "0x" + hex.EncodeToString(raw[:])
+
+	// Chain subscribers need a baseline to compare updates against; holding
+	// chainMu keeps an update from dropping it before the subscription counts
+	if isChainTopic(topic) {
+		h.chainMu.Lock()
+		defer h.chainMu.Unlock()
+
+		if h.onChain == nil {
+			h.onChain = make(map[string]int)
+			if _, _, err := h.followChain(); err != nil {
+				h.tips, h.chain, h.onChain = nil, nil, nil
+				return "", err
+			}
+		}
+	}
+
+	h.mu.Lock()
+	h.subscriptions[id] = &subscription{id: id, topic: topic, session: session}
+	h.mu.Unlock()
+	return id, nil
+}
+
+// unsubscribe removes a session's subscription, reporting whether it had
+// one with that ID
+func (h *hub) unsubscribe(session *wsSession, id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub, exists := h.subscriptions[id]
+	if !exists || sub.session != session {
+		return false
+	}
+	delete(h.subscriptions, id)
+	return true
+}
+
+// register tracks an open session
+func (h *hub) register(session *wsSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sessions[session] = true
+}
+
+// unregister forgets a closed session and its subscriptions
+func (h *hub) unregister(session *wsSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.sessions, session)
+	for id, sub := range h.subscriptions {
+		if sub.session == session {
+			delete(h.subscriptions, id)
+		}
+	}
+}
+
+// listening reports whether anyone subscribes to one of the topics
+func (h *hub) listening(topics ...string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, sub := range h.subscriptions {
+		for _, topic := range topics {
+			if sub.topic == topic {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publish sends result to every subscriber of topic
+func (h *hub) publish(topic string, result interface{}) {
+	h.mu.Lock()
+	subs := make([]*subscription, 0)
+	for _, sub := range h.subscriptions {
+		if sub.topic == topic {
+			subs = append(subs, sub)
+		}
+	}
+	h.mu.Unlock()
+	if len(subs) == 0 {
+		return
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Failed to encode %s notification: %v", topic, err)
+		return
+	}
+	for _, sub := range subs {
+		sub.session.notify(sub.id, encoded)
+	}
+}
+
+// vertexAdded publishes a new vertex and schedules a chain update
+func (h *hub) vertexAdded(vertex *dag.Vertex) {
+	if h.listening(topicNewVertex) {
+		h.publish(topicNewVertex, map[string]interface{}{
+			"id":           vertex.ID,
+			"hash":         vertex.Hash,
+			"payload_root": vertex.PayloadRoot,
+			"coinbase":     vertex.Coinbase,
+			"parents":      vertex.Parents,
+			"timestamp":    vertex.Timestamp.Unix(),
+			"nonce":        vertex.Nonce,
+			"weight":       vertex.Weight,
+		})
+	}
+
+	select {
+	case h.chainDirty <- struct{}{}:
+	default:
+	}
+}
+
+// transactionAdded publishes a transaction entering the mempool
+func (h *hub) transactionAdded(tx *mempool.Transaction) {
+	h.publish(topicNewTransaction, newMempoolTransaction(tx))
+}
+
+// miningStatusChanged publishes the miner starting or stopping
+func (h *hub) miningStatusChanged(mining bool) {
+	h.publishMiningStatus()
+}
+
+// publishMiningStatus sends the mining statistics to subscribers
+func (h *hub) publishMiningStatus() {
+	if !h.listening(topicMiningStatus) {
+		return
+	}
+
+	stats, err := h.server.getMiningStats()
+	if err != nil {
+		log.Printf("Failed to read mining status: %v", err)
+		return
+	}
+	h.publish(topicMiningStatus, stats)
+}
+
+// isChainTopic reports whether a topic is derived from the DAG's shape
+func isChainTopic(topic string) bool {
+	return topic == topicTipsChanged || topic == topicChainChanged || topic == topicFinalized
+}
+
+// updateChain publishes whatever changed in the tips, selected chain and
+// finality since the last update
+func (h *hub) updateChain() {
+	h.chainMu.Lock()
+	defer h.chainMu.Unlock()
+
+	if !h.listening(topicTipsChanged, topicChainChanged, topicFinalized) {
+		h.tips, h.chain, h.onChain, h.finalized = nil, nil, nil, ""
+		return
+	}
+	if h.onChain == nil {
+		h.onChain = make(map[string]int)
+	}
+
+	tips, finalized := h.tips, h.finalized
+	removed, added, err := h.followChain()
+	if err != nil {
+		log.Printf("Failed to follow the selected chain: %v", err)
+		return
+	}
+
+	if !equalStrings(tips, h.tips) {
+		h.publish(topicTipsChanged, map[string]interface{}{
+			"tips": h.tips,
+		})
+	}
+
+	if len(removed) > 0 || len(added) > 0 {
+		h.publish(topicChainChanged, map[string]interface{}{
+			"selected_tip": h.chain[len(h.chain)-1],
+			"removed":      removed,
+			"added":        added,
+		})
+	}
+
+	if h.finalized != finalized && h.finalized != "" {
+		if vertex, err := h.server.dagStore.GetVertex(h.finalized); err == nil {
+			h.publish(topicFinalized, map[string]interface{}{
+				"id":        vertex.ID,
+				"hash":      vertex.Hash,
+				"timestamp": vertex.Timestamp.Unix(),
+			})
+		}
+	}
+}
+
+// followChain records the current tips and moves the recorded selected
+// chain to the heaviest tip. Only the new tip's selected ancestors down to
+// the recorded chain are read, so the work follows the size of the change.
+// It returns the vertices that left and joined the chain, in chain order;
+// the caller holds h.chainMu.
+func (h *hub) followChain() (removed, added []string, err error) {
+	tips := h.server.dagStore.GetTips()
+	sort.Strings(tips)
+	h.tips = tips
+	if len(tips) == 0 {
+		return nil, nil, nil
+	}
+
+	sorted, err := h.server.consensusEngine.SortByBlueWork(tips)
+	if err != nil {
+		return nil, nil, err
+	}
+	head := sorted[0]
+	if len(h.chain) > 0 && h.chain[len(h.chain)-1] == head {
+		return nil, nil, nil
+	}
+
+	// Walk back to the recorded chain, or to genesis
+	fork := -1
+	for id := head; id != ""; {
+		if position, exists := h.onChain[id]; exists {
+			fork = position
+			break
+		}
+		added = append(added, id)
+
+		data, err := h.server.consensusEngine.GetGhostdagData(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		id = data.SelectedParent
+	}
+	for i, j := 0, len(added)-1; i < j; i, j = i+1, j-1 {
+		added[i], added[j] = added[j], added[i]
+	}
+
+	removed = append(make([]string, 0), h.chain[fork+1:]...)
+	for _, id := range removed {
+		delete(h.onChain, id)
+	}
+	h.chain = h.chain[:fork+1]
+	for _, id := range added {
+		h.onChain[id] = len(h.chain)
+		h.chain = append(h.chain, id)
+	}
+
+	// The latest finalized vertex is FinalityDepth below the tip
+	h.finalized = ""
+	if len(h.chain) > consensus.FinalityDepth {
+		h.finalized = h.chain[len(h.chain)-consensus.FinalityDepth-1]
+	}
+	return removed, added, nil
+}
+
+// equalStrings reports whether two string slices hold the same values
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// wsSession is a WebSocket client speaking JSON-RPC. Responses and
+// notifications share one bounded queue drained by a writer goroutine, so
+// they arrive in order; the reader waits when the queue is full, while a
+// notification that does not fit disconnects the client.
+type wsSession struct {
+	server *Server
+	conn   *wsConn
+	queue  chan []byte
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	closeOnce sync.Once
+}
+
+// sessionKey finds the WebSocket session of a call in its context
+type sessionKey struct{}
+
+// sessionFrom returns the WebSocket session a call came in on, nil over
+// HTTP
+func sessionFrom(ctx context.Context) *wsSession {
+	session, _ := ctx.Value(sessionKey{}).(*wsSession)
+	return session
+}
+
+// handleWebSocket serves JSON-RPC, including subscriptions, over a
+// WebSocket connection
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.originAllowed(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		log.Printf("WebSocket upgrade from %s refused: origin %q not allowed", r.RemoteAddr, r.Header.Get("Origin"))
+		return
+	}
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		log.Printf("WebSocket upgrade from %s failed: %v", r.RemoteAddr, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &wsSession{
+		server: s,
+		conn:   conn,
+		queue:  make(chan []byte, subscriberQueueSize),
+		cancel: cancel,
+	}
+	session.ctx = context.WithValue(ctx, sessionKey{}, session)
+	s.hub.register(session)
+	defer s.hub.unregister(session)
+
+	go session.writeLoop()
+	session.readLoop()
+}
+
+// readLoop answers requests until the connection ends
+func (ws *wsSession) readLoop() {
+	for {
+		message, err := ws.conn.readMessage()
+		if err != nil {
+			if closeErr, ok := err.(*wsCloseError); ok {
+				ws.shutdown(closeErr.code, closeErr.reason)
+			} else {
+				ws.shutdown(wsCloseGoingAway, "")
+			}
+			return
+		}
+
+		if response := handleMessage(ws.ctx, message, ws.server.call); response != nil {
+			ws.respond(response)
+		}
+	}
+}
+
+// respond queues a response, waiting for room
+func (ws *wsSession) respond(response []byte) {
+	select {
+	case ws.queue <- response:
+	case <-ws.ctx.Done():
+	}
+}
+
+// notify queues a notification, disconnecting a client that has fallen
+// too far behind
+func (ws *wsSession) notify(id string, result json.RawMessage) {
+	encoded, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "blockdag_subscription",
+		"params": map[string]interface{}{
+			"subscription": id,
+			"result":       result,
+		},
+	})
+	if err != nil {
+		return
+	}
+
+	select {
+	case ws.queue <- encoded:
+	case <-ws.ctx.Done():
+	default:
+		// Cancel now so later notifications stop here; closing may block on
+		// the write deadline, which must not hold up the publisher
+		log.Printf("Disconnecting WebSocket client %s: notification queue full", ws.conn.conn.RemoteAddr())
+		ws.cancel()
+		go ws.shutdown(wsClosePolicy, "notification queue full")
+	}
+}
+
+// writeLoop writes queued messages and keeps the connection alive
+func (ws *wsSession) writeLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message := <-ws.queue:
+			if err := ws.conn.writeFrame(wsOpText, message); err != nil {
+				ws.shutdown(wsCloseGoingAway, "")
+				return
+			}
+		case <-ticker.C:
+			if err := ws.conn.writeFrame(wsOpPing, nil); err != nil {
+				ws.shutdown(wsCloseGoingAway, "")
+				return
+			}
+		case <-ws.ctx.Done():
+			return
+		}
+	}
+}
+
+// shutdown closes the session once, cancelling its pending calls
+func (ws *wsSession) shutdown(code int, reason string) {
+	ws.closeOnce.Do(func() {
+		ws.cancel()
+		ws.conn.close(code, reason)
+	})
+}
@@ -0,0 +1,122 @@
+package rpc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/storage"
+)
+
+// newChainHub returns a hub over a DevNet DAG holding only genesis, and a
+// function that adds a chain of n vertices named prefix1..prefixN on parent
+func newChainHub(t *testing.T) (*hub, func(prefix, parent string, n int) string) {
+	t.Helper()
+	params := &chaincfg.DevNetParams
+	store := dag.NewStore(storage.NewMemoryDB())
+	if err := store.AddVertex(params.Genesis()); err != nil {
+		t.Fatalf("adding genesis: %v", err)
+	}
+	h := &hub{
+		server:  &Server{dagStore: store, consensusEngine: consensus.NewEngine(store, params)},
+		onChain: make(map[string]int),
+	}
+
+	count := 0
+	extend := func(prefix, parent string, n int) string {
+		for i := 1; i <= n; i++ {
+			count++
+			vertex := &dag.Vertex{
+				ID:        fmt.Sprintf("%s%d", prefix, i),
+				Data:      ledger.EncodePayload(nil),
+				Parents:   []string{parent},
+				Timestamp: params.GenesisTime.Add(time.Duration(count) * time.Second),
+				Weight:    params.VertexWeight(),
+			}
+			vertex.PayloadRoot, _ = ledger.PayloadRoot(vertex.Data)
+			vertex.Hash = vertex.CalculateHash()
+			if err := store.AddVertex(vertex); err != nil {
+				t.Fatalf("adding %s: %v", vertex.ID, err)
+			}
+			parent = vertex.ID
+		}
+		return parent
+	}
+	return h, extend
+}
+
+// checkFollowed compares what the hub recorded with the engine's view
+func checkFollowed(t *testing.T, h *hub) {
+	t.Helper()
+	path, err := h.server.consensusEngine.GetHeaviestPath()
+	if err != nil {
+		t.Fatalf("GetHeaviestPath: %v", err)
+	}
+	ids := make([]string, len(path))
+	for i, vertex := range path {
+		ids[i] = vertex.ID
+	}
+	if !equalStrings(ids, h.chain) {
+		t.Errorf("chain %v, want the heaviest path %v", h.chain, ids)
+	}
+
+	finalized := ""
+	if latest, err := h.server.consensusEngine.GetLatestFinalized(); err != nil {
+		t.Fatalf("GetLatestFinalized: %v", err)
+	} else if latest != nil {
+		finalized = latest.ID
+	}
+	if h.finalized != finalized {
+		t.Errorf("finalized %q, want %q", h.finalized, finalized)
+	}
+}
+
+func TestFollowChain(t *testing.T) {
+	h, extend := newChainHub(t)
+	genesis := chaincfg.DevNetParams.Genesis().ID
+
+	if _, _, err := h.followChain(); err != nil {
+		t.Fatalf("followChain: %v", err)
+	}
+	checkFollowed(t, h)
+
+	tipA := extend("a", genesis, 12)
+	removed, added, err := h.followChain()
+	if err != nil {
+		t.Fatalf("followChain: %v", err)
+	}
+	if len(removed) != 0 || len(added) != 12 || added[0] != "a1" || added[11] != tipA {
+		t.Errorf("extension removed %v and added %v", removed, added)
+	}
+	checkFollowed(t, h)
+
+	// No change reports nothing
+	if removed, added, err := h.followChain(); err != nil || len(removed) != 0 || len(added) != 0 {
+		t.Errorf("unchanged DAG reported removed %v, added %v, %v", removed, added, err)
+	}
+
+	// A heavier branch from a5 replaces a6..a12
+	extend("b", "a5", 9)
+	removed, added, err = h.followChain()
+	if err != nil {
+		t.Fatalf("followChain: %v", err)
+	}
+	if len(removed) != 7 || removed[0] != "a6" || removed[6] != tipA {
+		t.Errorf("reorg removed %v, want a6..a12", removed)
+	}
+	if len(added) != 9 || added[0] != "b1" || added[8] != "b9" {
+		t.Errorf("reorg added %v, want b1..b9", added)
+	}
+	checkFollowed(t, h)
+
+	// And back again
+	extend("c", tipA, 3)
+	if _, _, err := h.followChain(); err != nil {
+		t.Fatalf("followChain: %v", err)
+	}
+	checkFollowed(t, h)
+}
@@ -0,0 +1,329 @@
+package rpc
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// websocketGUID is appended to the client key to prove the handshake was
+// understood (RFC 6455, section 1.3)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket limits and timeouts
+const (
+	wsMaxMessageSize = maxRequestSize   // largest request a client may send
+	wsWriteTimeout   = 10 * time.Second // for writing a single frame
+	wsPingInterval   = 30 * time.Second
+	wsReadTimeout    = 2 * wsPingInterval // a client must answer pings in time
+)
+
+// WebSocket frame opcodes
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// WebSocket close codes
+const (
+	wsCloseNormal        = 1000
+	wsCloseGoingAway     = 1001
+	wsCloseProtocolError = 1002
+	wsCloseUnsupported   = 1003
+	wsCloseNoStatus      = 1005 // never sent: stands for a close frame without a code
+	wsCloseInvalidData   = 1007
+	wsClosePolicy        = 1008
+	wsCloseTooBig        = 1009
+)
+
+// wsMaxCloseReason is the longest reason that fits a close frame next to
+// its code
+const wsMaxCloseReason = 123
+
+// wsCloseError ends a connection with a close code
+type wsCloseError struct {
+	code   int
+	reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return fmt.Sprintf("websocket closed (%d): %s", e.code, e.reason)
+}
+
+// wsConn is the server end of a WebSocket connection
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+	closed  bool // a close frame has been sent
+}
+
+// upgradeWebSocket completes the opening handshake, answering the request
+// with an HTTP error if it is not a valid WebSocket upgrade
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("websocket upgrade with method %s", r.Method)
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("not a websocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("unsupported websocket version %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("invalid websocket key %q", key)
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("connection cannot be hijacked")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(accept[:]) + "\r\n\r\n"
+
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, reader: buffered.Reader}, nil
+}
+
+// headerHasToken reports whether a comma-separated header lists token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readMessage returns the next text message, reassembling fragments and
+// answering control frames on the way. A close from the client or a
+// protocol violation ends the connection with a *wsCloseError.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	started := false
+
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			return nil, parseClose(payload)
+		case wsOpText, wsOpBinary:
+			if started {
+				return nil, &wsCloseError{wsCloseProtocolError, "expected a continuation frame"}
+			}
+			if opcode == wsOpBinary {
+				return nil, &wsCloseError{wsCloseUnsupported, "only text messages are supported"}
+			}
+			started = true
+		case wsOpContinuation:
+			if !started {
+				return nil, &wsCloseError{wsCloseProtocolError, "continuation without a message"}
+			}
+		default:
+			return nil, &wsCloseError{wsCloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode)}
+		}
+
+		if len(message)+len(payload) > wsMaxMessageSize {
+			return nil, &wsCloseError{wsCloseTooBig, "message too large"}
+		}
+		message = append(message, payload...)
+		if fin {
+			if !utf8.Valid(message) {
+				return nil, &wsCloseError{wsCloseInvalidData, "text message is not valid UTF-8"}
+			}
+			return message, nil
+		}
+	}
+}
+
+// parseClose reads the code and reason of a close frame from the client.
+// A malformed close frame is answered as a protocol error.
+func parseClose(payload []byte) *wsCloseError {
+	if len(payload) == 0 {
+		return &wsCloseError{wsCloseNoStatus, ""}
+	}
+	if len(payload) == 1 {
+		return &wsCloseError{wsCloseProtocolError, "close frame with a truncated code"}
+	}
+
+	code, reason := int(binary.BigEndian.Uint16(payload)), payload[2:]
+	if !validCloseCode(code) {
+		return &wsCloseError{wsCloseProtocolError, fmt.Sprintf("invalid close code %d", code)}
+	}
+	if !utf8.Valid(reason) {
+		return &wsCloseError{wsCloseInvalidData, "close reason is not valid UTF-8"}
+	}
+	return &wsCloseError{code, string(reason)}
+}
+
+// validCloseCode reports whether a close code may be sent in a close
+// frame: the defined codes other than the reserved 1004 to 1006 and 1015,
+// and those registered for libraries and applications
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1014:
+		return true
+	default:
+		return code >= 3000 && code <= 4999
+	}
+}
+
+// readFrame reads and unmasks a single frame
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &wsCloseError{wsCloseProtocolError, "reserved bits set"}
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, &wsCloseError{wsCloseProtocolError, "client frames must be masked"}
+	}
+
+	length := uint64(header[1] & 0x7F)
+	control := opcode&0x8 != 0
+	if control && (!fin || length > 125) {
+		return false, 0, nil, &wsCloseError{wsCloseProtocolError, "invalid control frame"}
+	}
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > wsMaxMessageSize {
+		return false, 0, nil, &wsCloseError{wsCloseTooBig, "message too large"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends one unfragmented, unmasked frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	if opcode == wsOpClose {
+		c.closed = true
+	}
+	return nil
+}
+
+// close sends a close frame, unless one was sent already, and drops the
+// connection. A code that may not be sent, such as 1005 for a client that
+// closed without one, is answered with an empty close frame.
+func (c *wsConn) close(code int, reason string) {
+	c.writeFrame(wsOpClose, closePayload(code, reason))
+	c.conn.Close()
+}
+
+// closePayload encodes a close code and reason, cutting the reason to fit
+// on a UTF-8 boundary
+func closePayload(code int, reason string) []byte {
+	if !validCloseCode(code) {
+		return nil
+	}
+	if len(reason) > wsMaxCloseReason {
+		end := wsMaxCloseReason
+		for end > 0 && !utf8.RuneStart(reason[end]) {
+			end--
+		}
+		reason = reason[:end]
+	}
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
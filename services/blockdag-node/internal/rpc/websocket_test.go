@@ -0,0 +1,156 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// clientFrame builds a masked frame as a client sends it
+func clientFrame(fin bool, opcode byte, payload []byte) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(length))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 0x80|127), uint64(length))
+	}
+
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// closeFrame encodes a close payload as a client sends it
+func closeFrame(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		frames  [][]byte
+		message string
+		code    int // expected close code when no message is read
+		reason  string
+	}{
+		{"text", [][]byte{clientFrame(true, wsOpText, []byte("héllo"))}, "héllo", 0, ""},
+		{"fragmented text", [][]byte{
+			clientFrame(false, wsOpText, []byte{'h', 0xc3}),
+			clientFrame(true, wsOpContinuation, []byte{0xa9, 'y'}),
+		}, "héy", 0, ""},
+		{"invalid UTF-8", [][]byte{clientFrame(true, wsOpText, []byte{'a', 0xff})}, "", wsCloseInvalidData, ""},
+		{"truncated UTF-8", [][]byte{clientFrame(true, wsOpText, []byte{'a', 0xc3})}, "", wsCloseInvalidData, ""},
+		{"binary", [][]byte{clientFrame(true, wsOpBinary, []byte{1})}, "", wsCloseUnsupported, ""},
+		{"close without a code", [][]byte{clientFrame(true, wsOpClose, nil)}, "", wsCloseNoStatus, ""},
+		{"close with a code", [][]byte{clientFrame(true, wsOpClose, closeFrame(wsCloseNormal, "bye"))}, "", wsCloseNormal, "bye"},
+		{"close with an application code", [][]byte{clientFrame(true, wsOpClose, closeFrame(4000, ""))}, "", 4000, ""},
+		{"close with one byte", [][]byte{clientFrame(true, wsOpClose, []byte{3})}, "", wsCloseProtocolError, ""},
+		{"close with 1005", [][]byte{clientFrame(true, wsOpClose, closeFrame(wsCloseNoStatus, ""))}, "", wsCloseProtocolError, ""},
+		{"close with 1006", [][]byte{clientFrame(true, wsOpClose, closeFrame(1006, ""))}, "", wsCloseProtocolError, ""},
+		{"close with an unassigned code", [][]byte{clientFrame(true, wsOpClose, closeFrame(2000, ""))}, "", wsCloseProtocolError, ""},
+		{"close with an invalid reason", [][]byte{clientFrame(true, wsOpClose, closeFrame(wsCloseNormal, "\xff"))}, "", wsCloseInvalidData, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+			go func() {
+				for _, frame := range tt.frames {
+					client.Write(frame)
+				}
+			}()
+
+			conn := &wsConn{conn: server, reader: bufio.NewReader(server)}
+			message, err := conn.readMessage()
+			if tt.code == 0 {
+				if err != nil || string(message) != tt.message {
+					t.Fatalf("got %q, %v; want %q", message, err, tt.message)
+				}
+				return
+			}
+
+			closeErr, ok := err.(*wsCloseError)
+			if !ok {
+				t.Fatalf("got %q, %v; want close code %d", message, err, tt.code)
+			}
+			if closeErr.code != tt.code {
+				t.Errorf("close code %d, want %d", closeErr.code, tt.code)
+			}
+			if tt.reason != "" && closeErr.reason != tt.reason {
+				t.Errorf("close reason %q, want %q", closeErr.reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestClosePayload(t *testing.T) {
+	long := strings.Repeat("x", wsMaxCloseReason-1) + "é" // the last rune straddles the limit
+
+	tests := []struct {
+		name   string
+		code   int
+		reason string
+		want   []byte
+	}{
+		{"code and reason", wsCloseGoingAway, "server shutting down", closeFrame(wsCloseGoingAway, "server shutting down")},
+		{"no status", wsCloseNoStatus, "ignored", nil},
+		{"abnormal closure", 1006, "ignored", nil},
+		{"reserved", 1004, "", nil},
+		{"reason cut on a rune boundary", wsClosePolicy, long, closeFrame(wsClosePolicy, long[:wsMaxCloseReason-1])},
+		{"reason at the limit", wsCloseNormal, strings.Repeat("y", wsMaxCloseReason), closeFrame(wsCloseNormal, strings.Repeat("y", wsMaxCloseReason))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := closePayload(tt.code, tt.reason)
+			if string(got) != string(tt.want) {
+				t.Errorf("payload %q, want %q", got, tt.want)
+			}
+			if len(got) > 125 {
+				t.Errorf("payload of %d bytes does not fit a control frame", len(got))
+			}
+			if len(got) > 2 && !utf8.Valid(got[2:]) {
+				t.Errorf("reason %q is not valid UTF-8", got[2:])
+			}
+		})
+	}
+}
+
+func TestCloseWithoutStatusSendsEmptyFrame(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := &wsConn{conn: server, reader: bufio.NewReader(server)}
+
+	frames := make(chan []byte, 1)
+	go func() {
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		frame := make([]byte, 2)
+		if _, err := client.Read(frame); err != nil {
+			frames <- nil
+			return
+		}
+		payload := make([]byte, frame[1])
+		client.Read(payload)
+		frames <- append(frame, payload...)
+	}()
+
+	conn.close(wsCloseNoStatus, "reason")
+	frame := <-frames
+	if len(frame) != 2 || frame[0] != 0x80|wsOpClose || frame[1] != 0 {
+		t.Errorf("close for a client that sent no code was % x, want an empty close frame", frame)
+	}
+}
@@ -0,0 +1,87 @@
+package simnet
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the virtual time of a simulated network. It only moves when
+// the harness advances it, so when a message is delivered, and the time
+// the nodes read, do not depend on how fast the host runs.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	changed chan struct{} // closed and replaced whenever time moves
+	timers  []timer       // pending After calls
+}
+
+// timer is an After call waiting for the clock to reach at
+type timer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewClock creates a clock reading start
+func NewClock(start time.Time) *Clock {
+	return &Clock{
+		now:     start,
+		changed: make(chan struct{}),
+	}
+}
+
+// Now returns the virtual time
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d <= 0 {
+		return
+	}
+	c.now = c.now.Add(d)
+	close(c.changed)
+	c.changed = make(chan struct{})
+
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// After returns a channel that receives once the clock has moved d
+// forward
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, timer{at: c.now.Add(d), c: ch})
+	return ch
+}
+
+// AdvanceTo moves the clock forward to t; it never goes back
+func (c *Clock) AdvanceTo(t time.Time) {
+	c.Advance(t.Sub(c.Now()))
+}
+
+// Changed returns a channel that is closed the next time the clock moves
+func (c *Clock) Changed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
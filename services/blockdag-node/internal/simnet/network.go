@@ -0,0 +1,462 @@
+package simnet
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"hackodisha/blockdag-node/internal/p2p"
+)
+
+// Network is an in-memory transport between simulated nodes. Bytes written
+// to a connection reach the other end once the virtual clock has passed
+// the link's latency. Partitions cut the links between groups of hosts and
+// refuse new connections across them until healed.
+type Network struct {
+	clock *Clock
+
+	mu        sync.Mutex
+	latency   time.Duration               // links without their own latency
+	links     map[[2]string]time.Duration // latency by sorted host pair
+	groups    map[string]int              // partition group by host; nil when whole
+	listeners map[string]*listener        // by address
+	conns     map[*conn]bool              // open connections, one entry per end
+	nextPort  int
+}
+
+// NewNetwork creates a network whose links delay traffic by latency
+func NewNetwork(clock *Clock, latency time.Duration) *Network {
+	return &Network{
+		clock:     clock,
+		latency:   latency,
+		links:     make(map[[2]string]time.Duration),
+		listeners: make(map[string]*listener),
+		conns:     make(map[*conn]bool),
+		nextPort:  49152,
+	}
+}
+
+// Transport returns the transport a node on host uses
+func (n *Network) Transport(host string) p2p.Transport {
+	return &transport{network: n, host: host}
+}
+
+// SetLatency sets the latency of the link between two hosts
+func (n *Network) SetLatency(a, b string, latency time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.links[linkKey(a, b)] = latency
+}
+
+// Partition splits the hosts into groups that cannot reach each other,
+// breaking the connections between them. Hosts in no group are cut off
+// from everyone.
+func (n *Network) Partition(groups ...[]string) {
+	n.mu.Lock()
+	n.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, host := range group {
+			n.groups[host] = i + 1
+		}
+	}
+
+	broken := make([]*conn, 0)
+	for c := range n.conns {
+		if !n.reachable(c.local.host, c.remote.host) {
+			broken = append(broken, c)
+		}
+	}
+	n.mu.Unlock()
+
+	for _, c := range broken {
+		c.reset()
+	}
+}
+
+// Heal lets every host reach every other again
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.groups = nil
+}
+
+// Pending returns the time the earliest undelivered or unread bytes
+// arrive, reporting false if no bytes are in flight
+func (n *Network) Pending() (time.Time, bool) {
+	n.mu.Lock()
+	conns := make([]*conn, 0, len(n.conns))
+	for c := range n.conns {
+		conns = append(conns, c)
+	}
+	n.mu.Unlock()
+
+	var earliest time.Time
+	found := false
+	for _, c := range conns {
+		if at, ok := c.in.earliest(); ok && (!found || at.Before(earliest)) {
+			earliest, found = at, true
+		}
+	}
+	return earliest, found
+}
+
+// reachable reports whether two hosts are on the same side of the
+// partition; the caller holds n.mu
+func (n *Network) reachable(a, b string) bool {
+	if n.groups == nil {
+		return true
+	}
+	group := n.groups[a]
+	return group != 0 && group == n.groups[b]
+}
+
+// linkLatency returns the latency between two hosts
+func (n *Network) linkLatency(a, b string) time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if latency, exists := n.links[linkKey(a, b)]; exists {
+		return latency
+	}
+	return n.latency
+}
+
+// dial connects host to the listener at address
+func (n *Network) dial(host, address string) (net.Conn, error) {
+	remoteHost, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	l := n.listeners[address]
+	if l == nil {
+		n.mu.Unlock()
+		return nil, fmt.Errorf("dial %s: connection refused", address)
+	}
+	if !n.reachable(host, remoteHost) {
+		n.mu.Unlock()
+		return nil, fmt.Errorf("dial %s: network is unreachable", address)
+	}
+	local := simAddr{host: host, port: n.nextPort}
+	n.nextPort++
+
+	toServer, toClient := newPipe(), newPipe()
+	client := &conn{network: n, local: local, remote: l.addr, in: toClient, out: toServer}
+	server := &conn{network: n, local: l.addr, remote: local, in: toServer, out: toClient}
+	client.peer, server.peer = server, client
+	n.conns[client] = true
+	n.conns[server] = true
+	n.mu.Unlock()
+
+	select {
+	case l.accept <- server:
+		return client, nil
+	case <-l.closed:
+		client.reset()
+		return nil, fmt.Errorf("dial %s: connection refused", address)
+	}
+}
+
+// forget drops a closed connection end
+func (n *Network) forget(c *conn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.conns, c)
+}
+
+// linkKey orders a host pair so both directions share a latency
+func linkKey(a, b string) [2]string {
+	if b < a {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// transport is one host's view of the network
+type transport struct {
+	network *Network
+	host    string
+}
+
+// Listen accepts connections on address, whose host must be the
+// transport's
+func (t *transport) Listen(address string) (net.Listener, error) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || host != t.host {
+		return nil, fmt.Errorf("cannot listen on %s from host %s", address, t.host)
+	}
+
+	t.network.mu.Lock()
+	defer t.network.mu.Unlock()
+
+	if t.network.listeners[address] != nil {
+		return nil, fmt.Errorf("listen %s: address already in use", address)
+	}
+	l := &listener{
+		network: t.network,
+		addr:    simAddr{host: host, port: port},
+		accept:  make(chan *conn),
+		closed:  make(chan struct{}),
+	}
+	t.network.listeners[address] = l
+	return l, nil
+}
+
+// Dial connects to address; the timeout does not apply as connecting is
+// immediate
+func (t *transport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	return t.network.dial(t.host, address)
+}
+
+// listener accepts simulated connections
+type listener struct {
+	network   *Network
+	addr      simAddr
+	accept    chan *conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept waits for the next connection
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting connections
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.network.mu.Lock()
+		delete(l.network.listeners, l.addr.String())
+		l.network.mu.Unlock()
+	})
+	return nil
+}
+
+// Addr returns the listening address
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
+
+// simAddr is a host and port on the simulated network
+type simAddr struct {
+	host string
+	port int
+}
+
+// Network names the address family
+func (a simAddr) Network() string {
+	return "simnet"
+}
+
+// String formats the address as host:port
+func (a simAddr) String() string {
+	return net.JoinHostPort(a.host, strconv.Itoa(a.port))
+}
+
+// chunk is one write, due at a virtual time
+type chunk struct {
+	data []byte
+	at   time.Time
+}
+
+// pipe carries one direction of a connection
+type pipe struct {
+	mu     sync.Mutex
+	chunks []chunk
+	eof    bool          // the writer closed; reads end once chunks drain
+	broken bool          // the link was cut; pending bytes are lost
+	notify chan struct{} // closed and replaced on every change
+}
+
+// newPipe creates an empty pipe
+func newPipe() *pipe {
+	return &pipe{notify: make(chan struct{})}
+}
+
+// signal wakes readers; the caller holds p.mu
+func (p *pipe) signal() {
+	close(p.notify)
+	p.notify = make(chan struct{})
+}
+
+// earliest returns when the first pending bytes arrive
+func (p *pipe) earliest() (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.broken || len(p.chunks) == 0 {
+		return time.Time{}, false
+	}
+	return p.chunks[0].at, true
+}
+
+// conn is one end of a simulated connection
+type conn struct {
+	network *Network
+	local   simAddr
+	remote  simAddr
+	peer    *conn
+	in      *pipe // read by this end
+	out     *pipe // written by this end
+
+	mu           sync.Mutex
+	closed       bool
+	readDeadline time.Time // virtual, like the timeouts of the node
+}
+
+// Read returns bytes that have arrived by the virtual time, waiting for
+// more as long as the connection is open
+func (c *conn) Read(b []byte) (int, error) {
+	clock := c.network.clock
+	for {
+		c.mu.Lock()
+		closed, deadline := c.closed, c.readDeadline
+		c.mu.Unlock()
+		if closed {
+			return 0, net.ErrClosed
+		}
+
+		now := clock.Now()
+		clockChanged := clock.Changed()
+
+		c.in.mu.Lock()
+		switch {
+		case c.in.broken:
+			c.in.mu.Unlock()
+			return 0, fmt.Errorf("read %s: connection reset by peer", c.local)
+		case len(c.in.chunks) > 0 && !c.in.chunks[0].at.After(now):
+			first := &c.in.chunks[0]
+			n := copy(b, first.data)
+			if first.data = first.data[n:]; len(first.data) == 0 {
+				c.in.chunks = c.in.chunks[1:]
+			}
+			c.in.mu.Unlock()
+			return n, nil
+		case len(c.in.chunks) == 0 && c.in.eof:
+			c.in.mu.Unlock()
+			return 0, io.EOF
+		}
+		pipeChanged := c.in.notify
+		c.in.mu.Unlock()
+
+		if !deadline.IsZero() && !now.Before(deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		select {
+		case <-clockChanged:
+		case <-pipeChanged:
+		}
+	}
+}
+
+// Write sends b, to arrive after the link latency. Writes never block;
+// bytes stay in order even if the latency changes.
+func (c *conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return 0, net.ErrClosed
+	}
+
+	at := c.network.clock.Now().Add(c.network.linkLatency(c.local.host, c.remote.host))
+
+	c.out.mu.Lock()
+	defer c.out.mu.Unlock()
+
+	if c.out.broken {
+		return 0, fmt.Errorf("write %s: connection reset by peer", c.local)
+	}
+	if c.out.eof {
+		return 0, fmt.Errorf("write %s: broken pipe", c.local)
+	}
+	if last := len(c.out.chunks) - 1; last >= 0 && c.out.chunks[last].at.After(at) {
+		at = c.out.chunks[last].at
+	}
+	c.out.chunks = append(c.out.chunks, chunk{data: append([]byte{}, b...), at: at})
+	c.out.signal()
+	return len(b), nil
+}
+
+// Close closes this end; the other end reads what was already sent, then
+// EOF
+func (c *conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.out.mu.Lock()
+	c.out.eof = true
+	c.out.signal()
+	c.out.mu.Unlock()
+
+	c.in.mu.Lock()
+	c.in.chunks = nil
+	c.in.signal()
+	c.in.mu.Unlock()
+
+	c.network.forget(c)
+	return nil
+}
+
+// reset cuts both directions, losing anything in flight
+func (c *conn) reset() {
+	for _, p := range []*pipe{c.in, c.out} {
+		p.mu.Lock()
+		p.broken = true
+		p.chunks = nil
+		p.signal()
+		p.mu.Unlock()
+	}
+	c.network.forget(c)
+	c.network.forget(c.peer)
+}
+
+// LocalAddr returns this end's address
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr returns the other end's address
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// SetDeadline sets the read deadline; writes never block
+func (c *conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the virtual time reads give up at
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline does nothing, as writes never block
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,321 @@
+package simnet
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"hackodisha/blockdag-node/internal/chaincfg"
+	"hackodisha/blockdag-node/internal/consensus"
+	"hackodisha/blockdag-node/internal/dag"
+	"hackodisha/blockdag-node/internal/ledger"
+	"hackodisha/blockdag-node/internal/mempool"
+	"hackodisha/blockdag-node/internal/miner"
+	"hackodisha/blockdag-node/internal/p2p"
+	"hackodisha/blockdag-node/storage"
+)
+
+// listenPort is the P2P port every simulated node listens on
+const listenPort = 4001
+
+// Settling: the network is idle once nothing has been in flight for
+// settleRounds checks settleQuantum apart. The nodes process what they
+// receive on their own goroutines, so this waits in host time; virtual
+// time fixes when messages arrive and what time the nodes read, but not
+// how their goroutines interleave.
+const (
+	settleQuantum = 10 * time.Millisecond
+	settleRounds  = 5
+)
+
+// Config describes a simulated network
+type Config struct {
+	Nodes   int
+	Params  *chaincfg.Params // devnet if nil, so mining needs no work
+	Latency time.Duration    // default one-way latency of every link
+	Start   time.Time        // initial virtual time, which the nodes read; now if zero
+}
+
+// Node is one complete node of the simulation
+type Node struct {
+	Name    string // host name on the simulated network
+	Address string // P2P address
+	DB      *storage.MemoryDB
+	Store   *dag.Store
+	Engine  *consensus.Engine
+	Mempool *mempool.Mempool
+	State   *ledger.State
+	Miner   *miner.Miner
+	P2P     *p2p.Node
+}
+
+// Sim runs several nodes in one process over an in-memory network
+type Sim struct {
+	Clock   *Clock
+	Network *Network
+	Nodes   []*Node
+
+	links  map[[2]int]bool // connections made with Connect, restored by Heal
+	cancel context.CancelFunc
+}
+
+// New starts a simulated network of unconnected nodes
+func New(config Config) (*Sim, error) {
+	if config.Nodes <= 0 {
+		return nil, fmt.Errorf("a simulation needs at least one node")
+	}
+	params := config.Params
+	if params == nil {
+		params = &chaincfg.DevNetParams
+	}
+	start := config.Start
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	clock := NewClock(start)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Sim{
+		Clock:   clock,
+		Network: NewNetwork(clock, config.Latency),
+		links:   make(map[[2]int]bool),
+		cancel:  cancel,
+	}
+
+	for i := 0; i < config.Nodes; i++ {
+		node, err := s.newNode(ctx, fmt.Sprintf("node%d", i), params)
+		if err != nil {
+			s.Stop()
+			return nil, err
+		}
+		s.Nodes = append(s.Nodes, node)
+	}
+	return s, nil
+}
+
+// newNode wires up a node the way the node binary does, minus RPC and
+// persistence, and starts its P2P service
+func (s *Sim) newNode(ctx context.Context, name string, params *chaincfg.Params) (*Node, error) {
+	db := storage.NewMemoryDB()
+	dagStore := dag.NewStore(db)
+	if err := dagStore.AddVertex(params.Genesis()); err != nil {
+		return nil, fmt.Errorf("%s: failed to add genesis vertex: %v", name, err)
+	}
+
+	consensusEngine := consensus.NewEngine(dagStore, params)
+	consensusEngine.SetClock(s.Clock)
+	state := ledger.NewState()
+	stateTracker := consensus.NewStateTracker(consensusEngine, dagStore, state)
+	if err := stateTracker.Update(); err != nil {
+		return nil, fmt.Errorf("%s: failed to apply genesis: %v", name, err)
+	}
+	dagStore.OnVertexAdded(func(vertex *dag.Vertex) {
+		stateTracker.Update()
+	})
+
+	txPool := mempool.NewMempool(10000)
+	dagStore.OnVertexAdded(func(vertex *dag.Vertex) {
+		txPool.RemovePayload(vertex.Data)
+	})
+
+	templates := miner.NewTemplateBuilder(dagStore, consensusEngine, txPool, state, miner.DefaultTemplateConfig())
+	blockMiner := miner.NewMiner(dagStore, consensusEngine, txPool, templates, params, 1)
+	blockMiner.SetClock(s.Clock)
+
+	identity, err := p2p.GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+	address := fmt.Sprintf("%s:%d", name, listenPort)
+	p2pNode, err := p2p.NewNode(address, params, identity, dagStore, consensusEngine, txPool, state, p2p.NewAddressBook(""), p2p.NewBanList(""))
+	if err != nil {
+		return nil, err
+	}
+	p2pNode.SetTransport(s.Network.Transport(name))
+	p2pNode.SetClock(s.Clock)
+	blockMiner.SetSyncCheck(p2pNode.IsSynced)
+	if err := p2pNode.Start(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return &Node{
+		Name:    name,
+		Address: address,
+		DB:      db,
+		Store:   dagStore,
+		Engine:  consensusEngine,
+		Mempool: txPool,
+		State:   state,
+		Miner:   blockMiner,
+		P2P:     p2pNode,
+	}, nil
+}
+
+// Stop shuts every node down
+func (s *Sim) Stop() {
+	s.cancel()
+	for _, node := range s.Nodes {
+		if err := node.P2P.Stop(); err != nil {
+			log.Printf("%s: %v", node.Name, err)
+		}
+	}
+}
+
+// Connect has node i dial node j and waits for the network to settle, so
+// the handshake and any sync have finished when it returns
+func (s *Sim) Connect(i, j int, timeout time.Duration) error {
+	if err := s.dial(s.Nodes[i], s.Nodes[j], timeout); err != nil {
+		return err
+	}
+	s.links[[2]int{i, j}] = true
+	return s.Settle(timeout)
+}
+
+// dial connects two nodes. Dialing blocks until the handshake is done,
+// which takes the clock moving, so it runs while the network steps.
+func (s *Sim) dial(from, to *Node, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- from.P2P.AddPeer(to.Address)
+	}()
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-deadline:
+			return fmt.Errorf("%s could not connect to %s within %s", from.Name, to.Name, timeout)
+		case <-time.After(settleQuantum):
+			s.step()
+		}
+	}
+}
+
+// Partition splits the nodes, given by index, into groups that cannot
+// reach each other
+func (s *Sim) Partition(groups ...[]int) {
+	hosts := make([][]string, len(groups))
+	for i, group := range groups {
+		for _, index := range group {
+			hosts[i] = append(hosts[i], s.Nodes[index].Name)
+		}
+	}
+	s.Network.Partition(hosts...)
+}
+
+// Heal reconnects the network, redialing the connections that were cut,
+// and waits for it to settle
+func (s *Sim) Heal(timeout time.Duration) error {
+	s.Network.Heal()
+	for link := range s.links {
+		from, to := s.Nodes[link[0]], s.Nodes[link[1]]
+		if s.connected(from, to) {
+			continue
+		}
+		if err := s.dial(from, to, timeout); err != nil {
+			return err
+		}
+	}
+	return s.Settle(timeout)
+}
+
+// Mine has node i mine n vertices, without waiting for them to spread
+func (s *Sim) Mine(i, n int) ([]*dag.Vertex, error) {
+	return s.Nodes[i].Miner.Mine(context.Background(), n)
+}
+
+// Settle advances the virtual clock from one delivery to the next until
+// nothing is in flight and the nodes have gone quiet
+func (s *Sim) Settle(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	quiet := 0
+	for time.Now().Before(deadline) {
+		time.Sleep(settleQuantum)
+
+		if s.step() {
+			quiet = 0
+			continue
+		}
+		if quiet++; quiet >= settleRounds {
+			return nil
+		}
+	}
+	return fmt.Errorf("network did not settle within %s", timeout)
+}
+
+// step advances the clock to the next delivery, reporting false if
+// nothing is in flight
+func (s *Sim) step() bool {
+	at, pending := s.Network.Pending()
+	if pending {
+		s.Clock.AdvanceTo(at)
+	}
+	return pending
+}
+
+// Converged reports whether every node has the same tips, and so the same
+// DAG
+func (s *Sim) Converged() bool {
+	first := s.Nodes[0].Tips()
+	for _, node := range s.Nodes[1:] {
+		tips := node.Tips()
+		if len(tips) != len(first) {
+			return false
+		}
+		for i := range tips {
+			if tips[i] != first[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// WaitConverged settles the network until every node has the same DAG
+func (s *Sim) WaitConverged(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := s.Settle(time.Until(deadline)); err != nil {
+			return err
+		}
+		if s.Converged() {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("nodes did not converge within %s", timeout)
+		}
+	}
+}
+
+// connected reports whether two nodes have completed a handshake with
+// each other
+func (s *Sim) connected(a, b *Node) bool {
+	for _, peer := range a.P2P.GetPeers() {
+		if peer.ID == b.P2P.ID() {
+			return true
+		}
+	}
+	return false
+}
+
+// Tips returns the node's tips in sorted order
+func (n *Node) Tips() []string {
+	tips := n.Store.GetTips()
+	sort.Strings(tips)
+	return tips
+}
+
+// SelectedTip returns the tip of the node's heaviest chain
+func (n *Node) SelectedTip() (string, error) {
+	path, err := n.Engine.GetHeaviestPath()
+	if err != nil {
+		return "", err
+	}
+	if len(path) == 0 {
+		return "", fmt.Errorf("%s has an empty DAG", n.Name)
+	}
+	return path[len(path)-1].ID, nil
+}
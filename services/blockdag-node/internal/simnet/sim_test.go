@@ -0,0 +1,151 @@
+package simnet
+
+import (
+	"testing"
+	"time"
+
+	"hackodisha/blockdag-node/internal/miner"
+	"hackodisha/blockdag-node/internal/p2p"
+)
+
+const testTimeout = 30 * time.Second
+
+func newTestSim(t *testing.T, nodes int) *Sim {
+	t.Helper()
+	sim, err := New(Config{
+		Nodes:   nodes,
+		Latency: 50 * time.Millisecond,
+		Start:   time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(sim.Stop)
+	return sim
+}
+
+func TestConvergence(t *testing.T) {
+	sim := newTestSim(t, 3)
+	for _, link := range [][2]int{{0, 1}, {1, 2}} {
+		if err := sim.Connect(link[0], link[1], testTimeout); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+	}
+
+	for i := range sim.Nodes {
+		vertices, err := sim.Mine(i, 2)
+		if err != nil {
+			t.Fatalf("node%d Mine: %v", i, err)
+		}
+		if now := sim.Clock.Now(); !vertices[0].Timestamp.Equal(now) {
+			t.Errorf("node%d stamped %s, want the virtual time %s", i, vertices[0].Timestamp, now)
+		}
+	}
+	if err := sim.WaitConverged(testTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := sim.Nodes[0].SelectedTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range sim.Nodes[1:] {
+		if tip, err := node.SelectedTip(); err != nil || tip != want {
+			t.Errorf("%s selected %s (%v), want %s", node.Name, tip, err, want)
+		}
+	}
+	// Genesis plus two vertices from each node
+	vertices, err := sim.Nodes[2].Store.GetTopologicalOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vertices) != 7 {
+		t.Errorf("node2 has %d vertices, want 7", len(vertices))
+	}
+}
+
+func TestPartitionHeal(t *testing.T) {
+	sim := newTestSim(t, 3)
+	for _, link := range [][2]int{{0, 1}, {1, 2}, {0, 2}} {
+		if err := sim.Connect(link[0], link[1], testTimeout); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+	}
+
+	sim.Partition([]int{0}, []int{1, 2})
+	if _, err := sim.Mine(0, 3); err != nil {
+		t.Fatalf("Mine: %v", err)
+	}
+	if _, err := sim.Mine(1, 5); err != nil {
+		t.Fatalf("Mine: %v", err)
+	}
+	if err := sim.Settle(testTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	if sim.Converged() {
+		t.Fatal("partitioned nodes converged")
+	}
+	minority, _ := sim.Nodes[0].SelectedTip()
+	majority, _ := sim.Nodes[2].SelectedTip()
+	if minority == majority {
+		t.Fatalf("both sides selected %s", minority)
+	}
+	if other, _ := sim.Nodes[1].SelectedTip(); other != majority {
+		t.Fatalf("node1 selected %s, node2 %s", other, majority)
+	}
+
+	if err := sim.Heal(testTimeout); err != nil {
+		t.Fatalf("Heal: %v", err)
+	}
+	if err := sim.WaitConverged(testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	for i, node := range sim.Nodes {
+		if !node.Store.HasVertex(minority) || !node.Store.HasVertex(majority) {
+			t.Errorf("node%d is missing a side of the partition", i)
+		}
+	}
+}
+
+func TestPartitionHealPastHeadersWindow(t *testing.T) {
+	sim := newTestSim(t, 3)
+
+	// node0 branches off genesis while node1 builds a chain longer than
+	// one headers message, which node2 syncs
+	if _, err := sim.Mine(0, 3); err != nil {
+		t.Fatalf("Mine: %v", err)
+	}
+	branch, _ := sim.Nodes[0].SelectedTip()
+	for remaining := p2p.MaxHeadersPerMsg + 100; remaining > 0; remaining -= miner.MaxForcedVertices {
+		if _, err := sim.Mine(1, min(remaining, miner.MaxForcedVertices)); err != nil {
+			t.Fatalf("Mine: %v", err)
+		}
+	}
+	if err := sim.Connect(1, 2, testTimeout); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	// node1 learns the branch while cut off from node2, so node2's tips
+	// are far above where the branch split
+	sim.Partition([]int{0, 1}, []int{2})
+	if err := sim.Connect(0, 1, testTimeout); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if !sim.Nodes[1].Store.HasVertex(branch) {
+		t.Fatal("node1 did not sync node0's branch")
+	}
+	if sim.Nodes[2].Store.HasVertex(branch) {
+		t.Fatal("node2 learned the branch across the partition")
+	}
+
+	if err := sim.Heal(testTimeout); err != nil {
+		t.Fatalf("Heal: %v", err)
+	}
+	if err := sim.WaitConverged(testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if !sim.Nodes[2].Store.HasVertex(branch) {
+		t.Error("node2 is missing the branch after healing")
+	}
+}
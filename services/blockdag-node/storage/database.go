@@ -11,7 +11,9 @@ import (
 type Database interface {
 	Get(key string) ([]byte, error)
 	Set(key string, value []byte) error
+	WriteBatch(writes map[string][]byte) error // sets every key or none; a nil value deletes the key
 	Delete(key string) error
+	DeletePrefix(prefix string) error
 	Close() error
 }
 
@@ -63,6 +65,25 @@ func (b *BadgerDB) Set(key string, value []byte) error {
 	})
 }
 
+// WriteBatch stores several key-value pairs in one transaction, deleting
+// the keys whose value is nil
+func (b *BadgerDB) WriteBatch(writes map[string][]byte) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		for key, value := range writes {
+			if value == nil {
+				if err := txn.Delete([]byte(key)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := txn.Set([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // Delete removes a key
 func (b *BadgerDB) Delete(key string) error {
 	return b.db.Update(func(txn *badger.Txn) error {
@@ -70,6 +91,11 @@ func (b *BadgerDB) Delete(key string) error {
 	})
 }
 
+// DeletePrefix removes every key that starts with prefix
+func (b *BadgerDB) DeletePrefix(prefix string) error {
+	return b.db.DropPrefix([]byte(prefix))
+}
+
 // Close closes the database
 func (b *BadgerDB) Close() error {
 	return b.db.Close()
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MemoryDB implements Database in memory, for simulations and tools that
+// need no persistence
+type MemoryDB struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryDB creates an empty in-memory database
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{data: make(map[string][]byte)}
+}
+
+// Get retrieves a value by key
+func (m *MemoryDB) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	value, exists := m.data[key]
+	if !exists {
+		return nil, fmt.Errorf("key not found: %s", key)
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Set stores a key-value pair
+func (m *MemoryDB) Set(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data[key] = append([]byte{}, value...)
+	return nil
+}
+
+// WriteBatch stores several key-value pairs at once, deleting the keys
+// whose value is nil
+func (m *MemoryDB) WriteBatch(writes map[string][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, value := range writes {
+		if value == nil {
+			delete(m.data, key)
+			continue
+		}
+		m.data[key] = append([]byte{}, value...)
+	}
+	return nil
+}
+
+// Delete removes a key
+func (m *MemoryDB) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data, key)
+	return nil
+}
+
+// DeletePrefix removes every key that starts with prefix
+func (m *MemoryDB) DeletePrefix(prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.data {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.data, key)
+		}
+	}
+	return nil
+}
+
+// Close releases nothing; the data lives as long as the MemoryDB
+func (m *MemoryDB) Close() error {
+	return nil
+}
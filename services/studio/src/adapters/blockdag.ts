@@ -13,7 +13,7 @@ export interface NetworkConfig {
 export interface BlockDAGVertex {
   id: string;
   hash: string;
-  data: string;
+  data: string; // base64 of the raw payload
   parents: string[];
   timestamp: number;
   nonce: number;
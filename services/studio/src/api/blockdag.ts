@@ -219,11 +219,12 @@ export async function blockdagRoutes(fastify: FastifyInstance) {
           url: `ws://${config.rpcUrl}/ws`,
           network: query.network,
           supportedEvents: [
-            'new_block',
-            'new_transaction',
-            'peer_connected',
-            'peer_disconnected',
-            'mining_update',
+            'newVertex',
+            'newTransaction',
+            'tipsChanged',
+            'chainChanged',
+            'finalized',
+            'miningStatus',
           ],
         },
       };